@@ -2,17 +2,23 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	"charm.land/log/v2"
 	"github.com/urfave/cli/v3"
+	"primamateria.systems/materia/internal/attributes"
 	"primamateria.systems/materia/internal/config"
 	"primamateria.systems/materia/internal/materia"
+	"primamateria.systems/materia/internal/source/oci"
 	"primamateria.systems/materia/pkg/components"
+	"primamateria.systems/materia/pkg/history"
 	"primamateria.systems/materia/pkg/hostman"
 	"primamateria.systems/materia/pkg/notify"
+	"primamateria.systems/materia/pkg/sourceman"
 )
 
 var Version string
@@ -117,6 +123,200 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name:  "attributes",
+				Usage: "Show resolved attributes and where they came from",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "component",
+						Aliases: []string{"c"},
+						Usage:   "Component (or component@instance) to resolve attributes for",
+					},
+					&cli.StringFlag{
+						Name:    "host",
+						Aliases: []string{"n"},
+						Usage:   "Hostname to resolve attributes for. Defaults to this host",
+					},
+					&cli.StringSliceFlag{
+						Name:    "roles",
+						Aliases: []string{"r"},
+						Usage:   "Roles to resolve attributes for. Defaults to the host's roles",
+					},
+					&cli.BoolFlag{
+						Name:  "reveal",
+						Usage: "Show secret values instead of masking them",
+					},
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Usage:   "Control output format. Supports text,json",
+					},
+				},
+				Action: func(ctx context.Context, cCtx *cli.Command) error {
+					m, err := setup(ctx, configFile, cliflags)
+					if err != nil {
+						return err
+					}
+					defer func() {
+						if err := m.Close(); err != nil {
+							log.Warn("error closing materia: %w", err)
+						}
+					}()
+					comp := components.NewComponent(cCtx.String("component"))
+					filter := attributes.AttributesFilter{
+						Hostname:  m.Hostname,
+						Roles:     m.Roles,
+						Component: comp.Name,
+						Instance:  comp.Instance,
+					}
+					if cCtx.IsSet("host") {
+						filter.Hostname = cCtx.String("host")
+						filter.Roles, err = m.RolesFor(filter.Hostname)
+						if err != nil {
+							return err
+						}
+					}
+					if cCtx.IsSet("roles") {
+						filter.Roles = cCtx.StringSlice("roles")
+					}
+					explained, err := m.ExplainAttributes(ctx, filter)
+					if err != nil {
+						return err
+					}
+					if !cCtx.Bool("reveal") {
+						for i, a := range explained {
+							explained[i] = a.Redacted()
+						}
+					}
+					switch cCtx.String("format") {
+					case "", "text":
+						fmt.Print(materia.FormatAttributes(explained))
+					case "json":
+						out, err := json.MarshalIndent(explained, "", "  ")
+						if err != nil {
+							return fmt.Errorf("error converting to json: %w", err)
+						}
+						fmt.Println(string(out))
+					default:
+						return fmt.Errorf("unsupported output format")
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "render",
+				Usage: "Render components from the source into a directory without changing the host",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "out",
+						Aliases:  []string{"o"},
+						Usage:    "Directory to write rendered components to",
+						Required: true,
+					},
+					&cli.StringSliceFlag{
+						Name:    "component",
+						Aliases: []string{"c"},
+						Usage:   "Component (or component@instance) to render. Defaults to every assigned component",
+					},
+					&cli.StringFlag{
+						Name:    "host",
+						Aliases: []string{"n"},
+						Usage:   "Hostname to render for. Defaults to this host",
+					},
+					&cli.StringSliceFlag{
+						Name:    "roles",
+						Aliases: []string{"r"},
+						Usage:   "Roles to render for. Defaults to the host's roles",
+					},
+					&cli.BoolFlag{
+						Name:  "reveal",
+						Usage: "Write secret values instead of placeholders",
+					},
+				},
+				Action: func(ctx context.Context, cCtx *cli.Command) error {
+					// render what's already synced, it shouldn't need the network or move the checkout
+					cliflags["nosync"] = true
+					m, err := setup(ctx, configFile, cliflags)
+					if err != nil {
+						return err
+					}
+					defer func() {
+						if err := m.Close(); err != nil {
+							log.Warn("error closing materia: %w", err)
+						}
+					}()
+					opts := materia.RenderOptions{
+						Hostname:   cCtx.String("host"),
+						Components: cCtx.StringSlice("component"),
+						Reveal:     cCtx.Bool("reveal"),
+					}
+					if cCtx.IsSet("roles") {
+						opts.Roles = cCtx.StringSlice("roles")
+					}
+					rendered, err := m.Render(ctx, opts)
+					if err != nil {
+						return err
+					}
+					written, err := materia.WriteRendered(cCtx.String("out"), rendered)
+					if err != nil {
+						return err
+					}
+					for _, f := range written {
+						fmt.Println(f)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "snippets",
+				Usage: "Inspect the snippets available to templates",
+				Commands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: "List snippets with their parameters and where they're defined",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "component",
+								Aliases: []string{"c"},
+								Usage:   "Include a component's own snippets",
+							},
+							&cli.StringFlag{
+								Name:    "format",
+								Aliases: []string{"f"},
+								Usage:   "Control output format. Supports text,json",
+							},
+						},
+						Action: func(ctx context.Context, cCtx *cli.Command) error {
+							m, err := setup(ctx, configFile, cliflags)
+							if err != nil {
+								return err
+							}
+							defer func() {
+								if err := m.Close(); err != nil {
+									log.Warn("error closing materia: %w", err)
+								}
+							}()
+							snippets, err := m.ListSnippets(ctx, cCtx.String("component"))
+							if err != nil {
+								return err
+							}
+							switch cCtx.String("format") {
+							case "", "text":
+								fmt.Print(materia.FormatSnippets(snippets))
+							case "json":
+								out, err := json.MarshalIndent(snippets, "", "  ")
+								if err != nil {
+									return fmt.Errorf("error converting to json: %w", err)
+								}
+								fmt.Println(string(out))
+							default:
+								return fmt.Errorf("unsupported output format")
+							}
+							return nil
+						},
+					},
+				},
+			},
 			{
 				Name:  "plan",
 				Usage: "Show application plan",
@@ -213,7 +413,7 @@ func main() {
 					if cCtx.IsSet("resource-only") {
 						cliflags["onlyresource"] = cCtx.Bool("resource-only")
 					}
-					m, err := setup(ctx, configFile, cliflags)
+					m, err := setupRun(ctx, configFile, cliflags, history.TriggerCLI)
 					if err != nil {
 						return err
 					}
@@ -222,29 +422,44 @@ func main() {
 							log.Warn("error closing materia: %w", err)
 						}
 					}()
+					run := m.NewRun(history.TriggerCLI)
+					defer func() {
+						if err := m.SaveRun(run); err != nil {
+							log.Warn(err)
+						}
+					}()
 					plan, err := m.Plan(ctx)
 					if err != nil {
+						run.AddError(err)
 						return err
 					}
+					run.SetPlan(plan)
 					if !quiet {
 						fmt.Println(plan.Pretty())
 					}
 					rep, err := m.Execute(ctx, plan)
+					run.StepsCompleted = rep.StepsCompleted
 					if err != nil {
 						if !errors.Is(err, materia.ErrNeedRollback) {
+							run.AddError(err)
 							log.Warnf("%v/%v steps completed", rep.StepsCompleted, len(plan.Steps()))
 							return err
 						}
+						run.AddError(rep.Error)
+						run.Rollback = history.RollbackFailed
 						err := m.Notifier.Notify(ctx, notify.NotifyRollback, "Rollback initiated")
 						if err != nil {
+							run.AddError(err)
 							return fmt.Errorf("needed rollback but failed to send rollback notification: %w", err)
 						}
 						err = m.Source.Rollback(ctx)
 						if err != nil {
+							run.AddError(err)
 							return err
 						}
 						plan, err := m.Plan(ctx)
 						if err != nil {
+							run.AddError(err)
 							return err
 						}
 						if !quiet {
@@ -252,8 +467,10 @@ func main() {
 						}
 						_, err = m.Execute(ctx, plan)
 						if err != nil {
+							run.AddError(err)
 							return err
 						}
+						run.Rollback = history.RollbackSucceeded
 					}
 					err = m.SavePlan(plan, "lastrun.toml")
 					if err != nil {
@@ -262,6 +479,90 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name:  "history",
+				Usage: "Show recent update runs",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Usage:   "Control output format. Supports text,json",
+					},
+				},
+				Action: func(ctx context.Context, cCtx *cli.Command) error {
+					h, err := openHistory(ctx, configFile)
+					if err != nil {
+						return err
+					}
+					records, err := h.List()
+					if err != nil {
+						return fmt.Errorf("error loading history: %w", err)
+					}
+					switch cCtx.String("format") {
+					case "", "text":
+						if len(records) == 0 {
+							fmt.Println("No runs recorded")
+							return nil
+						}
+						for _, r := range records {
+							fmt.Println(r)
+						}
+					case "json":
+						result, err := json.Marshal(records)
+						if err != nil {
+							return fmt.Errorf("error converting to json: %w", err)
+						}
+						fmt.Printf("%s", string(result))
+					default:
+						return fmt.Errorf("unsupported output format")
+					}
+					return nil
+				},
+				Commands: []*cli.Command{
+					{
+						Name:      "show",
+						Usage:     "Show details of a recorded run",
+						ArgsUsage: "<id>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "format",
+								Aliases: []string{"f"},
+								Usage:   "Control output format. Supports text,json",
+							},
+						},
+						Action: func(ctx context.Context, cCtx *cli.Command) error {
+							id := cCtx.Args().First()
+							if id == "" {
+								return cli.Exit("specify a run to show", 1)
+							}
+							h, err := openHistory(ctx, configFile)
+							if err != nil {
+								return err
+							}
+							r, err := h.Get(id)
+							if err != nil {
+								if errors.Is(err, history.ErrRecordNotFound) {
+									return cli.Exit(fmt.Sprintf("run %v not found", id), 1)
+								}
+								return err
+							}
+							switch cCtx.String("format") {
+							case "", "text":
+								fmt.Print(r.Pretty())
+							case "json":
+								result, err := json.Marshal(r)
+								if err != nil {
+									return fmt.Errorf("error converting to json: %w", err)
+								}
+								fmt.Printf("%s", string(result))
+							default:
+								return fmt.Errorf("unsupported output format")
+							}
+							return nil
+						},
+					},
+				},
+			},
 			{
 				Name:  "remove",
 				Usage: "Remove a non-corrupted component",
@@ -359,6 +660,197 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name:      "publish",
+				Usage:     "Package a repository as an OCI image and push it",
+				ArgsUsage: "<repo-dir> <oci://registry/repository:tag>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "artifact",
+						Aliases: []string{"a"},
+						Usage:   "Push an OCI artifact with the materia media type instead of an image",
+					},
+					&cli.StringFlag{
+						Name:  "revision",
+						Usage: "Revision annotation to use instead of the repository's git HEAD",
+					},
+					&cli.StringFlag{
+						Name:    "sign-key",
+						Aliases: []string{"k"},
+						Usage:   "PEM private key to sign the image with (cosign format signature)",
+					},
+					&cli.StringFlag{
+						Name:  "arch",
+						Usage: "Architecture to label the image config with. Unset by default since repositories don't contain binaries",
+					},
+				},
+				Action: func(ctx context.Context, cCtx *cli.Command) error {
+					if cCtx.Args().Len() != 2 {
+						return cli.Exit("publish needs a repository directory and a destination", 1)
+					}
+					dir, dest := cCtx.Args().Get(0), cCtx.Args().Get(1)
+					if !strings.HasPrefix(dest, "oci://") {
+						return cli.Exit("destination must be an oci:// url", 1)
+					}
+					if err := sourceman.ValidateRepository(dir); err != nil {
+						return err
+					}
+					k, err := config.LoadConfigs(ctx, configFile, map[string]any{})
+					if err != nil {
+						return err
+					}
+					c, err := oci.NewPublishConfig(k, dest)
+					if err != nil {
+						return err
+					}
+					digest, err := oci.Publish(ctx, c, dir, oci.PublishOpts{
+						Artifact:     cCtx.Bool("artifact"),
+						Revision:     cCtx.String("revision"),
+						SigningKey:   cCtx.String("sign-key"),
+						Architecture: cCtx.String("arch"),
+					})
+					if err != nil {
+						return err
+					}
+					fmt.Println(digest)
+					return nil
+				},
+			},
+			{
+				Name:  "remotes",
+				Usage: "Manage the lockfile pinning remote components",
+				Commands: []*cli.Command{
+					{
+						Name:      "lock",
+						Usage:     "Lock unlocked or changed remotes to their current revision",
+						ArgsUsage: "[repo-dir]",
+						Action: func(ctx context.Context, cCtx *cli.Command) error {
+							dir := cCtx.Args().First()
+							if dir == "" {
+								dir = "."
+							}
+							return lockRemotes(ctx, configFile, dir, nil, false)
+						},
+					},
+					{
+						Name:      "update",
+						Usage:     "Move locked remotes to their latest revision. Updates every remote if none are given",
+						ArgsUsage: "<repo-dir> [remote...]",
+						Action: func(ctx context.Context, cCtx *cli.Command) error {
+							if cCtx.Args().Len() < 1 {
+								return cli.Exit("update needs a repository directory", 1)
+							}
+							names := cCtx.Args().Tail()
+							return lockRemotes(ctx, configFile, cCtx.Args().First(), names, len(names) == 0)
+						},
+					},
+				},
+			},
+			{
+				Name:  "vault",
+				Usage: "Manage age and sops attribute vaults in a repository",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "source",
+						Aliases: []string{"s"},
+						Usage:   "Repo source directory",
+						Value:   ".",
+					},
+				},
+				Commands: []*cli.Command{
+					{
+						Name:      "view",
+						Usage:     "Decrypt a vault to stdout",
+						ArgsUsage: "<file>",
+						Action: func(ctx context.Context, cCtx *cli.Command) error {
+							if cCtx.Args().Len() != 1 {
+								return cli.Exit("view needs a vault file", 1)
+							}
+							v, err := loadVaultTools(ctx, configFile, cCtx.String("source"))
+							if err != nil {
+								return err
+							}
+							return v.view(ctx, cCtx.Args().First())
+						},
+					},
+					{
+						Name:      "edit",
+						Usage:     "Edit a vault in $EDITOR, creating it if it doesn't exist",
+						ArgsUsage: "<file>",
+						Action: func(ctx context.Context, cCtx *cli.Command) error {
+							if cCtx.Args().Len() != 1 {
+								return cli.Exit("edit needs a vault file", 1)
+							}
+							v, err := loadVaultTools(ctx, configFile, cCtx.String("source"))
+							if err != nil {
+								return err
+							}
+							return v.edit(ctx, cCtx.Args().First())
+						},
+					},
+					{
+						Name:      "encrypt",
+						Usage:     "Encrypt a plaintext vault. TOML files are encrypted with age, others in place with sops",
+						ArgsUsage: "<file>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "output",
+								Aliases: []string{"o"},
+								Usage:   "Encrypted file to write. Defaults to the input with a .age extension",
+							},
+							&cli.BoolFlag{
+								Name:  "remove",
+								Usage: "Remove the plaintext file after encrypting it",
+							},
+						},
+						Action: func(ctx context.Context, cCtx *cli.Command) error {
+							if cCtx.Args().Len() != 1 {
+								return cli.Exit("encrypt needs a vault file", 1)
+							}
+							v, err := loadVaultTools(ctx, configFile, cCtx.String("source"))
+							if err != nil {
+								return err
+							}
+							return v.encrypt(ctx, cCtx.Args().First(), cCtx.String("output"), cCtx.Bool("remove"))
+						},
+					},
+					{
+						Name:  "rekey",
+						Usage: "Re-encrypt every vault for the current recipients",
+						Action: func(ctx context.Context, cCtx *cli.Command) error {
+							v, err := loadVaultTools(ctx, configFile, cCtx.String("source"))
+							if err != nil {
+								return err
+							}
+							return v.rekey(ctx)
+						},
+					},
+					{
+						Name:        "set",
+						Usage:       "Set an attribute in a vault",
+						ArgsUsage:   "<scope> <key> <value>",
+						Description: "Scope is the vault table to write to: globals, hosts.<host>, roles.<role> or components.<component>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "file",
+								Aliases: []string{"f"},
+								Usage:   "Vault to write to. Defaults to the general age vault",
+							},
+						},
+						Action: func(ctx context.Context, cCtx *cli.Command) error {
+							if cCtx.Args().Len() != 3 {
+								return cli.Exit("set needs a scope, key and value", 1)
+							}
+							v, err := loadVaultTools(ctx, configFile, cCtx.String("source"))
+							if err != nil {
+								return err
+							}
+							args := cCtx.Args()
+							return v.set(ctx, cCtx.String("file"), args.Get(0), args.Get(1), args.Get(2))
+						},
+					},
+				},
+			},
 			{
 				Name:  "doctor",
 				Usage: "remove corrupted installed components. Dry run by default",
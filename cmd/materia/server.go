@@ -13,6 +13,7 @@ import (
 	"charm.land/log/v2"
 	"github.com/knadh/koanf/v2"
 	"primamateria.systems/materia/internal/materia"
+	"primamateria.systems/materia/pkg/history"
 	"primamateria.systems/materia/pkg/hostman"
 	"primamateria.systems/materia/pkg/notify"
 	"primamateria.systems/materia/pkg/source"
@@ -53,6 +54,7 @@ func serverMateria(ctx context.Context, k *koanf.Koanf, sc *ServerConfig) (*mate
 	if err != nil {
 		return nil, err
 	}
+	sm.SetAttributeLookup(remoteAttributeLookup(c, c.SourceDir))
 	err = sm.AddSource(mainRepo, nil, nil, true)
 	if err != nil {
 		return nil, err
@@ -213,7 +215,10 @@ func (s *Server) backgroundSync(ctx context.Context) error {
 			return nil
 		case <-ticker.C:
 			err := s.materia.Source.Sync(ctx, nil)
+			run := s.materia.NewRun(history.TriggerTimer)
 			if err != nil {
+				run.AddError(err)
+				s.saveRun(run)
 				if nerr := s.notify(ctx, fmt.Sprintf("Execution failed to sync sources: %v", err)); nerr != nil {
 					return fmt.Errorf("execution failed to sync sources %w; plus the notification failed: %w", err, nerr)
 				}
@@ -224,6 +229,8 @@ func (s *Server) backgroundSync(ctx context.Context) error {
 			}
 			plan, err := s.materia.Plan(ctx)
 			if err != nil {
+				run.AddError(err)
+				s.saveRun(run)
 				if nerr := s.notify(ctx, fmt.Sprintf("Execution failed to generate plan: %v", err)); nerr != nil {
 					return fmt.Errorf("execution failed to generate plan %w; plus the notification failed: %w", err, nerr)
 				}
@@ -232,8 +239,11 @@ func (s *Server) backgroundSync(ctx context.Context) error {
 				}
 				break
 			}
+			run.SetPlan(plan)
 			rep, err := s.materia.Execute(ctx, plan)
+			materia.RecordExecution(run, rep, err)
 			if err != nil {
+				s.saveRun(run)
 				if nerr := s.notify(ctx, fmt.Sprintf("Execution failed: %v, %v/%v steps completed", err, rep.StepsCompleted, plan.Size())); nerr != nil {
 					return fmt.Errorf("execution failed %w; plus the notification failed: %w", err, nerr)
 				}
@@ -244,6 +254,8 @@ func (s *Server) backgroundSync(ctx context.Context) error {
 			}
 			err = s.materia.SavePlan(plan, "lastrun.toml")
 			if err != nil {
+				run.AddError(err)
+				s.saveRun(run)
 				if nerr := s.notify(ctx, fmt.Sprintf("failed to save lastrun: %v", err)); nerr != nil {
 					return fmt.Errorf("last run saving failed %w; plus the notification failed: %w", err, nerr)
 				}
@@ -252,6 +264,7 @@ func (s *Server) backgroundSync(ctx context.Context) error {
 				}
 				break
 			}
+			s.saveRun(run)
 			if rep.StepsCompleted == -1 {
 				log.Info("Sync ran; no changes made")
 			} else {
@@ -284,6 +297,12 @@ func (s *Server) backgroundPlan(ctx context.Context) error {
 	}
 }
 
+func (s *Server) saveRun(run *history.Record) {
+	if err := s.materia.SaveRun(run); err != nil {
+		log.Warn(err)
+	}
+}
+
 func (s *Server) notify(ctx context.Context, msg string) error {
 	payload := fmt.Sprintf("%v: %v", s.materia.Hostname, msg)
 	return s.materia.Notifier.Notify(ctx, notify.NotifyDefault, payload)
@@ -317,7 +336,10 @@ func (s *Server) updateHookHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	ctx := context.Background()
 	err := s.materia.Source.Sync(ctx, opts)
+	run := s.materia.NewRun(history.TriggerWebhook)
 	if err != nil {
+		run.AddError(err)
+		s.saveRun(run)
 		if nerr := s.notify(ctx, fmt.Sprintf("Execution failed to sync sources: %v", err)); nerr != nil {
 			log.Warnf("execution failed to sync sources %v; plus the notification failed: %v", err, nerr)
 		}
@@ -328,6 +350,8 @@ func (s *Server) updateHookHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	plan, err := s.materia.Plan(ctx)
 	if err != nil {
+		run.AddError(err)
+		s.saveRun(run)
 		if nerr := s.notify(ctx, fmt.Sprintf("Execution failed to generate plan: %v", err)); nerr != nil {
 			log.Warnf("execution failed to generate plan %v; plus the notification failed: %v", err, nerr)
 		}
@@ -336,8 +360,11 @@ func (s *Server) updateHookHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	run.SetPlan(plan)
 	rep, err := s.materia.Execute(ctx, plan)
+	materia.RecordExecution(run, rep, err)
 	if err != nil {
+		s.saveRun(run)
 		if nerr := s.notify(ctx, fmt.Sprintf("Execution failed: %v, %v/%v steps completed", err, rep.StepsCompleted, plan.Size())); nerr != nil {
 			log.Warnf("execution failed %v; plus the notification failed: %v", err, nerr)
 		}
@@ -348,6 +375,8 @@ func (s *Server) updateHookHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	err = s.materia.SavePlan(plan, "lastrun.toml")
 	if err != nil {
+		run.AddError(err)
+		s.saveRun(run)
 		if nerr := s.notify(ctx, fmt.Sprintf("failed to save lastrun: %v", err)); nerr != nil {
 			log.Warnf("last run saving failed %v; plus the notification failed: %v", err, nerr)
 		}
@@ -356,6 +385,7 @@ func (s *Server) updateHookHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	s.saveRun(run)
 	if rep.StepsCompleted == -1 {
 		log.Info("Update ran; no changes made")
 	} else {
@@ -11,6 +11,7 @@ import (
 	"github.com/varlink/go/varlink"
 	"primamateria.systems/materia/internal/materia"
 	varlinkapi "primamateria.systems/materia/pkg/api"
+	"primamateria.systems/materia/pkg/history"
 	"primamateria.systems/materia/pkg/source"
 )
 
@@ -56,11 +57,20 @@ func (s *VarlinkServer) Sync(ctx context.Context, c varlinkapi.VarlinkCall, revi
 
 func (s *VarlinkServer) Update(ctx context.Context, c varlinkapi.VarlinkCall) error {
 	log.Info("running update on request")
+	run := s.materia.NewRun(history.TriggerVarlink)
+	defer func() {
+		if err := s.materia.SaveRun(run); err != nil {
+			log.Warn(err)
+		}
+	}()
 	plan, err := s.materia.Plan(ctx)
 	if err != nil {
+		run.AddError(err)
 		return c.ReplyPlanFailed(ctx, err.Error())
 	}
+	run.SetPlan(plan)
 	rep, err := s.materia.Execute(ctx, plan)
+	materia.RecordExecution(run, rep, err)
 	if err != nil {
 		return c.ReplyExecutionFailed(ctx, err.Error(), int64(rep.StepsCompleted), int64(plan.Size()))
 	}
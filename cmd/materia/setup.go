@@ -7,13 +7,17 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"charm.land/log/v2"
 	"github.com/knadh/koanf/v2"
+	"primamateria.systems/materia/internal/attributes"
 	"primamateria.systems/materia/internal/config"
 	"primamateria.systems/materia/internal/materia"
 	"primamateria.systems/materia/pkg/containers"
+	"primamateria.systems/materia/pkg/history"
 	"primamateria.systems/materia/pkg/hostman"
+	"primamateria.systems/materia/pkg/manifests"
 	"primamateria.systems/materia/pkg/source"
 
 	"primamateria.systems/materia/pkg/sourceman"
@@ -22,6 +26,7 @@ import (
 	"primamateria.systems/materia/internal/source/oci"
 
 	filesource "primamateria.systems/materia/internal/source/file"
+	httpsource "primamateria.systems/materia/internal/source/http"
 )
 
 func setupDirectories(c *materia.MateriaConfig) error {
@@ -97,6 +102,15 @@ func getLocalRepo(k *koanf.Koanf, sourceDir string) (source.Source, error) {
 		if err != nil {
 			return nil, fmt.Errorf("invalid OCI source: %w", err)
 		}
+	case "http":
+		config, err := httpsource.NewConfig(k, sourceDir, sourceConfig.URL)
+		if err != nil {
+			return nil, fmt.Errorf("error creating http config: %w", err)
+		}
+		source, err = httpsource.NewHTTPSource(config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid http source: %w", err)
+		}
 	default:
 		return nil, fmt.Errorf("invalid source URL: %v", sourceConfig.URL)
 	}
@@ -104,6 +118,12 @@ func getLocalRepo(k *koanf.Koanf, sourceDir string) (source.Source, error) {
 }
 
 func setup(ctx context.Context, configFile string, cliflags map[string]any) (*materia.Materia, error) {
+	return setupRun(ctx, configFile, cliflags, "")
+}
+
+// setupRun is setup for a command that records its run. There's no materia to record the run with until the sources
+// are synced, so a failed sync is saved to the history here.
+func setupRun(ctx context.Context, configFile string, cliflags map[string]any, trigger string) (*materia.Materia, error) {
 	k, err := config.LoadConfigs(ctx, configFile, cliflags)
 	if err != nil {
 		return nil, fmt.Errorf("error generating config blob: %w", err)
@@ -143,21 +163,20 @@ func setup(ctx context.Context, configFile string, cliflags map[string]any) (*ma
 	if err != nil {
 		return nil, err
 	}
+	sm.SetAttributeLookup(remoteAttributeLookup(c, c.SourceDir))
 	log.Debug("adding source", "source", mainRepo)
 	err = sm.AddSource(mainRepo, nil, nil, true)
 	if err != nil {
 		return nil, err
 	}
 	if !c.NoSync {
-		log.Debug("syncing source")
-		err = sm.Sync(ctx, nil)
-		if err != nil {
-			return nil, fmt.Errorf("error with initial repo sync: %w", err)
-		}
-		log.Debug("loading remotes")
-		err = sm.LoadRemotes(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("error with repo remotes load: %w", err)
+		if err := syncSources(ctx, sm); err != nil {
+			if trigger != "" {
+				if herr := saveFailedRun(c, trigger, sm.SyncReports(), err); herr != nil {
+					log.Warn(herr)
+				}
+			}
+			return nil, err
 		}
 	}
 	hm, err := hostman.NewHostManager(ctx, hmc)
@@ -198,3 +217,134 @@ func setup(ctx context.Context, configFile string, cliflags map[string]any) (*ma
 	}
 	return m, nil
 }
+
+func syncSources(ctx context.Context, sm *sourceman.SourceManager) error {
+	log.Debug("syncing source")
+	if err := sm.Sync(ctx, nil); err != nil {
+		return fmt.Errorf("error with initial repo sync: %w", err)
+	}
+	log.Debug("loading remotes")
+	if err := sm.LoadRemotes(ctx); err != nil {
+		return fmt.Errorf("error with repo remotes load: %w", err)
+	}
+	return nil
+}
+
+// saveFailedRun records a run that failed before materia was set up
+func saveFailedRun(c *materia.MateriaConfig, trigger string, reports map[string]*source.SyncReport, failure error) error {
+	h, err := history.NewHistory(filepath.Join(c.OutputDir, "history"), c.HistoryConfig.Retention)
+	if err != nil {
+		return err
+	}
+	run := history.NewRecord(trigger)
+	run.SetRevisions(reports)
+	run.AddError(failure)
+	if err := h.Save(run); err != nil {
+		return fmt.Errorf("unable to save run to history: %w", err)
+	}
+	return nil
+}
+
+// remoteAttributeLookup resolves remote credentials from the attributes engine, filtered by host, the host's roles in
+// the repository in sourceDir and remote name. The engine is only created once a remote needs a credential, and then reused.
+func remoteAttributeLookup(c *materia.MateriaConfig, sourceDir string) sourceman.AttributeLookup {
+	engine := sync.OnceValues(func() (materia.AttributesEngine, error) {
+		return materia.NewAttributesEngine(c)
+	})
+	host := sync.OnceValues(func() (attributes.AttributesFilter, error) {
+		hostname := c.Hostname
+		if hostname == "" {
+			var err error
+			if hostname, err = os.Hostname(); err != nil {
+				return attributes.AttributesFilter{}, fmt.Errorf("error getting hostname: %w", err)
+			}
+		}
+		man, err := manifests.LoadMateriaManifest(filepath.Join(sourceDir, manifests.MateriaManifestFile))
+		if err != nil {
+			return attributes.AttributesFilter{}, err
+		}
+		roles, err := materia.HostRoles(c, man, hostname)
+		if err != nil {
+			return attributes.AttributesFilter{}, err
+		}
+		return attributes.AttributesFilter{Hostname: hostname, Roles: roles}, nil
+	})
+	return func(ctx context.Context, remote, name string) (string, error) {
+		vault, err := engine()
+		if err != nil {
+			return "", fmt.Errorf("failed to create attributes engine: %w", err)
+		}
+		filter, err := host()
+		if err != nil {
+			return "", err
+		}
+		filter.Component = remote
+		attrs, err := vault.Lookup(ctx, filter)
+		if err != nil {
+			return "", err
+		}
+		val, ok := attrs[name]
+		if !ok {
+			return "", fmt.Errorf("attribute %v not found", name)
+		}
+		result, ok := val.(string)
+		if !ok {
+			return "", fmt.Errorf("attribute %v is not a string", name)
+		}
+		return result, nil
+	}
+}
+
+func openHistory(ctx context.Context, configFile string) (*history.History, error) {
+	k, err := config.LoadConfigs(ctx, configFile, map[string]any{})
+	if err != nil {
+		return nil, fmt.Errorf("error generating config blob: %w", err)
+	}
+	c, err := materia.NewConfig(k)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config: %w", err)
+	}
+	err = c.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("error validating config: %w", err)
+	}
+	return history.NewHistory(filepath.Join(c.OutputDir, "history"), c.HistoryConfig.Retention)
+}
+
+// lockRemotes writes the remotes lockfile for the repository in dir
+func lockRemotes(ctx context.Context, configFile, dir string, update []string, updateAll bool) error {
+	k, err := config.LoadConfigs(ctx, configFile, map[string]any{})
+	if err != nil {
+		return err
+	}
+	c, err := materia.NewConfig(k)
+	if err != nil {
+		return err
+	}
+	remoteDir, err := os.MkdirTemp("", "materia-remotes-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(remoteDir)
+	}()
+	if err := os.Mkdir(filepath.Join(remoteDir, "components"), 0o755); err != nil {
+		return err
+	}
+	sm, err := sourceman.NewSourceManager(&sourceman.SourceManConfig{
+		SourceDir: dir,
+		RemoteDir: remoteDir,
+	})
+	if err != nil {
+		return err
+	}
+	sm.SetAttributeLookup(remoteAttributeLookup(c, dir))
+	lock, drift, err := sm.LockRemotes(ctx, update, updateAll)
+	if err != nil {
+		return err
+	}
+	for _, d := range drift {
+		log.Warnf("remote %v is locked to %v but its source is at %v, run materia remotes update to move it", d.Name, d.Locked, d.Latest)
+	}
+	return lock.Write(filepath.Join(dir, manifests.RemotesLockFile))
+}
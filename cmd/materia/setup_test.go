@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fileattrs "primamateria.systems/materia/internal/attributes/file"
+	"primamateria.systems/materia/internal/materia"
+	"primamateria.systems/materia/pkg/history"
+	"primamateria.systems/materia/pkg/manifests"
+	"primamateria.systems/materia/pkg/source"
+)
+
+func Test_saveFailedRun(t *testing.T) {
+	c := &materia.MateriaConfig{OutputDir: t.TempDir(), HistoryConfig: history.DefaultHistoryConfig()}
+	reports := map[string]*source.SyncReport{"git:repo": {OldRevision: "abc", NewRevision: "abc"}}
+	require.NoError(t, saveFailedRun(c, history.TriggerCLI, reports, errors.New("error with repo remotes load: unable to sync remote hello")))
+
+	h, err := history.NewHistory(filepath.Join(c.OutputDir, "history"), c.HistoryConfig.Retention)
+	require.NoError(t, err)
+	runs, err := h.List()
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, history.TriggerCLI, runs[0].Trigger)
+	assert.Equal(t, "failed", runs[0].Status())
+	assert.Equal(t, []string{"error with repo remotes load: unable to sync remote hello"}, runs[0].Errors)
+	assert.Equal(t, []history.SourceRevision{{Source: "git:repo", Before: "abc", After: "abc"}}, runs[0].Revisions)
+
+	c.HistoryConfig.Retention = 0
+	require.NoError(t, saveFailedRun(c, history.TriggerCLI, nil, errors.New("sync failed")))
+	runs, err = h.List()
+	require.NoError(t, err)
+	assert.Len(t, runs, 1, "nothing is saved with the history disabled")
+}
+
+func Test_remoteAttributeLookup(t *testing.T) {
+	sourceDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, manifests.MateriaManifestFile), []byte(`
+[Hosts.web01]
+Roles = ["edge"]
+`), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(sourceDir, "secrets"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, "secrets", "edge.toml"), []byte(`
+[roles.edge]
+token = "role-token"
+[components.hello]
+passphrase = "component-passphrase"
+`), 0o644))
+	c := &materia.MateriaConfig{
+		SourceDir:  sourceDir,
+		Hostname:   "web01",
+		Attributes: "file",
+		FileConfig: &fileattrs.Config{BaseDir: "secrets", LoadAllVaults: true},
+	}
+	lookup := remoteAttributeLookup(c, sourceDir)
+	token, err := lookup(context.Background(), "hello", "token")
+	require.NoError(t, err)
+	assert.Equal(t, "role-token", token)
+	passphrase, err := lookup(context.Background(), "hello", "passphrase")
+	require.NoError(t, err)
+	assert.Equal(t, "component-passphrase", passphrase)
+	_, err = lookup(context.Background(), "hello", "missing")
+	assert.Error(t, err)
+}
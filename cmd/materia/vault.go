@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"primamateria.systems/materia/internal/attributes"
+	ageattrs "primamateria.systems/materia/internal/attributes/age"
+	"primamateria.systems/materia/internal/attributes/sops"
+	"primamateria.systems/materia/internal/config"
+	"primamateria.systems/materia/internal/materia"
+)
+
+// vaultTools manages the age and sops vaults in a local checkout of a repository.
+// age vaults are handled directly, sops vaults are handed to the sops command.
+type vaultTools struct {
+	repoDir string
+	age     *ageattrs.Config
+	sops    *sops.Config
+}
+
+func loadVaultTools(ctx context.Context, configFile, repoDir string) (*vaultTools, error) {
+	k, err := config.LoadConfigs(ctx, configFile, map[string]any{})
+	if err != nil {
+		return nil, fmt.Errorf("error generating config blob: %w", err)
+	}
+	c, err := materia.NewConfig(k)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config: %w", err)
+	}
+	v := &vaultTools{repoDir: repoDir, age: c.AgeConfig, sops: c.SopsConfig}
+	if v.age == nil {
+		// age settings all have defaults, so vault commands work without an [age] table
+		v.age, err = ageattrs.NewConfig(k)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func isAgeVault(path string) bool {
+	return filepath.Ext(path) == ".age"
+}
+
+func (v *vaultTools) identities() ([]age.Identity, error) {
+	return ageattrs.LoadIdentities(v.age.IdentPath)
+}
+
+// recipients reads age.recipients, or the recipients file in the attributes directory
+func (v *vaultTools) recipients() ([]age.Recipient, error) {
+	path := v.age.Recipients
+	if path == "" {
+		path = filepath.Join(v.repoDir, v.age.BaseDir, "recipients")
+	}
+	recipients, err := ageattrs.LoadRecipients(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't load recipients: %w", err)
+	}
+	return recipients, nil
+}
+
+// defaultVault is the general vault new attributes are written to
+func (v *vaultTools) defaultVault() string {
+	name := "vault.age"
+	if len(v.age.GeneralVaults) > 0 {
+		name = v.age.GeneralVaults[0]
+	}
+	return filepath.Join(v.repoDir, v.age.BaseDir, name)
+}
+
+func (v *vaultTools) view(ctx context.Context, path string) error {
+	if !isAgeVault(path) {
+		return runSops(ctx, "-d", path)
+	}
+	idents, err := v.identities()
+	if err != nil {
+		return err
+	}
+	data, err := ageattrs.Decrypt(path, idents...)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// edit decrypts a vault to a private temporary file, opens it in $EDITOR and re-encrypts it if it changed
+func (v *vaultTools) edit(ctx context.Context, path string) error {
+	if !isAgeVault(path) {
+		return runSops(ctx, path)
+	}
+	idents, err := v.identities()
+	if err != nil {
+		return err
+	}
+	recipients, err := v.recipients()
+	if err != nil {
+		return err
+	}
+	original, err := ageattrs.Decrypt(path, idents...)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp("", "materia-vault-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	// keep the inner extension so the editor highlights the right format
+	name := strings.TrimSuffix(filepath.Base(path), ".age")
+	if attributes.VaultFormat(name) == "" {
+		name += ".toml"
+	}
+	plaintext := filepath.Join(tmpDir, name)
+	if err := os.WriteFile(plaintext, original, 0o600); err != nil {
+		return err
+	}
+	for {
+		if err := runEditor(ctx, plaintext); err != nil {
+			return err
+		}
+		edited, err := os.ReadFile(plaintext)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(edited, original) {
+			fmt.Println("No changes made")
+			return nil
+		}
+		if _, err := ageattrs.ParseVault(path, edited); err != nil {
+			if !confirm(fmt.Sprintf("%v. Edit again?", err)) {
+				return err
+			}
+			continue
+		}
+		return ageattrs.Encrypt(path, edited, recipients...)
+	}
+}
+
+// encrypt encrypts a plaintext vault. TOML vaults are encrypted with age, writing vault.toml to vault.age unless output is set,
+// anything else is encrypted in place by sops unless output is an age vault, e.g. vault.yml to vault.yml.age.
+func (v *vaultTools) encrypt(ctx context.Context, path, output string, remove bool) error {
+	switch {
+	case output != "" && !isAgeVault(output):
+		return errors.New("age vaults must be written to a .age file")
+	case output == "" && filepath.Ext(path) != ".toml":
+		return runSops(ctx, "-e", "-i", path)
+	}
+	recipients, err := v.recipients()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		output = strings.TrimSuffix(path, filepath.Ext(path)) + ".age"
+	}
+	if _, err := ageattrs.ParseVault(output, data); err != nil {
+		return fmt.Errorf("%v: %w", path, err)
+	}
+	if err := ageattrs.Encrypt(output, data, recipients...); err != nil {
+		return err
+	}
+	if remove {
+		return os.Remove(path)
+	}
+	return nil
+}
+
+// rekey re-encrypts every age vault for the current recipients, and updates the keys of configured sops vaults
+func (v *vaultTools) rekey(ctx context.Context) error {
+	idents, err := v.identities()
+	if err != nil {
+		return err
+	}
+	recipients, err := v.recipients()
+	if err != nil {
+		return err
+	}
+	files, err := ageattrs.Rekey(filepath.Join(v.repoDir, v.age.BaseDir), idents, recipients)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Printf("Rekeyed %v\n", f)
+	}
+	if v.sops == nil {
+		return nil
+	}
+	sopsFiles, err := sops.VaultFiles(*v.sops, v.repoDir)
+	if err != nil {
+		return err
+	}
+	for _, f := range sopsFiles {
+		if err := runSops(ctx, "updatekeys", "-y", f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *vaultTools) set(ctx context.Context, path, scope, key, value string) error {
+	if path == "" {
+		path = v.defaultVault()
+	}
+	if !isAgeVault(path) {
+		table, name, err := attributes.ParseScope(scope)
+		if err != nil {
+			return err
+		}
+		index := fmt.Sprintf("[%q]", table)
+		if name != "" {
+			index += fmt.Sprintf("[%q]", name)
+		}
+		index += fmt.Sprintf("[%q]", key)
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		return runSops(ctx, "set", path, index, string(encoded))
+	}
+	idents, err := v.identities()
+	if err != nil {
+		return err
+	}
+	recipients, err := v.recipients()
+	if err != nil {
+		return err
+	}
+	return ageattrs.SetAttribute(path, scope, key, value, idents, recipients)
+}
+
+func runSops(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, "sops", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sops %v failed: %w", args[0], err)
+	}
+	return nil
+}
+
+func runEditor(ctx context.Context, path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := append(strings.Fields(editor), path)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor failed: %w", err)
+	}
+	return nil
+}
+
+func confirm(prompt string) bool {
+	fmt.Printf("%v [Y/n] ", prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "" || answer == "y" || answer == "yes"
+}
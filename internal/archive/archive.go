@@ -0,0 +1,241 @@
+// Package archive safely extracts source archives and atomically swaps them into place
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"charm.land/log/v2"
+	"golang.org/x/sys/unix"
+)
+
+var ErrUnsafePath = errors.New("unsafe path in archive")
+
+// UntarAtomic extracts a tar stream into a staging directory next to dest and swaps it into place once complete,
+// so dest always holds either the old or the new tree
+func UntarAtomic(r io.Reader, dest string) error {
+	dest = filepath.Clean(dest)
+	staging := siblingPath(dest, "staging")
+	if err := os.RemoveAll(staging); err != nil {
+		return fmt.Errorf("unable to remove old staging directory: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return fmt.Errorf("unable to create parent directory: %w", err)
+	}
+	if err := Untar(r, staging); err != nil {
+		_ = os.RemoveAll(staging)
+		return err
+	}
+	if err := Swap(staging, dest); err != nil {
+		_ = os.RemoveAll(staging)
+		return err
+	}
+	return nil
+}
+
+// Untar extracts a tar stream into dir. Entries may not escape dir, either through their names or through symlinks.
+func Untar(r io.Reader, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("unable to create %v: %w", dir, err)
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = root.Close()
+	}()
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar header: %w", err)
+		}
+		name, err := localName(header.Name)
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			continue
+		}
+		if err := extractEntry(root, tr, header, name); err != nil {
+			return err
+		}
+	}
+	return checkSymlinks(dir)
+}
+
+func extractEntry(root *os.Root, tr *tar.Reader, header *tar.Header, name string) error {
+	mode := os.FileMode(header.Mode).Perm()
+	if parent := filepath.Dir(name); parent != "." {
+		if err := root.MkdirAll(parent, 0o755); err != nil {
+			return fmt.Errorf("failed to create parent directory for %v: %w", name, err)
+		}
+	}
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if info, err := root.Lstat(name); err == nil && !info.IsDir() {
+			if err := root.Remove(name); err != nil {
+				return fmt.Errorf("failed to replace %v: %w", name, err)
+			}
+		}
+		if err := root.MkdirAll(name, 0o755); err != nil {
+			return fmt.Errorf("failed to create directory %v: %w", name, err)
+		}
+		// keep directories writable so their contents can be extracted
+		return root.Chmod(name, mode|0o700)
+	case tar.TypeReg:
+		if err := removeExisting(root, name); err != nil {
+			return err
+		}
+		f, err := root.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+		if err != nil {
+			return fmt.Errorf("failed to create file %v: %w", name, err)
+		}
+		_, err = io.Copy(f, tr)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write file %v: %w", name, err)
+		}
+		return nil
+	case tar.TypeSymlink:
+		if filepath.IsAbs(header.Linkname) || !filepath.IsLocal(filepath.Join(filepath.Dir(name), header.Linkname)) {
+			return fmt.Errorf("%w: symlink %v points outside the archive: %v", ErrUnsafePath, name, header.Linkname)
+		}
+		if err := removeExisting(root, name); err != nil {
+			return err
+		}
+		if err := root.Symlink(header.Linkname, name); err != nil {
+			return fmt.Errorf("failed to create symlink %v: %w", name, err)
+		}
+		return nil
+	case tar.TypeLink:
+		target, err := localName(header.Linkname)
+		if err != nil {
+			return err
+		}
+		info, err := root.Lstat(target)
+		if err != nil {
+			return fmt.Errorf("hardlink %v target %v: %w", name, header.Linkname, err)
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%w: hardlink %v must point to a regular file", ErrUnsafePath, name)
+		}
+		if err := removeExisting(root, name); err != nil {
+			return err
+		}
+		if err := root.Link(target, name); err != nil {
+			return fmt.Errorf("failed to create hardlink %v: %w", name, err)
+		}
+		return nil
+	default:
+		log.Debugf("Skipping unsupported file type %c for %s", header.Typeflag, header.Name)
+		return nil
+	}
+}
+
+func removeExisting(root *os.Root, name string) error {
+	info, err := root.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("cannot replace directory %v with a file", name)
+	}
+	return root.Remove(name)
+}
+
+// localName cleans an archive entry name, rejecting anything that would land outside the extraction directory
+func localName(name string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(name, "./")))
+	if cleaned == "." {
+		return cleaned, nil
+	}
+	if !filepath.IsLocal(cleaned) {
+		return "", fmt.Errorf("%w: %v", ErrUnsafePath, name)
+	}
+	return cleaned, nil
+}
+
+// checkSymlinks makes sure every symlink resolves inside dir, catching escapes through chains of links
+func checkSymlinks(dir string) error {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return fmt.Errorf("%w: symlink %v does not resolve: %w", ErrUnsafePath, path, err)
+		}
+		rel, err := filepath.Rel(realDir, resolved)
+		if err != nil || (!filepath.IsLocal(rel) && rel != ".") {
+			return fmt.Errorf("%w: symlink %v resolves outside the archive", ErrUnsafePath, path)
+		}
+		return nil
+	})
+}
+
+// Swap atomically replaces dest with staged. staged and dest must be on the same filesystem.
+func Swap(staged, dest string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, staged, unix.AT_FDCWD, dest, unix.RENAME_EXCHANGE)
+	switch {
+	case err == nil:
+		// staged now holds the old tree
+		removeOld(staged)
+		return nil
+	case errors.Is(err, unix.ENOENT):
+		// nothing to replace yet
+		return os.Rename(staged, dest)
+	case errors.Is(err, unix.ENOSYS), errors.Is(err, unix.EINVAL):
+		// exchange not supported by the kernel or filesystem
+	default:
+		return fmt.Errorf("unable to swap in %v: %w", dest, err)
+	}
+	old := siblingPath(dest, "old")
+	if err := os.RemoveAll(old); err != nil {
+		return err
+	}
+	if err := os.Rename(dest, old); err != nil {
+		return fmt.Errorf("unable to move aside %v: %w", dest, err)
+	}
+	if err := os.Rename(staged, dest); err != nil {
+		if rerr := os.Rename(old, dest); rerr != nil {
+			return fmt.Errorf("unable to swap in %v: %w; plus restoring failed: %w", dest, err, rerr)
+		}
+		return fmt.Errorf("unable to swap in %v: %w", dest, err)
+	}
+	removeOld(old)
+	return nil
+}
+
+// removeOld cleans up a replaced tree, failing to do so doesn't affect the swap
+func removeOld(path string) {
+	if err := os.RemoveAll(path); err != nil {
+		log.Warn("unable to remove old tree", "path", path, "error", err)
+	}
+}
+
+func siblingPath(path, suffix string) string {
+	return filepath.Join(filepath.Dir(path), fmt.Sprintf(".%v.%v", filepath.Base(path), suffix))
+}
@@ -0,0 +1,118 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type entry struct {
+	name, link, content string
+	kind                byte
+}
+
+func buildTar(t *testing.T, entries ...entry) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		kind := e.kind
+		if kind == 0 {
+			kind = tar.TypeReg
+		}
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     e.name,
+			Linkname: e.link,
+			Mode:     0o644,
+			Size:     int64(len(e.content)),
+			Typeflag: kind,
+		}))
+		_, err := tw.Write([]byte(e.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return &buf
+}
+
+func TestUntar_Unsafe(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []entry
+	}{
+		{"parent traversal", []entry{{name: "../escape", content: "x"}}},
+		{"nested traversal", []entry{{name: "a/../../escape", content: "x"}}},
+		{"absolute name", []entry{{name: "/etc/escape", content: "x"}}},
+		{"absolute symlink", []entry{{name: "link", link: "/etc", kind: tar.TypeSymlink}}},
+		{"relative symlink escape", []entry{{name: "a/link", link: "../../etc", kind: tar.TypeSymlink}}},
+		{"symlink chain escape", []entry{
+			{name: "dir/", kind: tar.TypeDir},
+			{name: "self", link: ".", kind: tar.TypeSymlink},
+			{name: "dir/up", link: "../self/..", kind: tar.TypeSymlink},
+		}},
+		{"write through symlink", []entry{
+			{name: "self", link: ".", kind: tar.TypeSymlink},
+			{name: "up", link: "self/..", kind: tar.TypeSymlink},
+			{name: "up/escape", content: "x"},
+		}},
+		{"hardlink escape", []entry{{name: "link", link: "../escape", kind: tar.TypeLink}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			err := Untar(buildTar(t, tt.entries...), filepath.Join(parent, "dest"))
+			require.Error(t, err)
+			_, err = os.Stat(filepath.Join(parent, "escape"))
+			assert.True(t, errors.Is(err, os.ErrNotExist))
+		})
+	}
+}
+
+func TestUntar(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "dest")
+	require.NoError(t, Untar(buildTar(t,
+		entry{name: "./MANIFEST.toml", content: "manifest"},
+		entry{name: "components/a/", kind: tar.TypeDir},
+		entry{name: "components/a/file", content: "a"},
+		entry{name: "components/b", link: "a", kind: tar.TypeSymlink},
+		entry{name: "components/a/hard", link: "components/a/file", kind: tar.TypeLink},
+	), dest))
+	data, err := os.ReadFile(filepath.Join(dest, "components", "b", "file"))
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(data))
+	data, err = os.ReadFile(filepath.Join(dest, "components", "a", "hard"))
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(data))
+	data, err = os.ReadFile(filepath.Join(dest, "MANIFEST.toml"))
+	require.NoError(t, err)
+	assert.Equal(t, "manifest", string(data))
+}
+
+func TestUntarAtomic(t *testing.T) {
+	parent := t.TempDir()
+	dest := filepath.Join(parent, "dest")
+	require.NoError(t, UntarAtomic(buildTar(t, entry{name: "old", content: "old"}, entry{name: "keep", content: "1"}), dest))
+	require.NoError(t, UntarAtomic(buildTar(t, entry{name: "keep", content: "2"}), dest))
+
+	_, err := os.Stat(filepath.Join(dest, "old"))
+	assert.True(t, errors.Is(err, os.ErrNotExist), "files removed upstream should not linger")
+	data, err := os.ReadFile(filepath.Join(dest, "keep"))
+	require.NoError(t, err)
+	assert.Equal(t, "2", string(data))
+
+	// a failed extraction leaves the current tree alone
+	require.Error(t, UntarAtomic(buildTar(t, entry{name: "new", content: "x"}, entry{name: "../bad", content: "x"}), dest))
+	data, err = os.ReadFile(filepath.Join(dest, "keep"))
+	require.NoError(t, err)
+	assert.Equal(t, "2", string(data))
+	_, err = os.Stat(filepath.Join(dest, "new"))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	entries, err := os.ReadDir(parent)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "staging directories should be cleaned up")
+}
@@ -1,24 +1,21 @@
 package age
 
 import (
-	"bytes"
 	"context"
-	"errors"
 	"fmt"
-	"io/fs"
-	"os"
 	"path/filepath"
 
 	"filippo.io/age"
-	"github.com/BurntSushi/toml"
 	"primamateria.systems/materia/internal/attributes"
 )
 
 type AgeStore struct {
 	identities    []age.Identity
+	dir           string
 	vaultfiles    []string
 	generalVaults []string
 	loadAllVaults bool
+	cache         attributes.VaultCache
 }
 
 func NewAgeStore(c Config, sourceDir string) (*AgeStore, error) {
@@ -26,45 +23,57 @@ func NewAgeStore(c Config, sourceDir string) (*AgeStore, error) {
 	if err != nil {
 		return nil, err
 	}
-	var a AgeStore
-	ifile, err := os.Open(c.IdentPath)
+	a := &AgeStore{dir: filepath.Join(sourceDir, c.BaseDir), loadAllVaults: c.LoadAllVaults}
+	a.identities, err = LoadIdentities(c.IdentPath)
 	if err != nil {
 		return nil, err
 	}
-	idents, err := age.ParseIdentities(ifile)
+	if len(c.GeneralVaults) == 0 {
+		c.GeneralVaults = []string{"vault.age", "attributes.age", "vault.toml.age", "vault.yml.age", "vault.yaml.age", "vault.json.age"}
+	}
+	a.generalVaults = c.GeneralVaults
+	a.vaultfiles, err = VaultFiles(a.dir)
 	if err != nil {
 		return nil, err
 	}
-	if len(idents) == 0 {
-		return nil, errors.New("need at least one identity")
+	return a, nil
+}
+
+// Invalidate drops decrypted vaults and rescans the vault files when the source has changed
+func (a *AgeStore) Invalidate(generation string) error {
+	if !a.cache.Reset(generation) {
+		return nil
 	}
-	a.identities = idents
-	if len(c.GeneralVaults) == 0 {
-		c.GeneralVaults = []string{"vault.age", "attributes.age"}
+	files, err := VaultFiles(a.dir)
+	if err != nil {
+		return err
 	}
-	a.generalVaults = c.GeneralVaults
-	err = filepath.WalkDir(filepath.Join(sourceDir, c.BaseDir), func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.Name() == ".git" {
-			return nil
-		}
-		if filepath.Ext(path) == ".age" {
-			a.vaultfiles = append(a.vaultfiles, path)
-		}
-		return nil
-	})
+	a.vaultfiles = files
+	return nil
+}
+
+func (a *AgeStore) load(path string) (attributes.AttributeVault, error) {
+	decrypted, err := Decrypt(path, a.identities...)
 	if err != nil {
-		return nil, err
+		return attributes.AttributeVault{}, err
+	}
+	attrs, err := ParseVault(path, decrypted)
+	if err != nil {
+		return attrs, fmt.Errorf("%v: %w", path, err)
 	}
-	return &a, nil
+	return attrs, nil
 }
 
 func (a *AgeStore) Lookup(ctx context.Context, f attributes.AttributesFilter) (map[string]any, error) {
-	attrs := attributes.AttributeVault{}
+	t, err := a.Trace(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return t.Resolved(), nil
+}
 
-	results := make(map[string]any)
+func (a *AgeStore) Trace(ctx context.Context, f attributes.AttributesFilter) (attributes.Trace, error) {
+	results := make(attributes.Trace)
 	var files []string
 	var err error
 	if a.loadAllVaults {
@@ -81,24 +90,11 @@ func (a *AgeStore) Lookup(ctx context.Context, f attributes.AttributesFilter) (m
 			return nil, ctx.Err()
 		default:
 		}
-		file, err := os.Open(v)
-		if err != nil {
-			return nil, err
-		}
-		decrypted, err := age.Decrypt(file, a.identities...)
-		if err != nil {
-			return nil, fmt.Errorf("unable to decrypt age file %v: %w", v, err)
-		}
-		buf := new(bytes.Buffer)
-		_, err = buf.ReadFrom(decrypted)
-		if err != nil {
-			return nil, err
-		}
-		err = toml.Unmarshal(buf.Bytes(), &attrs)
+		attrs, err := a.cache.Load(v, a.load)
 		if err != nil {
 			return nil, err
 		}
-		attributes.ExtractVaultAttributes(results, attrs, f)
+		attributes.TraceVaultAttributes(results, attrs, f, attributes.Provenance{Engine: "age", Source: v, Secret: true})
 	}
 	return results, nil
 }
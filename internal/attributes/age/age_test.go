@@ -0,0 +1,54 @@
+package age
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"primamateria.systems/materia/internal/attributes"
+)
+
+func TestAgeStore_Cache(t *testing.T) {
+	id := newIdentity(t)
+	sourceDir := t.TempDir()
+	keyfile := filepath.Join(t.TempDir(), "key.txt")
+	require.NoError(t, os.WriteFile(keyfile, []byte(id.String()+"\n"), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(sourceDir, "secrets"), 0o755))
+	vault := filepath.Join(sourceDir, "secrets", "vault.age")
+	write := func(domain string) {
+		require.NoError(t, Encrypt(vault, []byte("[globals]\ndomain = \""+domain+"\"\n"), id.Recipient()))
+	}
+	write("example.com")
+
+	s, err := NewAgeStore(Config{IdentPath: keyfile, BaseDir: "secrets"}, sourceDir)
+	require.NoError(t, err)
+	ctx := context.Background()
+	lookup := func() any {
+		attrs, err := s.Lookup(ctx, attributes.AttributesFilter{Hostname: "web01"})
+		require.NoError(t, err)
+		return attrs["domain"]
+	}
+
+	require.NoError(t, s.Invalidate("source@abc"))
+	assert.Equal(t, "example.com", lookup())
+	write("example.org")
+	assert.Equal(t, "example.com", lookup(), "vaults should only be decrypted once per generation")
+	require.NoError(t, s.Invalidate("source@abc"))
+	assert.Equal(t, "example.com", lookup())
+
+	require.NoError(t, s.Invalidate("source@def"))
+	assert.Equal(t, "example.org", lookup(), "a new generation should reload vaults")
+
+	// new vault files are found once the source changes
+	require.NoError(t, Encrypt(filepath.Join(sourceDir, "secrets", "web01.age"), []byte("[globals]\ndomain = \"web01.example.org\"\n"), id.Recipient()))
+	require.NoError(t, s.Invalidate("source@ghi"))
+	assert.Equal(t, "web01.example.org", lookup())
+
+	write("example.net")
+	require.NoError(t, os.Remove(filepath.Join(sourceDir, "secrets", "web01.age")))
+	require.NoError(t, s.Invalidate(""))
+	assert.Equal(t, "example.net", lookup(), "an unknown generation should always reload")
+}
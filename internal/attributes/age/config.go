@@ -9,6 +9,7 @@ import (
 type Config struct {
 	IdentPath     string   `toml:"keyfile"`
 	BaseDir       string   `toml:"base_dir"`
+	Recipients    string   `toml:"recipients"`
 	GeneralVaults []string `toml:"vaults"`
 	LoadAllVaults bool     `toml:"load_all_vaults"`
 }
@@ -35,10 +36,11 @@ func NewConfig(k *koanf.Koanf) (*Config, error) {
 	if c.BaseDir == "" {
 		c.BaseDir = "secrets"
 	}
+	c.Recipients = k.String("age.recipients")
 	c.GeneralVaults = k.Strings("age.vaults")
 	c.LoadAllVaults = k.Bool("age.load_all_vaults")
 	if len(c.GeneralVaults) == 0 {
-		c.GeneralVaults = []string{"vault.age", "attributes.age"}
+		c.GeneralVaults = []string{"vault.age", "attributes.age", "vault.toml.age", "vault.yml.age", "vault.yaml.age", "vault.json.age"}
 	}
 	return &c, nil
 }
@@ -50,6 +52,9 @@ func (c *Config) Merge(other *Config) {
 	if other.BaseDir != "" {
 		c.BaseDir = other.BaseDir
 	}
+	if other.Recipients != "" {
+		c.Recipients = other.Recipients
+	}
 	if len(other.GeneralVaults) > 0 {
 		c.GeneralVaults = append(c.GeneralVaults, other.GeneralVaults...)
 	}
@@ -57,5 +62,5 @@ func (c *Config) Merge(other *Config) {
 }
 
 func (c Config) String() string {
-	return fmt.Sprintf("Keyfile Path:%v\nBase Path: %v\nVaults: %v\nLoad all vaults: %v\n", c.IdentPath, c.BaseDir, c.GeneralVaults, c.LoadAllVaults)
+	return fmt.Sprintf("Keyfile Path:%v\nBase Path: %v\nRecipients: %v\nVaults: %v\nLoad all vaults: %v\n", c.IdentPath, c.BaseDir, c.Recipients, c.GeneralVaults, c.LoadAllVaults)
 }
@@ -0,0 +1,164 @@
+package age
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"filippo.io/age"
+	"primamateria.systems/materia/internal/attributes"
+)
+
+func LoadIdentities(path string) ([]age.Identity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	idents, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse age identities %v: %w", path, err)
+	}
+	if len(idents) == 0 {
+		return nil, errors.New("need at least one identity")
+	}
+	return idents, nil
+}
+
+// LoadRecipients reads a recipients file with one age public key per line
+func LoadRecipients(path string) ([]age.Recipient, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	recipients, err := age.ParseRecipients(f)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse age recipients %v: %w", path, err)
+	}
+	return recipients, nil
+}
+
+func Decrypt(path string, identities ...age.Identity) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	decrypted, err := age.Decrypt(f, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt age file %v: %w", path, err)
+	}
+	return io.ReadAll(decrypted)
+}
+
+// Encrypt writes data to path encrypted for recipients, replacing the file atomically
+func Encrypt(path string, data []byte, recipients ...age.Recipient) error {
+	if len(recipients) == 0 {
+		return errors.New("need at least one recipient")
+	}
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipients...)
+	if err != nil {
+		return fmt.Errorf("unable to encrypt %v: %w", path, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("unable to encrypt %v: %w", path, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("unable to encrypt %v: %w", path, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".vault-*")
+	if err != nil {
+		return fmt.Errorf("unable to write %v: %w", path, err)
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("unable to write %v: %w", path, err)
+	}
+	return nil
+}
+
+// ParseVault decodes the decrypted contents of the vault at path, in the format given by its inner extension
+func ParseVault(path string, data []byte) (attributes.AttributeVault, error) {
+	return attributes.DecodeVault(attributes.EncryptedVaultFormat(path), data)
+}
+
+// SetAttribute sets key in the scope's table of an encrypted vault, creating the vault if it doesn't exist.
+// The vault is re-encoded, so comments and formatting aren't kept.
+func SetAttribute(path, scope, key string, value any, identities []age.Identity, recipients []age.Recipient) error {
+	var vault attributes.AttributeVault
+	data, err := Decrypt(path, identities...)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		vault, err = ParseVault(path, data)
+		if err != nil {
+			return fmt.Errorf("%v: %w", path, err)
+		}
+	}
+	if err := vault.Set(scope, key, value); err != nil {
+		return err
+	}
+	encoded, err := attributes.EncodeVault(attributes.EncryptedVaultFormat(path), vault)
+	if err != nil {
+		return err
+	}
+	return Encrypt(path, encoded, recipients...)
+}
+
+// VaultFiles lists the age vaults under dir
+func VaultFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && filepath.Ext(path) == ".age" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Rekey re-encrypts every vault under dir for recipients. Every vault is decrypted before any are rewritten,
+// so a vault the identities can't open leaves everything untouched.
+func Rekey(dir string, identities []age.Identity, recipients []age.Recipient) ([]string, error) {
+	files, err := VaultFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	decrypted := make([][]byte, len(files))
+	for i, f := range files {
+		decrypted[i], err = Decrypt(f, identities...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, f := range files {
+		if err := Encrypt(f, decrypted[i], recipients...); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
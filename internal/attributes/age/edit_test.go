@@ -0,0 +1,96 @@
+package age
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newIdentity(t *testing.T) *age.X25519Identity {
+	t.Helper()
+	id, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	return id
+}
+
+func TestSetAttribute(t *testing.T) {
+	id := newIdentity(t)
+	path := filepath.Join(t.TempDir(), "vault.age")
+
+	require.NoError(t, SetAttribute(path, "globals", "domain", "example.com", []age.Identity{id}, []age.Recipient{id.Recipient()}))
+	require.NoError(t, SetAttribute(path, "hosts.web01.example.com", "ip", "192.168.1.10", []age.Identity{id}, []age.Recipient{id.Recipient()}))
+	require.NoError(t, SetAttribute(path, "globals", "domain", "example.org", []age.Identity{id}, []age.Recipient{id.Recipient()}))
+	assert.Error(t, SetAttribute(path, "volumes.data", "size", "1G", []age.Identity{id}, []age.Recipient{id.Recipient()}))
+
+	data, err := Decrypt(path, id)
+	require.NoError(t, err)
+	vault, err := ParseVault(path, data)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"domain": "example.org"}, vault.Globals)
+	assert.Equal(t, map[string]map[string]any{"web01.example.com": {"ip": "192.168.1.10"}}, vault.Hosts)
+}
+
+func TestSetAttributeYAML(t *testing.T) {
+	id := newIdentity(t)
+	path := filepath.Join(t.TempDir(), "vault.yml.age")
+
+	require.NoError(t, SetAttribute(path, "roles.web", "port", "8080", []age.Identity{id}, []age.Recipient{id.Recipient()}))
+	data, err := Decrypt(path, id)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "roles:\n    web:\n        port: \"8080\"\n")
+	vault, err := ParseVault(path, data)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[string]any{"web": {"port": "8080"}}, vault.Roles)
+}
+
+func TestRekey(t *testing.T) {
+	oldID, newID := newIdentity(t), newIdentity(t)
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "hosts"), 0o755))
+	files := []string{filepath.Join(dir, "vault.age"), filepath.Join(dir, "hosts", "web01.age")}
+	for _, f := range files {
+		require.NoError(t, Encrypt(f, []byte("[globals]\nkey = \"value\"\n"), oldID.Recipient()))
+	}
+
+	rekeyed, err := Rekey(dir, []age.Identity{oldID}, []age.Recipient{oldID.Recipient(), newID.Recipient()})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, files, rekeyed)
+	for _, f := range files {
+		data, err := Decrypt(f, newID)
+		require.NoError(t, err, "new recipient should be able to decrypt %v", f)
+		assert.Equal(t, "[globals]\nkey = \"value\"\n", string(data))
+	}
+
+	// removing a recipient locks it out
+	_, err = Rekey(dir, []age.Identity{newID}, []age.Recipient{newID.Recipient()})
+	require.NoError(t, err)
+	_, err = Decrypt(files[0], oldID)
+	assert.Error(t, err)
+
+	// a vault that can't be decrypted stops the rekey before anything is rewritten
+	before, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	require.NoError(t, Encrypt(filepath.Join(dir, "other.age"), []byte(""), oldID.Recipient()))
+	_, err = Rekey(dir, []age.Identity{newID}, []age.Recipient{oldID.Recipient()})
+	assert.Error(t, err)
+	after, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+}
+
+func TestLoadRecipients(t *testing.T) {
+	id := newIdentity(t)
+	path := filepath.Join(t.TempDir(), "recipients")
+	require.NoError(t, os.WriteFile(path, []byte("# ops team\n"+id.Recipient().String()+"\n\n"), 0o644))
+	recipients, err := LoadRecipients(path)
+	require.NoError(t, err)
+	assert.Len(t, recipients, 1)
+
+	require.NoError(t, os.WriteFile(path, []byte("not-a-key\n"), 0o644))
+	_, err = LoadRecipients(path)
+	assert.Error(t, err)
+}
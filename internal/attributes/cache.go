@@ -0,0 +1,48 @@
+package attributes
+
+import "sync"
+
+// Invalidator is implemented by engines that keep vaults between lookups.
+// Invalidate is called before each plan with the current source generation.
+type Invalidator interface {
+	Invalidate(generation string) error
+}
+
+// VaultCache keeps decrypted and parsed vaults in memory so each one is only decrypted once per source generation.
+// The zero value is ready to use.
+type VaultCache struct {
+	mu         sync.Mutex
+	generation string
+	vaults     map[string]AttributeVault
+}
+
+// Load returns the cached vault for path, calling load if it isn't cached
+func (c *VaultCache) Load(path string, load func(string) (AttributeVault, error)) (AttributeVault, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.vaults[path]; ok {
+		return v, nil
+	}
+	v, err := load(path)
+	if err != nil {
+		return v, err
+	}
+	if c.vaults == nil {
+		c.vaults = make(map[string]AttributeVault)
+	}
+	c.vaults[path] = v
+	return v, nil
+}
+
+// Reset drops the cached vaults unless they were loaded for generation, returning true if they were dropped.
+// An empty generation means the source revision isn't known, so the vaults are always dropped.
+func (c *VaultCache) Reset(generation string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != "" && generation == c.generation {
+		return false
+	}
+	c.generation = generation
+	c.vaults = nil
+	return true
+}
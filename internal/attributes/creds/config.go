@@ -0,0 +1,68 @@
+package creds
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/knadh/koanf/v2"
+)
+
+type Config struct {
+	Directory string `toml:"directory"`
+	BaseDir   string `toml:"base_dir"`
+	Prefix    string `toml:"prefix"`
+	Command   string `toml:"command"`
+	User      bool   `toml:"user"`
+}
+
+func (c Config) Validate() error {
+	if c.Directory == "" && c.BaseDir == "" {
+		return errors.New("need a credentials directory or base directory for systemd credentials")
+	}
+	if c.BaseDir != "" && c.Command == "" {
+		return errors.New("need systemd-creds command to decrypt credentials")
+	}
+	return nil
+}
+
+func NewConfig(k *koanf.Koanf) (*Config, error) {
+	var c Config
+	c.Directory = k.String("creds.directory")
+	if c.Directory == "" {
+		c.Directory = os.Getenv("CREDENTIALS_DIRECTORY")
+	}
+	c.BaseDir = k.String("creds.base_dir")
+	c.Prefix = k.String("creds.prefix")
+	c.Command = k.String("creds.command")
+	if c.Command == "" {
+		c.Command = "systemd-creds"
+	}
+	c.User = k.Bool("creds.user")
+
+	return &c, nil
+}
+
+func (c *Config) Merge(other *Config) {
+	if other.Directory != "" {
+		c.Directory = other.Directory
+	}
+	if other.BaseDir != "" {
+		c.BaseDir = other.BaseDir
+	}
+	if other.Prefix != "" {
+		c.Prefix = other.Prefix
+	}
+	if other.Command != "" {
+		c.Command = other.Command
+	}
+	c.User = other.User
+}
+
+func (c Config) String() string {
+	return fmt.Sprintf("Credentials Directory: %v\nBase Path: %v\nPrefix: %v\nCommand: %v\nUser: %v\n", c.Directory, c.BaseDir, c.Prefix, c.Command, c.User)
+}
+
+func (c Config) SourceType() string {
+	return "creds"
+}
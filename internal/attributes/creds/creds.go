@@ -0,0 +1,292 @@
+package creds
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"charm.land/log/v2"
+	"primamateria.systems/materia/internal/attributes"
+)
+
+const encryptedSuffix = ".cred"
+
+// scope ranks, later scopes override earlier ones
+const (
+	scopeGlobal = iota
+	scopeRole
+	scopeComponent
+	scopeInstance
+	scopeHost
+)
+
+// credential is a single attribute, named <scope>.<target>.<attribute> e.g. "components.caddy.apiKey" or "globals.domain"
+type credential struct {
+	name      string
+	scope     int
+	target    string
+	attribute string
+	path      string
+	encrypted bool
+}
+
+// CredsStore reads attributes from systemd credentials, either passed to the service in $CREDENTIALS_DIRECTORY
+// or stored in the repository as systemd-creds encrypted blobs
+type CredsStore struct {
+	config    Config
+	sourceDir string
+
+	mu         sync.Mutex
+	creds      []credential
+	generation string
+	decrypted  map[string]string
+}
+
+func NewCredsStore(c Config, sourceDir string) (*CredsStore, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	s := &CredsStore{
+		config:    c,
+		sourceDir: sourceDir,
+		decrypted: make(map[string]string),
+	}
+	creds, err := s.scan()
+	if err != nil {
+		return nil, err
+	}
+	s.creds = creds
+	return s, nil
+}
+
+// Invalidate drops decrypted blobs and rescans the credentials when the source has changed
+func (s *CredsStore) Invalidate(generation string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if generation != "" && generation == s.generation {
+		return nil
+	}
+	creds, err := s.scan()
+	if err != nil {
+		return err
+	}
+	s.generation = generation
+	s.creds = creds
+	s.decrypted = make(map[string]string)
+	return nil
+}
+
+// scan lists the repository blobs and the host's credentials
+func (s *CredsStore) scan() ([]credential, error) {
+	var creds []credential
+	c := s.config
+	// repository blobs come first so credentials provisioned on the host win
+	if c.BaseDir != "" {
+		err := filepath.WalkDir(filepath.Join(s.sourceDir, c.BaseDir), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !strings.HasSuffix(d.Name(), encryptedSuffix) {
+				return nil
+			}
+			creds = add(creds, strings.TrimSuffix(d.Name(), encryptedSuffix), c.Prefix, path, true)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("can't load encrypted credentials: %w", err)
+		}
+	}
+	if c.Directory != "" {
+		entries, err := os.ReadDir(c.Directory)
+		if err != nil {
+			return nil, fmt.Errorf("can't read credentials directory: %w", err)
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			creds = add(creds, e.Name(), c.Prefix, filepath.Join(c.Directory, e.Name()), false)
+		}
+	}
+	return creds, nil
+}
+
+func add(creds []credential, name, prefix, path string, encrypted bool) []credential {
+	cred, ok := parseName(name, prefix)
+	if !ok {
+		log.Debug("skipping credential that isn't an attribute", "name", name)
+		return creds
+	}
+	cred.path = path
+	cred.encrypted = encrypted
+	return append(creds, cred)
+}
+
+// parseName splits a credential name into its scope, target and attribute.
+// The attribute is everything after the last dot so host names can contain dots.
+func parseName(name, prefix string) (credential, bool) {
+	rest, ok := strings.CutPrefix(name, prefix)
+	if !ok {
+		return credential{}, false
+	}
+	kind, rest, ok := strings.Cut(rest, ".")
+	if !ok {
+		return credential{}, false
+	}
+	cred := credential{name: name}
+	if kind == "globals" {
+		if rest == "" || strings.Contains(rest, ".") {
+			return credential{}, false
+		}
+		cred.scope = scopeGlobal
+		cred.attribute = rest
+		return cred, true
+	}
+	i := strings.LastIndex(rest, ".")
+	if i <= 0 || i == len(rest)-1 {
+		return credential{}, false
+	}
+	cred.target, cred.attribute = rest[:i], rest[i+1:]
+	switch kind {
+	case "roles":
+		cred.scope = scopeRole
+	case "components":
+		cred.scope = scopeComponent
+		if strings.Contains(cred.target, "@") {
+			cred.scope = scopeInstance
+		}
+	case "hosts":
+		cred.scope = scopeHost
+	default:
+		return credential{}, false
+	}
+	return cred, true
+}
+
+// rank orders a credential for a filter, returning false if it doesn't apply
+func (c credential) rank(f attributes.AttributesFilter) (int, bool) {
+	switch c.scope {
+	case scopeGlobal:
+		return 0, true
+	case scopeRole:
+		i := slices.Index(f.Roles, c.target)
+		return i, i >= 0
+	case scopeComponent:
+		return 0, f.Component != "" && c.target == f.Component
+	case scopeInstance:
+		return 0, f.Component != "" && f.Instance != "" && c.target == fmt.Sprintf("%v@%v", f.Component, f.Instance)
+	case scopeHost:
+		return 0, f.Hostname != "" && c.target == f.Hostname
+	}
+	return 0, false
+}
+
+func (s *CredsStore) Lookup(ctx context.Context, f attributes.AttributesFilter) (map[string]any, error) {
+	t, err := s.Trace(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return t.Resolved(), nil
+}
+
+func (s *CredsStore) Trace(ctx context.Context, f attributes.AttributesFilter) (attributes.Trace, error) {
+	type match struct {
+		cred credential
+		rank int
+	}
+	s.mu.Lock()
+	creds := s.creds
+	s.mu.Unlock()
+	var matches []match
+	for _, c := range creds {
+		if r, ok := c.rank(f); ok {
+			matches = append(matches, match{c, r})
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b match) int {
+		if a.cred.scope != b.cred.scope {
+			return a.cred.scope - b.cred.scope
+		}
+		return a.rank - b.rank
+	})
+
+	// shadowed blobs aren't decrypted, so their value is left unset
+	winners := make(map[string]int)
+	for i, m := range matches {
+		winners[m.cred.attribute] = i
+	}
+	results := make(attributes.Trace)
+	for i, m := range matches {
+		p := attributes.Provenance{Engine: "creds", Source: m.cred.path, Layer: m.cred.layer(), Secret: true}
+		if !m.cred.encrypted || winners[m.cred.attribute] == i {
+			value, err := s.value(ctx, m.cred)
+			if err != nil {
+				return nil, err
+			}
+			p.Value = value
+		}
+		results.Add(m.cred.attribute, p)
+	}
+	return results, nil
+}
+
+func (c credential) layer() string {
+	switch c.scope {
+	case scopeRole:
+		return fmt.Sprintf("role %v", c.target)
+	case scopeComponent:
+		return fmt.Sprintf("component %v", c.target)
+	case scopeInstance:
+		return fmt.Sprintf("instance %v", c.target)
+	case scopeHost:
+		return fmt.Sprintf("host %v", c.target)
+	}
+	return "global"
+}
+
+func (s *CredsStore) value(ctx context.Context, c credential) (string, error) {
+	if !c.encrypted {
+		data, err := os.ReadFile(c.path)
+		if err != nil {
+			return "", fmt.Errorf("can't read credential %v: %w", c.name, err)
+		}
+		return trimNewline(data), nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.decrypted[c.path]; ok {
+		return v, nil
+	}
+	args := []string{"decrypt", fmt.Sprintf("--name=%v", c.name), c.path, "-"}
+	if s.config.User {
+		args = append([]string{"--user"}, args...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.config.Command, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("can't decrypt credential %v: %v", c.name, strings.TrimSpace(stderr.String()))
+		}
+		return "", fmt.Errorf("can't decrypt credential %v: %w", c.name, err)
+	}
+	v := trimNewline(stdout.Bytes())
+	s.decrypted[c.path] = v
+	return v, nil
+}
+
+// trimNewline drops the trailing newline most tools add when writing a secret
+func trimNewline(data []byte) string {
+	v := strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(v, "\r")
+}
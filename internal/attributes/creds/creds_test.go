@@ -0,0 +1,152 @@
+package creds
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"primamateria.systems/materia/internal/attributes"
+)
+
+func Test_parseName(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		want   credential
+		ok     bool
+	}{
+		{name: "globals.domain", want: credential{scope: scopeGlobal, attribute: "domain"}, ok: true},
+		{name: "roles.web.port", want: credential{scope: scopeRole, target: "web", attribute: "port"}, ok: true},
+		{name: "components.caddy.apiKey", want: credential{scope: scopeComponent, target: "caddy", attribute: "apiKey"}, ok: true},
+		{name: "components.caddy@public.apiKey", want: credential{scope: scopeInstance, target: "caddy@public", attribute: "apiKey"}, ok: true},
+		{name: "hosts.web01.example.com.ip", want: credential{scope: scopeHost, target: "web01.example.com", attribute: "ip"}, ok: true},
+		{name: "materia.globals.domain", prefix: "materia.", want: credential{scope: scopeGlobal, attribute: "domain"}, ok: true},
+		{name: "globals.domain", prefix: "materia."},
+		{name: "globals.a.b"},
+		{name: "globals"},
+		{name: "roles.web"},
+		{name: "roles.web."},
+		{name: "volumes.data.size"},
+		{name: "tls-cert"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseName(tt.name, tt.prefix)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				tt.want.name = tt.name
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCredsStore_Lookup(t *testing.T) {
+	credsDir := t.TempDir()
+	for name, value := range map[string]string{
+		"globals.domain":                 "example.com\n",
+		"globals.image":                  "nginx:latest",
+		"roles.web.port":                 "8080",
+		"roles.edge.port":                "80",
+		"components.nginx.image":         "nginx:1.27",
+		"components.nginx@public.port":   "443",
+		"hosts.web01.example.com.domain": "web01.example.com",
+		"tls-cert":                       "not an attribute",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(credsDir, name), []byte(value), 0o600))
+	}
+	store, err := NewCredsStore(Config{Directory: credsDir}, t.TempDir())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		filter attributes.AttributesFilter
+		want   map[string]any
+	}{
+		{
+			name:   "globals",
+			filter: attributes.AttributesFilter{},
+			want:   map[string]any{"domain": "example.com", "image": "nginx:latest"},
+		},
+		{
+			name:   "later roles win",
+			filter: attributes.AttributesFilter{Roles: []string{"web", "edge"}},
+			want:   map[string]any{"domain": "example.com", "image": "nginx:latest", "port": "80"},
+		},
+		{
+			name:   "instance overrides component and roles",
+			filter: attributes.AttributesFilter{Roles: []string{"web"}, Component: "nginx", Instance: "public"},
+			want:   map[string]any{"domain": "example.com", "image": "nginx:1.27", "port": "443"},
+		},
+		{
+			name:   "host overrides everything",
+			filter: attributes.AttributesFilter{Hostname: "web01.example.com", Component: "nginx"},
+			want:   map[string]any{"domain": "web01.example.com", "image": "nginx:1.27"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.Lookup(context.Background(), tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCredsStore_Encrypted(t *testing.T) {
+	sourceDir := t.TempDir()
+	blobs := filepath.Join(sourceDir, "secrets", "creds")
+	require.NoError(t, os.MkdirAll(blobs, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(blobs, "globals.domain.cred"), []byte("repo.example.com"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(blobs, "globals.token.cred"), []byte("repo-token"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(blobs, "README.md"), []byte("ignored"), 0o600))
+
+	// stand in for systemd-creds: check the arguments and "decrypt" by echoing the blob
+	bin := t.TempDir()
+	log := filepath.Join(bin, "calls")
+	script := `#!/bin/sh
+[ "$1" = "decrypt" ] || exit 1
+echo "$2" >> ` + log + `
+cat "$3"
+echo
+`
+	fake := filepath.Join(bin, "systemd-creds")
+	require.NoError(t, os.WriteFile(fake, []byte(script), 0o755))
+
+	credsDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(credsDir, "globals.token"), []byte("host-token"), 0o600))
+
+	store, err := NewCredsStore(Config{Directory: credsDir, BaseDir: "secrets/creds", Command: fake}, sourceDir)
+	require.NoError(t, err)
+	for range 2 {
+		got, err := store.Lookup(context.Background(), attributes.AttributesFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"domain": "repo.example.com", "token": "host-token"}, got)
+	}
+	calls, err := os.ReadFile(log)
+	require.NoError(t, err)
+	assert.Equal(t, "--name=globals.domain\n", string(calls), "blobs should only be decrypted once, and not at all when shadowed")
+
+	// a new source generation picks up changed and added blobs
+	require.NoError(t, os.WriteFile(filepath.Join(blobs, "globals.domain.cred"), []byte("new.example.com"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(blobs, "globals.region.cred"), []byte("eu"), 0o600))
+	require.NoError(t, store.Invalidate("first"))
+	got, err := store.Lookup(context.Background(), attributes.AttributesFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"domain": "new.example.com", "region": "eu", "token": "host-token"}, got)
+	require.NoError(t, os.WriteFile(filepath.Join(blobs, "globals.domain.cred"), []byte("ignored.example.com"), 0o600))
+	require.NoError(t, store.Invalidate("first"))
+	got, err = store.Lookup(context.Background(), attributes.AttributesFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, "new.example.com", got["domain"], "the same generation should keep the decrypted blobs")
+
+	failing := filepath.Join(bin, "failing")
+	require.NoError(t, os.WriteFile(failing, []byte("#!/bin/sh\necho 'no TPM2 device' >&2\nexit 1\n"), 0o755))
+	store, err = NewCredsStore(Config{BaseDir: "secrets/creds", Command: failing}, sourceDir)
+	require.NoError(t, err)
+	_, err = store.Lookup(context.Background(), attributes.AttributesFilter{})
+	assert.ErrorContains(t, err, "no TPM2 device")
+}
@@ -0,0 +1,72 @@
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/knadh/koanf/v2"
+)
+
+type Config struct {
+	Command  string        `toml:"command"`
+	Args     []string      `toml:"args"`
+	Timeout  time.Duration `toml:"timeout"`
+	CacheTTL time.Duration `toml:"cache_ttl"`
+}
+
+func (c Config) Validate() error {
+	if c.Command == "" {
+		return errors.New("need command for exec attributes")
+	}
+	if c.Timeout <= 0 {
+		return errors.New("exec attributes timeout must be positive")
+	}
+	if c.CacheTTL < 0 {
+		return errors.New("exec attributes cache TTL can't be negative")
+	}
+	return nil
+}
+
+func NewConfig(k *koanf.Koanf) (*Config, error) {
+	var c Config
+	var err error
+	c.Command = k.String("exec.command")
+	c.Args = k.Strings("exec.args")
+	c.Timeout = time.Second * 30
+	if k.Exists("exec.timeout") {
+		c.Timeout, err = time.ParseDuration(k.String("exec.timeout"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid exec attributes timeout: %w", err)
+		}
+	}
+	if k.Exists("exec.cache_ttl") {
+		c.CacheTTL, err = time.ParseDuration(k.String("exec.cache_ttl"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid exec attributes cache TTL: %w", err)
+		}
+	}
+
+	return &c, nil
+}
+
+func (c *Config) Merge(other *Config) {
+	if other.Command != "" {
+		c.Command = other.Command
+		c.Args = other.Args
+	}
+	if other.Timeout != 0 {
+		c.Timeout = other.Timeout
+	}
+	if other.CacheTTL != 0 {
+		c.CacheTTL = other.CacheTTL
+	}
+}
+
+func (c Config) String() string {
+	return fmt.Sprintf("Command: %v\nArgs: %v\nTimeout: %v\nCache TTL: %v\n", c.Command, c.Args, c.Timeout, c.CacheTTL)
+}
+
+func (c Config) SourceType() string {
+	return "exec"
+}
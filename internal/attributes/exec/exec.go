@@ -0,0 +1,116 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"primamateria.systems/materia/internal/attributes"
+)
+
+type cacheEntry struct {
+	attrs   map[string]any
+	expires time.Time
+}
+
+// ExecStore gets attributes from an external program. The program is given the attributes filter as JSON on stdin
+// and prints a JSON object of attributes on stdout.
+type ExecStore struct {
+	command  string
+	args     []string
+	timeout  time.Duration
+	cacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+func NewExecStore(c Config) (*ExecStore, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &ExecStore{
+		command:  c.Command,
+		args:     c.Args,
+		timeout:  c.Timeout,
+		cacheTTL: c.CacheTTL,
+		cache:    make(map[string]cacheEntry),
+	}, nil
+}
+
+func (s *ExecStore) Lookup(ctx context.Context, f attributes.AttributesFilter) (map[string]any, error) {
+	t, err := s.Trace(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return t.Resolved(), nil
+}
+
+func (s *ExecStore) Trace(ctx context.Context, f attributes.AttributesFilter) (attributes.Trace, error) {
+	input, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := s.cached(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	t := make(attributes.Trace)
+	t.AddAll(attrs, attributes.Provenance{Engine: "exec", Source: s.command, Layer: "command", Secret: true})
+	return t, nil
+}
+
+// cached returns the program's output for input, running it if there's no unexpired result
+func (s *ExecStore) cached(ctx context.Context, input []byte) (map[string]any, error) {
+	key := string(input)
+	if s.cacheTTL > 0 {
+		s.mu.Lock()
+		entry, ok := s.cache[key]
+		s.mu.Unlock()
+		if ok && time.Now().Before(entry.expires) {
+			return entry.attrs, nil
+		}
+	}
+	attrs, err := s.run(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if s.cacheTTL > 0 {
+		s.mu.Lock()
+		s.cache[key] = cacheEntry{attrs: attrs, expires: time.Now().Add(s.cacheTTL)}
+		s.mu.Unlock()
+	}
+	return attrs, nil
+}
+
+func (s *ExecStore) run(ctx context.Context, input []byte) (map[string]any, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.command, s.args...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// don't wait on grandchildren holding stdout open once the command is killed
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("attributes command %v timed out after %v", s.command, s.timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("attributes command %v failed: %w: %v", s.command, err, msg)
+		}
+		return nil, fmt.Errorf("attributes command %v failed: %w", s.command, err)
+	}
+	var attrs map[string]any
+	if err := json.Unmarshal(stdout.Bytes(), &attrs); err != nil {
+		return nil, fmt.Errorf("invalid output from attributes command %v: %w", s.command, err)
+	}
+	return attrs, nil
+}
@@ -0,0 +1,93 @@
+package exec
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"primamateria.systems/materia/internal/attributes"
+)
+
+// writeScript writes an attributes program that records its stdin and how often it ran
+func writeScript(t *testing.T, body string) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	script := filepath.Join(dir, "attrs.sh")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\ncat > "+dir+"/input\necho run >> "+dir+"/runs\n"+body+"\n"), 0o755))
+	return script, dir
+}
+
+func runs(t *testing.T, dir string) int {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "runs"))
+	require.NoError(t, err)
+	return strings.Count(string(data), "run")
+}
+
+func TestExecStore_Lookup(t *testing.T) {
+	script, dir := writeScript(t, `echo '{"domain": "example.com", "db": {"port": 5432}}'`)
+	s, err := NewExecStore(Config{Command: script, Timeout: time.Second * 5})
+	require.NoError(t, err)
+
+	filter := attributes.AttributesFilter{Hostname: "web01", Roles: []string{"web"}, Component: "nginx", Instance: "public"}
+	attrs, err := s.Lookup(context.Background(), filter)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"domain": "example.com", "db": map[string]any{"port": float64(5432)}}, attrs)
+
+	input, err := os.ReadFile(filepath.Join(dir, "input"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"hostname": "web01", "roles": ["web"], "component": "nginx", "instance": "public"}`, string(input))
+
+	trace, err := s.Trace(context.Background(), filter)
+	require.NoError(t, err)
+	assert.Equal(t, []attributes.Provenance{{Engine: "exec", Source: script, Layer: "command", Secret: true, Value: "example.com"}}, trace["domain"])
+}
+
+func TestExecStore_Cache(t *testing.T) {
+	script, dir := writeScript(t, `echo '{"domain": "example.com"}'`)
+	ctx := context.Background()
+
+	uncached, err := NewExecStore(Config{Command: script, Timeout: time.Second * 5})
+	require.NoError(t, err)
+	for range 2 {
+		_, err = uncached.Lookup(ctx, attributes.AttributesFilter{Hostname: "web01"})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, runs(t, dir))
+
+	cached, err := NewExecStore(Config{Command: script, Timeout: time.Second * 5, CacheTTL: time.Minute})
+	require.NoError(t, err)
+	for range 2 {
+		_, err = cached.Lookup(ctx, attributes.AttributesFilter{Hostname: "web01"})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, runs(t, dir), "cached lookups shouldn't rerun the command")
+	_, err = cached.Lookup(ctx, attributes.AttributesFilter{Hostname: "web01", Component: "nginx"})
+	require.NoError(t, err)
+	assert.Equal(t, 4, runs(t, dir), "a different filter should run the command")
+}
+
+func TestExecStore_Errors(t *testing.T) {
+	tests := []struct {
+		name, body, want string
+	}{
+		{name: "exit status", body: "echo 'no such host' >&2; exit 1", want: "no such host"},
+		{name: "invalid output", body: "echo 'domain=example.com'", want: "invalid output"},
+		{name: "timeout", body: "sleep 5", want: "timed out"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, _ := writeScript(t, tt.body)
+			s, err := NewExecStore(Config{Command: script, Timeout: time.Millisecond * 200})
+			require.NoError(t, err)
+			_, err = s.Lookup(context.Background(), attributes.AttributesFilter{})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
@@ -29,7 +29,7 @@ func NewConfig(k *koanf.Koanf) (*Config, error) {
 	c.GeneralVaults = k.Strings("file.vaults")
 	c.LoadAllVaults = k.Bool("file.load_all_vaults")
 	if len(c.GeneralVaults) == 0 {
-		c.GeneralVaults = []string{"vault.toml"}
+		c.GeneralVaults = []string{"vault.toml", "vault.yml", "vault.yaml", "vault.json"}
 	}
 
 	return &c, nil
@@ -1,14 +1,13 @@
 package file
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 
-	"github.com/BurntSushi/toml"
+	"charm.land/log/v2"
 	"primamateria.systems/materia/internal/attributes"
 )
 
@@ -32,7 +31,7 @@ func NewFileStore(c Config, sourceDir string) (*FileStore, error) {
 		if d.Name() == ".git" || d.Name() == "MANIFEST.toml" {
 			return nil
 		}
-		if filepath.Ext(path) == ".toml" {
+		if attributes.VaultFormat(path) != "" {
 			f.vaultfiles = append(f.vaultfiles, path)
 		}
 		return nil
@@ -41,7 +40,7 @@ func NewFileStore(c Config, sourceDir string) (*FileStore, error) {
 		return nil, err
 	}
 	if len(c.GeneralVaults) == 0 {
-		c.GeneralVaults = []string{"vault.toml", "attributes.toml"}
+		c.GeneralVaults = []string{"vault.toml", "attributes.toml", "vault.yml", "vault.yaml", "vault.json"}
 	}
 	f.generalVaults = c.GeneralVaults
 	f.loadAllVaults = c.LoadAllVaults
@@ -49,9 +48,15 @@ func NewFileStore(c Config, sourceDir string) (*FileStore, error) {
 }
 
 func (s *FileStore) Lookup(ctx context.Context, f attributes.AttributesFilter) (map[string]any, error) {
-	attrs := attributes.AttributeVault{}
+	t, err := s.Trace(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return t.Resolved(), nil
+}
 
-	results := make(map[string]any)
+func (s *FileStore) Trace(ctx context.Context, f attributes.AttributesFilter) (attributes.Trace, error) {
+	results := make(attributes.Trace)
 	var files []string
 	var err error
 	if s.loadAllVaults {
@@ -69,20 +74,21 @@ func (s *FileStore) Lookup(ctx context.Context, f attributes.AttributesFilter) (
 			return nil, ctx.Err()
 		default:
 		}
-		file, err := os.Open(v)
+		data, err := os.ReadFile(v)
 		if err != nil {
 			return nil, err
 		}
-		buf := new(bytes.Buffer)
-		_, err = buf.ReadFrom(file)
-		if err != nil {
-			return nil, err
+		format := attributes.VaultFormat(v)
+		// sops vaults can share the directory, their ciphertext would override the values the sops engine decrypts
+		if attributes.IsSopsVault(format, data) {
+			log.Debug("skipping sops vault", "file", v)
+			continue
 		}
-		err = toml.Unmarshal(buf.Bytes(), &attrs)
+		attrs, err := attributes.DecodeVault(format, data)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%v: %w", v, err)
 		}
-		attributes.ExtractVaultAttributes(results, attrs, f)
+		attributes.TraceVaultAttributes(results, attrs, f, attributes.Provenance{Engine: "file", Source: v})
 
 	}
 	return results, nil
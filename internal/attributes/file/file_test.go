@@ -0,0 +1,44 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"primamateria.systems/materia/internal/attributes"
+)
+
+// sopsVault is what sops writes for a YAML vault, values are ciphertext until the sops engine decrypts them
+const sopsVault = `globals:
+    password: ENC[AES256_GCM,data:3q2+7w==,iv:AAAAAAAAAAAAAAAAAAAAAA==,tag:AAAAAAAAAAAAAAAAAAAAAA==,type:str]
+hosts:
+    web01:
+        port: ENC[AES256_GCM,data:ODA=,iv:AAAAAAAAAAAAAAAAAAAAAA==,tag:AAAAAAAAAAAAAAAAAAAAAA==,type:int]
+sops:
+    age:
+        - recipient: age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+    lastmodified: "2026-01-01T00:00:00Z"
+    version: 3.9.0
+`
+
+func TestFileStore_SopsVaults(t *testing.T) {
+	sourceDir := t.TempDir()
+	secrets := filepath.Join(sourceDir, "secrets")
+	require.NoError(t, os.MkdirAll(secrets, 0o755))
+	// the file and sops engines both default to the secrets directory
+	require.NoError(t, os.WriteFile(filepath.Join(secrets, "vault.toml"), []byte("[globals]\ndomain = \"example.com\"\npassword = \"changeme\"\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(secrets, "vault.yml"), []byte(sopsVault), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(secrets, "web01.json"), []byte(`{"hosts": {"web01": {"port": "ENC[AES256_GCM,data:ODA=,type:int]"}}, "sops": {"version": "3.9.0"}}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(secrets, "web01.yml"), []byte("hosts:\n  web01:\n    name: web01\n"), 0o644))
+
+	for _, loadAll := range []bool{false, true} {
+		f, err := NewFileStore(Config{BaseDir: "secrets", GeneralVaults: []string{"vault.toml", "vault.yml"}, LoadAllVaults: loadAll}, sourceDir)
+		require.NoError(t, err)
+		attrs, err := f.Lookup(context.Background(), attributes.AttributesFilter{Hostname: "web01"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"domain": "example.com", "password": "changeme", "name": "web01"}, attrs)
+	}
+}
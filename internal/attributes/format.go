@@ -0,0 +1,98 @@
+package attributes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FormatTOML = "toml"
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// VaultFormat returns the format of a plaintext vault file from its extension, or "" if it isn't a vault
+func VaultFormat(path string) string {
+	switch filepath.Ext(path) {
+	case ".toml":
+		return FormatTOML
+	case ".yml", ".yaml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	}
+	return ""
+}
+
+// EncryptedVaultFormat returns the format of an encrypted vault from its inner extension, e.g. vault.yml.age is YAML.
+// Vaults without an inner extension are TOML.
+func EncryptedVaultFormat(path string) string {
+	if format := VaultFormat(strings.TrimSuffix(path, filepath.Ext(path))); format != "" {
+		return format
+	}
+	return FormatTOML
+}
+
+func DecodeVault(format string, data []byte) (AttributeVault, error) {
+	var v AttributeVault
+	var err error
+	switch format {
+	case FormatTOML:
+		_, err = toml.Decode(string(data), &v)
+	case FormatYAML:
+		err = yaml.Unmarshal(data, &v)
+	case FormatJSON:
+		err = json.Unmarshal(data, &v)
+	default:
+		return v, fmt.Errorf("unsupported vault format %q", format)
+	}
+	if err != nil {
+		return v, fmt.Errorf("invalid %v attributes vault: %w", format, err)
+	}
+	return v, nil
+}
+
+// IsSopsVault reports whether a vault carries sops metadata, i.e. it's encrypted and only readable by the sops engine
+func IsSopsVault(format string, data []byte) bool {
+	var v struct {
+		Sops any `toml:"sops" yaml:"sops" json:"sops"`
+	}
+	var err error
+	switch format {
+	case FormatTOML:
+		_, err = toml.Decode(string(data), &v)
+	case FormatYAML:
+		err = yaml.Unmarshal(data, &v)
+	case FormatJSON:
+		err = json.Unmarshal(data, &v)
+	default:
+		return false
+	}
+	return err == nil && v.Sops != nil
+}
+
+func EncodeVault(format string, v AttributeVault) ([]byte, error) {
+	switch format {
+	case FormatTOML:
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case FormatYAML:
+		return yaml.Marshal(v)
+	case FormatJSON:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+	return nil, fmt.Errorf("unsupported vault format %q", format)
+}
@@ -0,0 +1,60 @@
+package attributes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_VaultFormat(t *testing.T) {
+	assert.Equal(t, FormatTOML, VaultFormat("secrets/vault.toml"))
+	assert.Equal(t, FormatYAML, VaultFormat("secrets/group_vars.yml"))
+	assert.Equal(t, FormatYAML, VaultFormat("secrets/web01.yaml"))
+	assert.Equal(t, FormatJSON, VaultFormat("secrets/vault.json"))
+	assert.Equal(t, "", VaultFormat("secrets/recipients"))
+
+	assert.Equal(t, FormatTOML, EncryptedVaultFormat("secrets/vault.age"))
+	assert.Equal(t, FormatTOML, EncryptedVaultFormat("secrets/web01.example.com.age"))
+	assert.Equal(t, FormatYAML, EncryptedVaultFormat("secrets/vault.yml.age"))
+	assert.Equal(t, FormatJSON, EncryptedVaultFormat("secrets/vault.json.age"))
+}
+
+func Test_DecodeVault(t *testing.T) {
+	want := AttributeVault{
+		Globals:    map[string]any{"domain": "example.com", "db": map[string]any{"host": "db.example.com"}},
+		Components: map[string]map[string]any{"caddy": {"image": "caddy"}},
+	}
+	tests := []struct {
+		format, data string
+	}{
+		{FormatTOML, "[globals]\ndomain = \"example.com\"\n[globals.db]\nhost = \"db.example.com\"\n[components.caddy]\nimage = \"caddy\"\n"},
+		{FormatYAML, "globals:\n  domain: example.com\n  db:\n    host: db.example.com\ncomponents:\n  caddy:\n    image: caddy\n"},
+		{FormatJSON, `{"globals": {"domain": "example.com", "db": {"host": "db.example.com"}}, "components": {"caddy": {"image": "caddy"}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, err := DecodeVault(tt.format, []byte(tt.data))
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+
+			encoded, err := EncodeVault(tt.format, got)
+			require.NoError(t, err)
+			roundtrip, err := DecodeVault(tt.format, encoded)
+			require.NoError(t, err)
+			assert.Equal(t, want, roundtrip)
+		})
+	}
+	_, err := DecodeVault(FormatYAML, []byte("globals: ["))
+	assert.Error(t, err)
+	_, err = DecodeVault("ini", []byte(""))
+	assert.Error(t, err)
+}
+
+func Test_IsSopsVault(t *testing.T) {
+	assert.True(t, IsSopsVault(FormatYAML, []byte("globals:\n  key: ENC[AES256_GCM,data:AA==,type:str]\nsops:\n  version: 3.9.0\n")))
+	assert.True(t, IsSopsVault(FormatJSON, []byte(`{"globals": {}, "sops": {"version": "3.9.0"}}`)))
+	assert.False(t, IsSopsVault(FormatYAML, []byte("globals:\n  sops: true\n")))
+	assert.False(t, IsSopsVault(FormatTOML, []byte("[globals]\nkey = \"value\"\n")))
+	assert.False(t, IsSopsVault(FormatJSON, []byte("not json")))
+}
@@ -3,60 +3,28 @@ package attributes
 import (
 	"context"
 	"fmt"
-	"maps"
 	"path/filepath"
 	"slices"
 	"strings"
 )
 
 type AttributesFilter struct {
-	Hostname  string
-	Roles     []string
-	Component string
-	Instance  string
+	Hostname  string   `json:"hostname"`
+	Roles     []string `json:"roles"`
+	Component string   `json:"component"`
+	Instance  string   `json:"instance"`
 }
 
 type AttributeVault struct {
-	Globals    map[string]any            `toml:"globals" yaml:"globals" json:"globals" ini:"globals"`
-	Components map[string]map[string]any `toml:"components" yaml:"components" json:"components" ini:"components"`
-	Hosts      map[string]map[string]any `toml:"hosts" yaml:"hosts" json:"hosts" ini:"hosts"`
-	Roles      map[string]map[string]any `toml:"roles" yaml:"roles" json:"roles" ini:"roles"`
+	Globals    map[string]any            `toml:"globals" yaml:"globals,omitempty" json:"globals,omitempty" ini:"globals"`
+	Components map[string]map[string]any `toml:"components" yaml:"components,omitempty" json:"components,omitempty" ini:"components"`
+	Hosts      map[string]map[string]any `toml:"hosts" yaml:"hosts,omitempty" json:"hosts,omitempty" ini:"hosts"`
+	Roles      map[string]map[string]any `toml:"roles" yaml:"roles,omitempty" json:"roles,omitempty" ini:"roles"`
 }
 
+// MergeAttributes shallow merges lower into higher, see MergeStrategy.Merge
 func MergeAttributes(higher map[string]any, lower map[string]any) map[string]any {
-	for k, v := range lower {
-		if _, ok := higher[k]; !ok {
-			higher[k] = v
-		}
-	}
-	return higher
-}
-
-func ExtractVaultAttributes(results map[string]any, vault AttributeVault, filter AttributesFilter) {
-	maps.Copy(results, vault.Globals)
-
-	for _, role := range filter.Roles {
-		if attrs, ok := vault.Roles[role]; ok {
-			maps.Copy(results, attrs)
-		}
-	}
-
-	if filter.Component != "" {
-		if attrs, ok := vault.Components[filter.Component]; ok {
-			maps.Copy(results, attrs)
-		}
-		if filter.Instance != "" {
-			if attrs, ok := vault.Components[fmt.Sprintf("%v@%v", filter.Component, filter.Instance)]; ok {
-				maps.Copy(results, attrs)
-			}
-		}
-	}
-
-	if filter.Hostname != "" {
-		if attrs, ok := vault.Hosts[filter.Hostname]; ok {
-			maps.Copy(results, attrs)
-		}
-	}
+	return MergeStrategy{}.Merge(higher, lower)
 }
 
 func SortedVaultFiles(ctx context.Context, f AttributesFilter, vaultfiles, generalVaults []string) ([]string, error) {
@@ -95,3 +63,57 @@ func SortedVaultFiles(ctx context.Context, f AttributesFilter, vaultfiles, gener
 	files = append(files, hostFiles...)
 	return files, nil
 }
+
+// ParseScope splits a vault table name like "globals", "hosts.web01" or "components.caddy@public" into its table and entry.
+// Only the first dot separates them so host names can contain dots.
+func ParseScope(scope string) (table, name string, err error) {
+	table, name, _ = strings.Cut(scope, ".")
+	switch table {
+	case "globals":
+		if name != "" {
+			return "", "", fmt.Errorf("globals scope can't have a name: %v", scope)
+		}
+	case "hosts", "roles", "components":
+		if name == "" {
+			return "", "", fmt.Errorf("%v scope needs a name, e.g. %v.example", table, table)
+		}
+	default:
+		return "", "", fmt.Errorf("invalid scope %q: must be globals, hosts.<host>, roles.<role> or components.<component>", scope)
+	}
+	return table, name, nil
+}
+
+// Set sets key in the table scope names, creating the table if needed
+func (v *AttributeVault) Set(scope, key string, value any) error {
+	if key == "" {
+		return fmt.Errorf("need attribute name")
+	}
+	table, name, err := ParseScope(scope)
+	if err != nil {
+		return err
+	}
+	if table == "globals" {
+		if v.Globals == nil {
+			v.Globals = make(map[string]any)
+		}
+		v.Globals[key] = value
+		return nil
+	}
+	var tables *map[string]map[string]any
+	switch table {
+	case "hosts":
+		tables = &v.Hosts
+	case "roles":
+		tables = &v.Roles
+	case "components":
+		tables = &v.Components
+	}
+	if *tables == nil {
+		*tables = make(map[string]map[string]any)
+	}
+	if (*tables)[name] == nil {
+		(*tables)[name] = make(map[string]any)
+	}
+	(*tables)[name][key] = value
+	return nil
+}
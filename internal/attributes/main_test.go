@@ -2,14 +2,13 @@ package attributes
 
 import (
 	"context"
-	"maps"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func Test_ExtractVaultAttributes(t *testing.T) {
+func Test_ResolveVaultAttributes(t *testing.T) {
 	tests := []struct {
 		name   string
 		start  map[string]any
@@ -156,9 +155,10 @@ func Test_ExtractVaultAttributes(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			input := maps.Clone(tt.start)
-			ExtractVaultAttributes(input, tt.input, tt.filter)
-			assert.Equal(t, input, tt.want)
+			trace := make(Trace)
+			trace.AddAll(tt.start, Provenance{Engine: "test"})
+			TraceVaultAttributes(trace, tt.input, tt.filter, Provenance{Engine: "test"})
+			assert.Equal(t, tt.want, trace.Resolved())
 		})
 	}
 }
@@ -358,3 +358,41 @@ func Test_SortedVaultFiles(t *testing.T) {
 		})
 	}
 }
+
+func Test_MergeNamespaced(t *testing.T) {
+	defaults := map[string]any{"port": 80, "image": "nginx"}
+	tests := []struct {
+		name  string
+		attrs map[string]any
+		want  map[string]any
+	}{
+		{"missing", map[string]any{"a": 1}, map[string]any{"a": 1, "web": map[string]any{"port": 80, "image": "nginx"}}},
+		{"partial", map[string]any{"web": map[string]any{"port": 8080}}, map[string]any{"web": map[string]any{"port": 8080, "image": "nginx"}}},
+		{"not a table", map[string]any{"web": "custom"}, map[string]any{"web": "custom"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, MergeStrategy{}.MergeNamespaced(tt.attrs, "web", defaults))
+		})
+	}
+	assert.Equal(t, map[string]any{"port": 80, "image": "nginx"}, defaults, "defaults shouldn't be modified")
+}
+
+func Test_AttributeVaultSet(t *testing.T) {
+	var v AttributeVault
+	require.NoError(t, v.Set("globals", "domain", "example.com"))
+	require.NoError(t, v.Set("roles.web", "port", "80"))
+	require.NoError(t, v.Set("components.caddy@public", "image", "caddy"))
+	require.NoError(t, v.Set("hosts.web01.example.com", "ip", "192.168.1.10"))
+	assert.Equal(t, AttributeVault{
+		Globals:    map[string]any{"domain": "example.com"},
+		Roles:      map[string]map[string]any{"web": {"port": "80"}},
+		Components: map[string]map[string]any{"caddy@public": {"image": "caddy"}},
+		Hosts:      map[string]map[string]any{"web01.example.com": {"ip": "192.168.1.10"}},
+	}, v)
+
+	for _, scope := range []string{"global", "globals.extra", "roles", "roles.", "volumes.data"} {
+		assert.Error(t, v.Set(scope, "key", "value"), scope)
+	}
+	assert.Error(t, v.Set("globals", "", "value"))
+}
@@ -32,3 +32,9 @@ func (m *MemoryEngine) Lookup(_ context.Context, _ attributes.AttributesFilter)
 func (m *MemoryEngine) Add(key, value string) {
 	m.secrets[key] = value
 }
+
+func (m *MemoryEngine) Trace(_ context.Context, _ attributes.AttributesFilter) (attributes.Trace, error) {
+	t := make(attributes.Trace)
+	t.AddAll(m.secrets, attributes.Provenance{Engine: "memory", Layer: "global"})
+	return t, nil
+}
@@ -0,0 +1,128 @@
+package attributes
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+)
+
+// Unset removes a key set by a lower precedence layer, e.g. `port = "!unset"` in a host vault drops a role's port
+const Unset = "!unset"
+
+const (
+	ListsReplace = "replace"
+	ListsAppend  = "append"
+)
+
+// MergeStrategy controls how a higher precedence value is layered over a lower one.
+// Shallow merges replace top level keys outright, deep merges combine tables key by key.
+type MergeStrategy struct {
+	Deep bool
+	// Lists is ListsReplace or ListsAppend, only used by deep merges
+	Lists string
+}
+
+func NewMergeStrategy(strategy, lists string) (MergeStrategy, error) {
+	var s MergeStrategy
+	switch strategy {
+	case "", "shallow":
+	case "deep":
+		s.Deep = true
+	default:
+		return s, fmt.Errorf("invalid attributes merge strategy %q: must be shallow or deep", strategy)
+	}
+	switch lists {
+	case "", ListsReplace:
+		s.Lists = ListsReplace
+	case ListsAppend:
+		s.Lists = ListsAppend
+	default:
+		return s, fmt.Errorf("invalid attributes list merge %q: must be replace or append", lists)
+	}
+	return s, nil
+}
+
+func (s MergeStrategy) String() string {
+	if !s.Deep {
+		return "shallow"
+	}
+	return fmt.Sprintf("deep (lists %v)", s.Lists)
+}
+
+// Override layers higher over lower. Lower is never modified.
+func (s MergeStrategy) Override(lower, higher any) any {
+	if !s.Deep {
+		return higher
+	}
+	switch h := higher.(type) {
+	case map[string]any:
+		l, _ := lower.(map[string]any)
+		return s.overrideTable(l, h)
+	case string, nil:
+		return higher
+	}
+	if s.Lists == ListsAppend {
+		l, h := reflect.ValueOf(lower), reflect.ValueOf(higher)
+		if l.Kind() == reflect.Slice && h.Kind() == reflect.Slice {
+			result := make([]any, 0, l.Len()+h.Len())
+			for i := range l.Len() {
+				result = append(result, l.Index(i).Interface())
+			}
+			for i := range h.Len() {
+				result = append(result, h.Index(i).Interface())
+			}
+			return result
+		}
+	}
+	return higher
+}
+
+func (s MergeStrategy) overrideTable(lower, higher map[string]any) map[string]any {
+	result := make(map[string]any, len(lower)+len(higher))
+	maps.Copy(result, lower)
+	for k, v := range higher {
+		if v == Unset {
+			delete(result, k)
+			continue
+		}
+		result[k] = s.Override(result[k], v)
+	}
+	return result
+}
+
+// Merge fills in keys from lower that higher doesn't set, combining values both set according to the strategy.
+// Keys higher marks as Unset are removed. Like MergeAttributes, higher is updated in place.
+func (s MergeStrategy) Merge(higher, lower map[string]any) map[string]any {
+	for k, lv := range lower {
+		hv, ok := higher[k]
+		if !ok {
+			higher[k] = lv
+			continue
+		}
+		if hv != Unset {
+			higher[k] = s.Override(lv, hv)
+		}
+	}
+	for k, v := range higher {
+		if v == Unset {
+			delete(higher, k)
+		}
+	}
+	return higher
+}
+
+// MergeNamespaced adds defaults as a table under namespace. Keys already set in an existing table are kept,
+// and a namespace that's set to something other than a table is left alone.
+func (s MergeStrategy) MergeNamespaced(attrs map[string]any, namespace string, defaults map[string]any) map[string]any {
+	existing, ok := attrs[namespace]
+	if !ok {
+		attrs[namespace] = maps.Clone(defaults)
+		return attrs
+	}
+	table, ok := existing.(map[string]any)
+	if !ok {
+		return attrs
+	}
+	attrs[namespace] = s.Merge(maps.Clone(table), defaults)
+	return attrs
+}
@@ -0,0 +1,138 @@
+package attributes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NewMergeStrategy(t *testing.T) {
+	tests := []struct {
+		name, strategy, lists string
+		want                  MergeStrategy
+		wantErr               bool
+	}{
+		{name: "defaults", want: MergeStrategy{Lists: ListsReplace}},
+		{name: "shallow", strategy: "shallow", want: MergeStrategy{Lists: ListsReplace}},
+		{name: "deep append", strategy: "deep", lists: "append", want: MergeStrategy{Deep: true, Lists: ListsAppend}},
+		{name: "bad strategy", strategy: "recursive", wantErr: true},
+		{name: "bad lists", strategy: "deep", lists: "prepend", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewMergeStrategy(tt.strategy, tt.lists)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_MergeStrategyMerge(t *testing.T) {
+	lower := func() map[string]any {
+		return map[string]any{
+			"db": map[string]any{
+				"host":  "db.example.com",
+				"port":  5432,
+				"flags": map[string]any{"ssl": true, "debug": false},
+			},
+			"dns":    []any{"1.1.1.1"},
+			"domain": "example.com",
+		}
+	}
+	tests := []struct {
+		name     string
+		strategy MergeStrategy
+		higher   map[string]any
+		want     map[string]any
+	}{
+		{
+			name:     "shallow replaces tables",
+			strategy: MergeStrategy{},
+			higher:   map[string]any{"db": map[string]any{"port": 5433}},
+			want:     map[string]any{"db": map[string]any{"port": 5433}, "dns": []any{"1.1.1.1"}, "domain": "example.com"},
+		},
+		{
+			name:     "deep merges tables",
+			strategy: MergeStrategy{Deep: true, Lists: ListsReplace},
+			higher:   map[string]any{"db": map[string]any{"port": 5433, "flags": map[string]any{"debug": true}}},
+			want: map[string]any{
+				"db":     map[string]any{"host": "db.example.com", "port": 5433, "flags": map[string]any{"ssl": true, "debug": true}},
+				"dns":    []any{"1.1.1.1"},
+				"domain": "example.com",
+			},
+		},
+		{
+			name:     "deep replaces lists",
+			strategy: MergeStrategy{Deep: true, Lists: ListsReplace},
+			higher:   map[string]any{"dns": []any{"9.9.9.9"}},
+			want:     map[string]any{"db": lower()["db"], "dns": []any{"9.9.9.9"}, "domain": "example.com"},
+		},
+		{
+			name:     "deep appends lists",
+			strategy: MergeStrategy{Deep: true, Lists: ListsAppend},
+			higher:   map[string]any{"dns": []string{"9.9.9.9"}},
+			want:     map[string]any{"db": lower()["db"], "dns": []any{"1.1.1.1", "9.9.9.9"}, "domain": "example.com"},
+		},
+		{
+			name:     "unset top level key",
+			strategy: MergeStrategy{},
+			higher:   map[string]any{"domain": Unset, "extra": Unset},
+			want:     map[string]any{"db": lower()["db"], "dns": []any{"1.1.1.1"}},
+		},
+		{
+			name:     "unset nested key",
+			strategy: MergeStrategy{Deep: true, Lists: ListsReplace},
+			higher:   map[string]any{"db": map[string]any{"flags": Unset, "host": "localhost"}},
+			want: map[string]any{
+				"db":     map[string]any{"host": "localhost", "port": 5432},
+				"dns":    []any{"1.1.1.1"},
+				"domain": "example.com",
+			},
+		},
+		{
+			name:     "deep value replaces table",
+			strategy: MergeStrategy{Deep: true, Lists: ListsReplace},
+			higher:   map[string]any{"db": "sqlite"},
+			want:     map[string]any{"db": "sqlite", "dns": []any{"1.1.1.1"}, "domain": "example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := lower()
+			assert.Equal(t, tt.want, tt.strategy.Merge(tt.higher, l))
+			assert.Equal(t, lower(), l, "lower shouldn't be modified")
+		})
+	}
+}
+
+func Test_TraceResolveDeep(t *testing.T) {
+	trace := Trace{
+		"db": {
+			{Layer: "global", Value: map[string]any{"host": "db.example.com", "port": 5432}},
+			{Layer: "role web", Value: map[string]any{"user": "web"}},
+			{Layer: "host web01", Value: map[string]any{"port": 5433}},
+		},
+		"debug": {
+			{Layer: "global", Value: true},
+			{Layer: "host web01", Value: Unset},
+		},
+		"tags": {
+			{Layer: "global", Value: []any{"prod"}},
+			{Layer: "role web", Value: Unset},
+			{Layer: "host web01", Value: []any{"web"}},
+		},
+	}
+	assert.Equal(t, map[string]any{
+		"db":   map[string]any{"port": 5433},
+		"tags": []any{"web"},
+	}, trace.Resolved())
+	assert.Equal(t, map[string]any{
+		"db":   map[string]any{"host": "db.example.com", "port": 5433, "user": "web"},
+		"tags": []any{"web"},
+	}, trace.Resolve(MergeStrategy{Deep: true, Lists: ListsAppend}), "unset clears lower values before appending")
+}
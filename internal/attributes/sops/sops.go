@@ -16,18 +16,46 @@ import (
 )
 
 type SopsStore struct {
+	config        Config
+	sourceDir     string
 	vaultfiles    []string
 	generalVaults []string
 	loadAllVaults bool
+	cache         attributes.VaultCache
 }
 
 func NewSopsStore(c Config, sourceDir string) (*SopsStore, error) {
 	if err := c.Validate(); err != nil {
 		return nil, err
 	}
-	var s SopsStore
+	s := &SopsStore{config: c, sourceDir: sourceDir}
 	s.generalVaults = c.GeneralVaults
 	s.loadAllVaults = c.LoadAllVaults
+	var err error
+	s.vaultfiles, err = VaultFiles(c, sourceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Invalidate drops decrypted vaults and rescans the vault files when the source has changed
+func (s *SopsStore) Invalidate(generation string) error {
+	if !s.cache.Reset(generation) {
+		return nil
+	}
+	files, err := VaultFiles(s.config, s.sourceDir)
+	if err != nil {
+		return err
+	}
+	s.vaultfiles = files
+	return nil
+}
+
+// VaultFiles lists the sops vaults in the configured base directory
+func VaultFiles(c Config, sourceDir string) ([]string, error) {
+	var files []string
 	err := filepath.WalkDir(filepath.Join(sourceDir, c.BaseDir), func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -40,24 +68,27 @@ func NewSopsStore(c Config, sourceDir string) (*SopsStore, error) {
 		if formats.IsIniFile(path) || formats.IsJSONFile(path) || formats.IsYAMLFile(path) {
 			if c.Suffix != "" {
 				if strings.Contains(path, c.Suffix) {
-					s.vaultfiles = append(s.vaultfiles, path)
+					files = append(files, path)
 				}
 			} else {
-				s.vaultfiles = append(s.vaultfiles, path)
+				files = append(files, path)
 			}
 		}
 		return nil
 	})
+	return files, err
+}
+
+func (s *SopsStore) Lookup(ctx context.Context, f attributes.AttributesFilter) (map[string]any, error) {
+	t, err := s.Trace(ctx, f)
 	if err != nil {
 		return nil, err
 	}
-
-	return &s, nil
+	return t.Resolved(), nil
 }
 
-func (s *SopsStore) Lookup(ctx context.Context, f attributes.AttributesFilter) (map[string]any, error) {
-	attrs := attributes.AttributeVault{}
-	results := make(map[string]any)
+func (s *SopsStore) Trace(ctx context.Context, f attributes.AttributesFilter) (attributes.Trace, error) {
+	results := make(attributes.Trace)
 	var files []string
 	var err error
 	if s.loadAllVaults {
@@ -74,34 +105,43 @@ func (s *SopsStore) Lookup(ctx context.Context, f attributes.AttributesFilter) (
 			return nil, ctx.Err()
 		default:
 		}
-		decrypted, err := decrypt.File(v, filepath.Ext(v))
+		attrs, err := s.cache.Load(v, loadVault)
 		if err != nil {
-			return nil, fmt.Errorf("error decrypting SOPS file %v: %v", v, err)
+			return nil, err
 		}
-		if formats.IsYAMLFile(v) {
-			err = yaml.Unmarshal(decrypted, &attrs)
-			if err != nil {
-				return nil, fmt.Errorf("error unmarshaling SOPS YAML %v: %v", v, err)
-			}
-		} else if formats.IsJSONFile(v) {
-			err = json.Unmarshal(decrypted, &attrs)
-			if err != nil {
-				return nil, fmt.Errorf("error unmarshaling SOPS JSON %v: %v", v, err)
-			}
-		} else if formats.IsIniFile(v) {
-			// TODO this probably doesn't work?
-			interformat, err := ini.Load(decrypted)
-			if err != nil {
-				return nil, fmt.Errorf("error unmarshaling SOPS INI %v: %v", v, err)
-			}
-			err = interformat.MapTo(attrs)
-			if err != nil {
-				return nil, fmt.Errorf("error mapping SOPS INI %v: %v", v, err)
-			}
-		} else {
-			return nil, fmt.Errorf("invalid sops file: %v", v)
-		}
-		attributes.ExtractVaultAttributes(results, attrs, f)
+		attributes.TraceVaultAttributes(results, attrs, f, attributes.Provenance{Engine: "sops", Source: v, Secret: true})
 	}
 	return results, nil
 }
+
+func loadVault(path string) (attributes.AttributeVault, error) {
+	attrs := attributes.AttributeVault{}
+	decrypted, err := decrypt.File(path, filepath.Ext(path))
+	if err != nil {
+		return attrs, fmt.Errorf("error decrypting SOPS file %v: %v", path, err)
+	}
+	if formats.IsYAMLFile(path) {
+		err = yaml.Unmarshal(decrypted, &attrs)
+		if err != nil {
+			return attrs, fmt.Errorf("error unmarshaling SOPS YAML %v: %v", path, err)
+		}
+	} else if formats.IsJSONFile(path) {
+		err = json.Unmarshal(decrypted, &attrs)
+		if err != nil {
+			return attrs, fmt.Errorf("error unmarshaling SOPS JSON %v: %v", path, err)
+		}
+	} else if formats.IsIniFile(path) {
+		// TODO this probably doesn't work?
+		interformat, err := ini.Load(decrypted)
+		if err != nil {
+			return attrs, fmt.Errorf("error unmarshaling SOPS INI %v: %v", path, err)
+		}
+		err = interformat.MapTo(attrs)
+		if err != nil {
+			return attrs, fmt.Errorf("error mapping SOPS INI %v: %v", path, err)
+		}
+	} else {
+		return attrs, fmt.Errorf("invalid sops file: %v", path)
+	}
+	return attrs, nil
+}
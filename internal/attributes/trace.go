@@ -0,0 +1,111 @@
+package attributes
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Provenance is a value an attribute was set to and where it was set
+type Provenance struct {
+	Engine string `json:"engine"`
+	// Source is the vault file, secret path or credential the value was read from
+	Source string `json:"source,omitempty"`
+	// Layer is the scope within the source, e.g. "global" or "role web"
+	Layer  string `json:"layer"`
+	Secret bool   `json:"secret"`
+	Value  any    `json:"value"`
+}
+
+// Trace records every value each attribute was set to, from lowest to highest precedence
+type Trace map[string][]Provenance
+
+type Tracer interface {
+	Trace(context.Context, AttributesFilter) (Trace, error)
+}
+
+func (t Trace) Add(key string, p Provenance) {
+	t[key] = append(t[key], p)
+}
+
+// AddAll records every key in attrs as coming from p
+func (t Trace) AddAll(attrs map[string]any, p Provenance) {
+	for k, v := range attrs {
+		p.Value = v
+		t.Add(k, p)
+	}
+}
+
+// Append adds everything in higher above what's already recorded
+func (t Trace) Append(higher Trace) {
+	for k, ps := range higher {
+		t[k] = append(t[k], ps...)
+	}
+}
+
+// Resolved returns the winning value for each key
+func (t Trace) Resolved() map[string]any {
+	return t.Resolve(MergeStrategy{})
+}
+
+// Resolve layers each key's values from lowest to highest precedence. A key whose last value is Unset is left out.
+func (t Trace) Resolve(s MergeStrategy) map[string]any {
+	results := make(map[string]any, len(t))
+	for k, ps := range t {
+		var value any
+		set := false
+		for _, p := range ps {
+			switch {
+			case p.Value == Unset:
+				value, set = nil, false
+			case !set:
+				value, set = s.Override(nil, p.Value), true
+			default:
+				value = s.Override(value, p.Value)
+			}
+		}
+		if set {
+			results[k] = value
+		}
+	}
+	return results
+}
+
+func (t Trace) Keys() []string {
+	return slices.Sorted(maps.Keys(t))
+}
+
+// TraceVaultAttributes records a vault's attributes for a filter, from globals through roles and components to the host
+func TraceVaultAttributes(t Trace, vault AttributeVault, filter AttributesFilter, origin Provenance) {
+	add := func(attrs map[string]any, layer string) {
+		p := origin
+		p.Layer = layer
+		t.AddAll(attrs, p)
+	}
+	add(vault.Globals, "global")
+
+	for _, role := range filter.Roles {
+		if attrs, ok := vault.Roles[role]; ok {
+			add(attrs, fmt.Sprintf("role %v", role))
+		}
+	}
+
+	if filter.Component != "" {
+		if attrs, ok := vault.Components[filter.Component]; ok {
+			add(attrs, fmt.Sprintf("component %v", filter.Component))
+		}
+		if filter.Instance != "" {
+			instance := fmt.Sprintf("%v@%v", filter.Component, filter.Instance)
+			if attrs, ok := vault.Components[instance]; ok {
+				add(attrs, fmt.Sprintf("instance %v", instance))
+			}
+		}
+	}
+
+	if filter.Hostname != "" {
+		if attrs, ok := vault.Hosts[filter.Hostname]; ok {
+			add(attrs, fmt.Sprintf("host %v", filter.Hostname))
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package attributes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TraceVaultAttributes(t *testing.T) {
+	general := AttributeVault{
+		Globals: map[string]any{"domain": "example.com", "image": "nginx:latest"},
+		Components: map[string]map[string]any{
+			"nginx":        {"image": "nginx:1.27"},
+			"nginx@public": {"port": 443},
+			"caddy":        {"image": "caddy"},
+		},
+	}
+	host := AttributeVault{
+		Roles: map[string]map[string]any{"web": {"port": 80}},
+		Hosts: map[string]map[string]any{"web01": {"domain": "web01.example.com"}},
+	}
+	filter := AttributesFilter{Hostname: "web01", Roles: []string{"web"}, Component: "nginx", Instance: "public"}
+
+	trace := make(Trace)
+	TraceVaultAttributes(trace, general, filter, Provenance{Engine: "file", Source: "vault.toml"})
+	TraceVaultAttributes(trace, host, filter, Provenance{Engine: "age", Source: "web01.age", Secret: true})
+
+	assert.Equal(t, map[string]any{"domain": "web01.example.com", "image": "nginx:1.27", "port": 80}, trace.Resolved())
+	assert.Equal(t, []string{"domain", "image", "port"}, trace.Keys())
+
+	assert.Equal(t, []Provenance{
+		{Engine: "file", Source: "vault.toml", Layer: "global", Value: "example.com"},
+		{Engine: "age", Source: "web01.age", Layer: "host web01", Secret: true, Value: "web01.example.com"},
+	}, trace["domain"])
+	assert.Equal(t, []Provenance{
+		{Engine: "file", Source: "vault.toml", Layer: "instance nginx@public", Value: 443},
+		{Engine: "age", Source: "web01.age", Layer: "role web", Secret: true, Value: 80},
+	}, trace["port"], "later vault files win regardless of layer")
+
+	lower := Trace{"image": {{Engine: "manifest", Layer: "component defaults", Value: "nginx"}}, "extra": {{Engine: "manifest", Value: true}}}
+	lower.Append(trace)
+	assert.Equal(t, "nginx:1.27", lower.Resolved()["image"])
+	assert.Equal(t, true, lower.Resolved()["extra"])
+	assert.Len(t, lower["image"], 3)
+}
@@ -0,0 +1,122 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/knadh/koanf/v2"
+)
+
+type Config struct {
+	Address      string        `toml:"address"`
+	Namespace    string        `toml:"namespace"`
+	Mount        string        `toml:"mount"`
+	Prefix       string        `toml:"prefix"`
+	TokenFile    string        `toml:"token_file"`
+	RoleID       string        `toml:"role_id"`
+	SecretIDFile string        `toml:"secret_id_file"`
+	AppRoleMount string        `toml:"approle_mount"`
+	CACert       string        `toml:"ca_cert"`
+	CacheTTL     time.Duration `toml:"cache_ttl"`
+}
+
+func (c Config) Validate() error {
+	if c.Address == "" {
+		return errors.New("need address for vault attributes")
+	}
+	if c.Mount == "" {
+		return errors.New("need KV mount for vault attributes")
+	}
+	if c.RoleID != "" && c.SecretIDFile == "" {
+		return errors.New("approle auth needs a secret ID file")
+	}
+	if c.RoleID != "" && c.TokenFile != "" {
+		return errors.New("can't use both a token file and approle auth")
+	}
+	if c.CacheTTL < 0 {
+		return errors.New("vault cache TTL can't be negative")
+	}
+	return nil
+}
+
+func NewConfig(k *koanf.Koanf) (*Config, error) {
+	var c Config
+	c.Address = k.String("vault.address")
+	if c.Address == "" {
+		c.Address = os.Getenv("VAULT_ADDR")
+	}
+	c.Namespace = k.String("vault.namespace")
+	c.Mount = k.String("vault.mount")
+	if c.Mount == "" {
+		c.Mount = "secret"
+	}
+	c.Prefix = k.String("vault.prefix")
+	if c.Prefix == "" {
+		c.Prefix = "materia"
+	}
+	c.TokenFile = k.String("vault.token_file")
+	c.RoleID = k.String("vault.role_id")
+	c.SecretIDFile = k.String("vault.secret_id_file")
+	c.AppRoleMount = k.String("vault.approle_mount")
+	if c.AppRoleMount == "" {
+		c.AppRoleMount = "approle"
+	}
+	c.CACert = k.String("vault.ca_cert")
+	c.CacheTTL = time.Minute * 5
+	if k.Exists("vault.cache_ttl") {
+		var err error
+		c.CacheTTL, err = time.ParseDuration(k.String("vault.cache_ttl"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid vault cache TTL: %w", err)
+		}
+	}
+
+	return &c, nil
+}
+
+func (c *Config) Merge(other *Config) {
+	if other.Address != "" {
+		c.Address = other.Address
+	}
+	if other.Namespace != "" {
+		c.Namespace = other.Namespace
+	}
+	if other.Mount != "" {
+		c.Mount = other.Mount
+	}
+	if other.Prefix != "" {
+		c.Prefix = other.Prefix
+	}
+	if other.TokenFile != "" {
+		c.TokenFile = other.TokenFile
+	}
+	if other.RoleID != "" {
+		c.RoleID = other.RoleID
+	}
+	if other.SecretIDFile != "" {
+		c.SecretIDFile = other.SecretIDFile
+	}
+	if other.AppRoleMount != "" {
+		c.AppRoleMount = other.AppRoleMount
+	}
+	if other.CACert != "" {
+		c.CACert = other.CACert
+	}
+	if other.CacheTTL != 0 {
+		c.CacheTTL = other.CacheTTL
+	}
+}
+
+func (c Config) String() string {
+	auth := "token"
+	if c.RoleID != "" {
+		auth = fmt.Sprintf("approle (%v)", c.AppRoleMount)
+	}
+	return fmt.Sprintf("Address: %v\nNamespace: %v\nMount: %v\nPrefix: %v\nAuth: %v\nToken File: %v\nCache TTL: %v\n", c.Address, c.Namespace, c.Mount, c.Prefix, auth, c.TokenFile, c.CacheTTL)
+}
+
+func (c Config) SourceType() string {
+	return "vault"
+}
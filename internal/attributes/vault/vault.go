@@ -0,0 +1,208 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"charm.land/log/v2"
+	"github.com/hashicorp/vault/api"
+	"primamateria.systems/materia/internal/attributes"
+)
+
+// VaultStore reads attributes from a HashiCorp Vault or OpenBao KV v2 mount.
+// Secrets are laid out under the prefix as globals, roles/<role>, components/<component>,
+// components/<component>@<instance> and hosts/<hostname>, with later paths taking precedence.
+type VaultStore struct {
+	client       *api.Client
+	mount        string
+	prefix       string
+	tokenFile    string
+	roleID       string
+	secretIDFile string
+	approleMount string
+	cacheTTL     time.Duration
+
+	mu          sync.Mutex
+	tokenExpiry time.Time
+	cache       map[string]cachedSecret
+}
+
+type cachedSecret struct {
+	data    map[string]any
+	expires time.Time
+}
+
+func NewVaultStore(c Config) (*VaultStore, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	conf := api.DefaultConfig()
+	if conf.Error != nil {
+		return nil, fmt.Errorf("can't configure vault client: %w", conf.Error)
+	}
+	conf.Address = c.Address
+	if c.CACert != "" {
+		if err := conf.ConfigureTLS(&api.TLSConfig{CACert: c.CACert}); err != nil {
+			return nil, fmt.Errorf("can't configure vault TLS: %w", err)
+		}
+	}
+	client, err := api.NewClient(conf)
+	if err != nil {
+		return nil, fmt.Errorf("can't create vault client: %w", err)
+	}
+	if c.Namespace != "" {
+		client.SetNamespace(c.Namespace)
+	}
+	return &VaultStore{
+		client:       client,
+		mount:        c.Mount,
+		prefix:       strings.Trim(c.Prefix, "/"),
+		tokenFile:    c.TokenFile,
+		roleID:       c.RoleID,
+		secretIDFile: c.SecretIDFile,
+		approleMount: strings.Trim(c.AppRoleMount, "/"),
+		cacheTTL:     c.CacheTTL,
+		cache:        make(map[string]cachedSecret),
+	}, nil
+}
+
+func (s *VaultStore) Lookup(ctx context.Context, f attributes.AttributesFilter) (map[string]any, error) {
+	t, err := s.Trace(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return t.Resolved(), nil
+}
+
+func (s *VaultStore) Trace(ctx context.Context, f attributes.AttributesFilter) (attributes.Trace, error) {
+	results := make(attributes.Trace)
+	for _, p := range s.secretPaths(f) {
+		data, err := s.read(ctx, p.path)
+		if err != nil {
+			return nil, err
+		}
+		results.AddAll(data, attributes.Provenance{Engine: "vault", Source: path.Join(s.mount, p.path), Layer: p.layer, Secret: true})
+	}
+	return results, nil
+}
+
+type vaultPath struct {
+	path  string
+	layer string
+}
+
+// secretPaths lists the secrets that apply to a filter, from least to most specific
+func (s *VaultStore) secretPaths(f attributes.AttributesFilter) []vaultPath {
+	paths := []vaultPath{{path.Join(s.prefix, "globals"), "global"}}
+	for _, r := range f.Roles {
+		paths = append(paths, vaultPath{path.Join(s.prefix, "roles", r), fmt.Sprintf("role %v", r)})
+	}
+	if f.Component != "" {
+		paths = append(paths, vaultPath{path.Join(s.prefix, "components", f.Component), fmt.Sprintf("component %v", f.Component)})
+		if f.Instance != "" {
+			instance := fmt.Sprintf("%v@%v", f.Component, f.Instance)
+			paths = append(paths, vaultPath{path.Join(s.prefix, "components", instance), fmt.Sprintf("instance %v", instance)})
+		}
+	}
+	if f.Hostname != "" {
+		paths = append(paths, vaultPath{path.Join(s.prefix, "hosts", f.Hostname), fmt.Sprintf("host %v", f.Hostname)})
+	}
+	return paths
+}
+
+func (s *VaultStore) read(ctx context.Context, secretPath string) (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cached, ok := s.cache[secretPath]; ok && time.Now().Before(cached.expires) {
+		return cached.data, nil
+	}
+	if err := s.ensureToken(ctx, false); err != nil {
+		return nil, err
+	}
+	secret, err := s.client.KVv2(s.mount).Get(ctx, secretPath)
+	if isPermissionDenied(err) && s.canReauth() {
+		// the token may have been revoked or rotated underneath us
+		log.Debug("vault permission denied, re-authenticating", "path", secretPath)
+		if err := s.ensureToken(ctx, true); err != nil {
+			return nil, err
+		}
+		secret, err = s.client.KVv2(s.mount).Get(ctx, secretPath)
+	}
+	var data map[string]any
+	ttl := s.cacheTTL
+	switch {
+	case errors.Is(err, api.ErrSecretNotFound):
+		data = map[string]any{}
+	case err != nil:
+		return nil, fmt.Errorf("can't read vault secret %v: %w", secretPath, err)
+	default:
+		// deleted or destroyed versions come back without data
+		data = secret.Data
+		if data == nil {
+			data = map[string]any{}
+		}
+		if secret.Raw != nil && secret.Raw.LeaseDuration > 0 {
+			ttl = min(ttl, time.Duration(secret.Raw.LeaseDuration)*time.Second)
+		}
+	}
+	if ttl > 0 {
+		s.cache[secretPath] = cachedSecret{data: data, expires: time.Now().Add(ttl)}
+	}
+	return data, nil
+}
+
+func (s *VaultStore) canReauth() bool {
+	return s.tokenFile != "" || s.roleID != ""
+}
+
+// ensureToken loads a token from the token file or logs in with AppRole, renewing it once most of its lease has passed.
+// Without either, the client falls back to VAULT_TOKEN.
+func (s *VaultStore) ensureToken(ctx context.Context, force bool) error {
+	if !force && s.client.Token() != "" && (s.tokenExpiry.IsZero() || time.Now().Before(s.tokenExpiry)) {
+		return nil
+	}
+	switch {
+	case s.roleID != "":
+		secretID, err := os.ReadFile(s.secretIDFile)
+		if err != nil {
+			return fmt.Errorf("can't read vault secret ID: %w", err)
+		}
+		login, err := s.client.Logical().WriteWithContext(ctx, path.Join("auth", s.approleMount, "login"), map[string]any{
+			"role_id":   s.roleID,
+			"secret_id": strings.TrimSpace(string(secretID)),
+		})
+		if err != nil {
+			return fmt.Errorf("vault approle login failed: %w", err)
+		}
+		if login == nil || login.Auth == nil || login.Auth.ClientToken == "" {
+			return errors.New("vault approle login returned no token")
+		}
+		s.client.SetToken(login.Auth.ClientToken)
+		s.tokenExpiry = time.Time{}
+		if lease := time.Duration(login.Auth.LeaseDuration) * time.Second; lease > 0 {
+			s.tokenExpiry = time.Now().Add(lease * 9 / 10)
+		}
+	case s.tokenFile != "":
+		token, err := os.ReadFile(s.tokenFile)
+		if err != nil {
+			return fmt.Errorf("can't read vault token file: %w", err)
+		}
+		s.client.SetToken(strings.TrimSpace(string(token)))
+	}
+	if s.client.Token() == "" {
+		return errors.New("no vault token: set a token file, approle credentials or VAULT_TOKEN")
+	}
+	return nil
+}
+
+func isPermissionDenied(err error) bool {
+	var respErr *api.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusForbidden
+}
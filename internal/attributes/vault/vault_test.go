@@ -0,0 +1,208 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"primamateria.systems/materia/internal/attributes"
+)
+
+// fakeVault serves just enough of the KV v2 and AppRole APIs for the store
+type fakeVault struct {
+	mu      sync.Mutex
+	secrets map[string]map[string]any
+	tokens  map[string]bool
+	logins  int
+	reads   map[string]int
+}
+
+func newFakeVault(secrets map[string]map[string]any) *fakeVault {
+	return &fakeVault{secrets: secrets, tokens: map[string]bool{"root": true}, reads: map[string]int{}}
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path == "/v1/auth/approle/login" {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != "materia" || body["secret_id"] != "s3cret" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["invalid role or secret ID"]}`))
+			return
+		}
+		f.logins++
+		token := "approle-token-" + strings.Repeat("x", f.logins)
+		f.tokens[token] = true
+		_ = json.NewEncoder(w).Encode(map[string]any{"auth": map[string]any{"client_token": token, "lease_duration": 3600}})
+		return
+	}
+	if !f.tokens[r.Header.Get("X-Vault-Token")] {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+	secretPath, ok := strings.CutPrefix(r.URL.Path, "/v1/secret/data/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errors":[]}`))
+		return
+	}
+	f.reads[secretPath]++
+	data, ok := f.secrets[secretPath]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errors":[]}`))
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+		"data":     data,
+		"metadata": map[string]any{"version": 1, "created_time": time.Now().Format(time.RFC3339Nano)},
+	}})
+}
+
+func testSecrets() map[string]map[string]any {
+	return map[string]map[string]any{
+		"materia/globals":                 {"domain": "example.com", "image": "nginx:latest"},
+		"materia/roles/web":               {"port": "8080"},
+		"materia/components/nginx":        {"image": "nginx:1.27"},
+		"materia/components/nginx@public": {"port": "443"},
+		"materia/hosts/web01":             {"domain": "web01.example.com"},
+	}
+}
+
+func testConfig(t *testing.T, address string) Config {
+	t.Helper()
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("root\n"), 0o600))
+	return Config{
+		Address:      address,
+		Mount:        "secret",
+		Prefix:       "materia",
+		TokenFile:    tokenFile,
+		AppRoleMount: "approle",
+		CacheTTL:     time.Minute,
+	}
+}
+
+func TestVaultStore_Lookup(t *testing.T) {
+	server := httptest.NewServer(newFakeVault(testSecrets()))
+	defer server.Close()
+	store, err := NewVaultStore(testConfig(t, server.URL))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		filter attributes.AttributesFilter
+		want   map[string]any
+	}{
+		{
+			name:   "globals only",
+			filter: attributes.AttributesFilter{},
+			want:   map[string]any{"domain": "example.com", "image": "nginx:latest"},
+		},
+		{
+			name:   "component overrides globals",
+			filter: attributes.AttributesFilter{Component: "nginx"},
+			want:   map[string]any{"domain": "example.com", "image": "nginx:1.27"},
+		},
+		{
+			name:   "instance overrides component and role",
+			filter: attributes.AttributesFilter{Roles: []string{"web"}, Component: "nginx", Instance: "public"},
+			want:   map[string]any{"domain": "example.com", "image": "nginx:1.27", "port": "443"},
+		},
+		{
+			name:   "host overrides everything",
+			filter: attributes.AttributesFilter{Hostname: "web01", Roles: []string{"web", "missing"}, Component: "nginx"},
+			want:   map[string]any{"domain": "web01.example.com", "image": "nginx:1.27", "port": "8080"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.Lookup(context.Background(), tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestVaultStore_Cache(t *testing.T) {
+	fake := newFakeVault(testSecrets())
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	store, err := NewVaultStore(testConfig(t, server.URL))
+	require.NoError(t, err)
+
+	for range 3 {
+		_, err := store.Lookup(context.Background(), attributes.AttributesFilter{Component: "missing"})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, fake.reads["materia/globals"])
+	assert.Equal(t, 1, fake.reads["materia/components/missing"], "missing secrets should be cached too")
+
+	store.cache = make(map[string]cachedSecret)
+	store.cacheTTL = 0
+	for range 2 {
+		_, err := store.Lookup(context.Background(), attributes.AttributesFilter{})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, fake.reads["materia/globals"])
+}
+
+func TestVaultStore_AppRole(t *testing.T) {
+	fake := newFakeVault(testSecrets())
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	c := testConfig(t, server.URL)
+	c.TokenFile = ""
+	c.RoleID = "materia"
+	c.SecretIDFile = filepath.Join(t.TempDir(), "secret-id")
+	c.CacheTTL = 0
+	require.NoError(t, os.WriteFile(c.SecretIDFile, []byte("s3cret\n"), 0o600))
+	store, err := NewVaultStore(c)
+	require.NoError(t, err)
+
+	got, err := store.Lookup(context.Background(), attributes.AttributesFilter{Hostname: "web01"})
+	require.NoError(t, err)
+	assert.Equal(t, "web01.example.com", got["domain"])
+	assert.Equal(t, 1, fake.logins)
+
+	// a revoked token triggers a fresh login
+	fake.mu.Lock()
+	fake.tokens = map[string]bool{}
+	fake.mu.Unlock()
+	got, err = store.Lookup(context.Background(), attributes.AttributesFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", got["domain"])
+	assert.Equal(t, 2, fake.logins)
+
+	// and so does an expiring lease
+	store.tokenExpiry = time.Now().Add(-time.Second)
+	_, err = store.Lookup(context.Background(), attributes.AttributesFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, fake.logins)
+}
+
+func TestVaultStore_PermissionDenied(t *testing.T) {
+	server := httptest.NewServer(newFakeVault(testSecrets()))
+	defer server.Close()
+	c := testConfig(t, server.URL)
+	require.NoError(t, os.WriteFile(c.TokenFile, []byte("bad-token"), 0o600))
+	store, err := NewVaultStore(c)
+	require.NoError(t, err)
+
+	_, err = store.Lookup(context.Background(), attributes.AttributesFilter{})
+	assert.ErrorContains(t, err, "materia/globals")
+}
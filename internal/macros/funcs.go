@@ -0,0 +1,320 @@
+package macros
+
+import (
+	"bytes"
+	"crypto/hkdf"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	passwordAlphabet      = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	defaultPasswordLength = 32
+)
+
+// Funcs is the general purpose template function library. Every function is deterministic and has no access to
+// the host, so the same attributes always template the same output.
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		// strings
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, replacement, s string) string { return strings.ReplaceAll(s, old, replacement) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"repeat":     func(n int, s string) string { return strings.Repeat(s, n) },
+		"quote":      func(v any) string { return fmt.Sprintf("%q", fmt.Sprint(v)) },
+		"squote":     func(v any) string { return "'" + fmt.Sprint(v) + "'" },
+		"indent":     indent,
+		"nindent":    func(n int, s string) string { return "\n" + indent(n, s) },
+
+		// lists
+		"list":      func(items ...any) []any { return items },
+		"join":      join,
+		"first":     first,
+		"last":      last,
+		"has":       has,
+		"uniq":      uniq,
+		"sortAlpha": sortAlpha,
+
+		// maps
+		"dict":   dict,
+		"keys":   keys,
+		"hasKey": func(m map[string]any, key string) bool { _, ok := m[key]; return ok },
+		"get":    func(m map[string]any, key string) any { return m[key] },
+
+		// encoding
+		"toJson":       toJSON,
+		"toPrettyJson": toPrettyJSON,
+		"toToml":       toTOML,
+		"toYaml":       toYAML,
+		"b64enc":       func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec":       b64dec,
+		"sha1sum":      func(s string) string { sum := sha1.Sum([]byte(s)); return hex.EncodeToString(sum[:]) },
+		"sha256sum":    func(s string) string { sum := sha256.Sum256([]byte(s)); return hex.EncodeToString(sum[:]) },
+		"sha512sum":    func(s string) string { sum := sha512.Sum512([]byte(s)); return hex.EncodeToString(sum[:]) },
+
+		// values
+		"default":  defaultValue,
+		"empty":    empty,
+		"coalesce": coalesce,
+		"required": required,
+
+		// escaping
+		"iniEscape":     iniEscape,
+		"quadletEscape": quadletEscape,
+		"quadletQuote":  quadletQuote,
+
+		"derivePassword": derivePassword,
+	}
+}
+
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// toList converts any slice or array to []any
+func toList(v any) ([]any, error) {
+	if l, ok := v.([]any); ok {
+		return l, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected a list, got %T", v)
+	}
+	result := make([]any, rv.Len())
+	for i := range rv.Len() {
+		result[i] = rv.Index(i).Interface()
+	}
+	return result, nil
+}
+
+func join(sep string, v any) (string, error) {
+	l, err := toList(v)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, len(l))
+	for i, item := range l {
+		parts[i] = fmt.Sprint(item)
+	}
+	return strings.Join(parts, sep), nil
+}
+
+func first(v any) (any, error) {
+	l, err := toList(v)
+	if err != nil || len(l) == 0 {
+		return nil, err
+	}
+	return l[0], nil
+}
+
+func last(v any) (any, error) {
+	l, err := toList(v)
+	if err != nil || len(l) == 0 {
+		return nil, err
+	}
+	return l[len(l)-1], nil
+}
+
+func has(item, v any) (bool, error) {
+	l, err := toList(v)
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(l, func(x any) bool { return reflect.DeepEqual(x, item) }), nil
+}
+
+func uniq(v any) ([]any, error) {
+	l, err := toList(v)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]any, 0, len(l))
+	for _, item := range l {
+		if !slices.ContainsFunc(result, func(x any) bool { return reflect.DeepEqual(x, item) }) {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func sortAlpha(v any) ([]string, error) {
+	l, err := toList(v)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, len(l))
+	for i, item := range l {
+		result[i] = fmt.Sprint(item)
+	}
+	slices.Sort(result)
+	return result, nil
+}
+
+func dict(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict needs key value pairs")
+	}
+	result := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict keys must be strings, got %T", pairs[i])
+		}
+		result[key] = pairs[i+1]
+	}
+	return result, nil
+}
+
+// keys returns a map's keys in sorted order so output is stable
+func keys(m map[string]any) []string {
+	return slices.Sorted(maps.Keys(m))
+}
+
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+func toPrettyJSON(v any) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	return string(data), err
+}
+
+func toTOML(v any) (string, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+		return "", fmt.Errorf("can't encode %T as TOML: %w", v, err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+func toYAML(v any) (string, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+func b64dec(s string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	return string(data), err
+}
+
+// empty reports whether v is nil, a zero number, false, or an empty string or collection
+func empty(v any) bool {
+	if v == nil {
+		return true
+	}
+	return reflect.ValueOf(v).IsZero() || isEmptyCollection(v)
+}
+
+func isEmptyCollection(v any) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return rv.Len() == 0
+	}
+	return false
+}
+
+// defaultValue returns def if v is unset or an empty string or collection. Numbers and booleans are kept as they are,
+// so an explicit 0 or false isn't replaced.
+func defaultValue(def, v any) any {
+	if v == nil || isEmptyCollection(v) {
+		return def
+	}
+	return v
+}
+
+func coalesce(values ...any) any {
+	for _, v := range values {
+		if !empty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+func required(msg string, v any) (any, error) {
+	if v == nil || isEmptyCollection(v) {
+		return nil, errors.New(msg)
+	}
+	return v, nil
+}
+
+// iniEscape quotes an INI value if it has characters that would otherwise be lost or misread
+func iniEscape(v any) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.TrimSpace(s) != s || strings.ContainsAny(s, ";#=\"\\\n") {
+		r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+		return `"` + r.Replace(s) + `"`
+	}
+	return s
+}
+
+// quadletEscape escapes systemd specifiers and backslashes so a value is used literally in a quadlet or unit file
+func quadletEscape(v any) string {
+	r := strings.NewReplacer(`%`, `%%`, `\`, `\\`, "\n", `\n`)
+	return r.Replace(fmt.Sprint(v))
+}
+
+// quadletQuote escapes a value and wraps it in double quotes, for space separated settings like Exec= or Environment=
+func quadletQuote(v any) string {
+	r := strings.NewReplacer(`%`, `%%`, `\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(fmt.Sprint(v)) + `"`
+}
+
+// derivePassword deterministically derives a password for name from a secret seed, so services can get stable,
+// unique passwords without storing each one. The optional length defaults to 32.
+func derivePassword(seed, name string, length ...int) (string, error) {
+	if seed == "" {
+		return "", errors.New("derivePassword needs a seed")
+	}
+	n := defaultPasswordLength
+	if len(length) > 0 {
+		n = length[0]
+	}
+	if n < 1 || n > 256 {
+		return "", fmt.Errorf("invalid password length %v", n)
+	}
+	// reading more than needed leaves room for the bytes rejected to avoid modulo bias
+	key, err := hkdf.Key(sha256.New, []byte(seed), nil, "materia password "+name, n*4)
+	if err != nil {
+		return "", err
+	}
+	limit := byte(256 - 256%len(passwordAlphabet))
+	result := make([]byte, 0, n)
+	for _, b := range key {
+		if b >= limit {
+			continue
+		}
+		result = append(result, passwordAlphabet[int(b)%len(passwordAlphabet)])
+		if len(result) == n {
+			return string(result), nil
+		}
+	}
+	return "", errors.New("unable to derive password")
+}
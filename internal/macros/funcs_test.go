@@ -0,0 +1,112 @@
+package macros
+
+import (
+	"bytes"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func execute(t *testing.T, tmpl string, vars map[string]any) (string, error) {
+	t.Helper()
+	parsed, err := template.New("test").Option("missingkey=error").Funcs(Funcs()).Parse(tmpl)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	err = parsed.Execute(&buf, vars)
+	return buf.String(), err
+}
+
+func TestFuncs(t *testing.T) {
+	vars := map[string]any{
+		"name":    "Caddy",
+		"hosts":   []any{"b.example.com", "a.example.com", "b.example.com"},
+		"ports":   []int{80, 443},
+		"db":      map[string]any{"host": "db.example.com", "port": 5432},
+		"empty":   "",
+		"zero":    0,
+		"off":     false,
+		"command": `echo "100%" \ done`,
+	}
+	tests := []struct {
+		name, tmpl, want string
+	}{
+		{"lower", `{{ lower .name }}`, "caddy"},
+		{"replace pipeline", `{{ .name | replace "C" "c" }}`, "caddy"},
+		{"trimSuffix", `{{ "caddy.service" | trimSuffix ".service" }}`, "caddy"},
+		{"split", `{{ index (split "." "a.b.c") 1 }}`, "b"},
+		{"join", `{{ .ports | join "," }}`, "80,443"},
+		{"uniq sort", `{{ .hosts | uniq | sortAlpha | join " " }}`, "a.example.com b.example.com"},
+		{"first last", `{{ first .ports }} {{ last .ports }}`, "80 443"},
+		{"has", `{{ has 443 .ports }} {{ has 22 .ports }}`, "true false"},
+		{"list", `{{ list "a" 1 | toJson }}`, `["a",1]`},
+		{"dict", `{{ (dict "a" 1 "b" "two").b }}`, "two"},
+		{"keys", `{{ keys .db | join "," }}`, "host,port"},
+		{"hasKey get", `{{ hasKey .db "port" }} {{ get .db "host" }}`, "true db.example.com"},
+		{"toJson", `{{ toJson .db }}`, `{"host":"db.example.com","port":5432}`},
+		{"toYaml", `{{ toYaml .db }}`, "host: db.example.com\nport: 5432"},
+		{"toToml", `{{ toToml .db }}`, "host = \"db.example.com\"\nport = 5432"},
+		{"base64", `{{ b64enc "hunter2" }} {{ b64enc "hunter2" | b64dec }}`, "aHVudGVyMg== hunter2"},
+		{"sha256sum", `{{ sha256sum "abc" }}`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"indent", `{{ "a\nb" | indent 2 }}`, "  a\n  b"},
+		{"nindent", `db:{{ toYaml .db | nindent 2 }}`, "db:\n  host: db.example.com\n  port: 5432"},
+		{"default empty", `{{ .empty | default "fallback" }}`, "fallback"},
+		{"default keeps zero values", `{{ .zero | default 8080 }} {{ .off | default true }}`, "0 false"},
+		{"default typed", `{{ printf "%d" (.empty | default 2) }}`, "2"},
+		{"coalesce", `{{ coalesce .empty .zero "x" }}`, "x"},
+		{"empty", `{{ empty .empty }} {{ empty .name }}`, "true false"},
+		{"required", `{{ required "need a name" .name }}`, "Caddy"},
+		{"iniEscape plain", `{{ iniEscape "value" }}`, "value"},
+		{"iniEscape quoted", `{{ iniEscape "a;b \"c\"" }}`, `"a;b \"c\""`},
+		{"quadletEscape", `{{ quadletEscape "100%\\n" }}`, `100%%\\n`},
+		{"quadletQuote", `Exec={{ quadletQuote .command }}`, `Exec="echo \"100%%\" \\ done"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := execute(t, tt.tmpl, vars)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := execute(t, `{{ required "need an image" .empty }}`, vars)
+	assert.ErrorContains(t, err, "need an image")
+	_, err = execute(t, `{{ join "," .name }}`, vars)
+	assert.Error(t, err)
+	_, err = execute(t, `{{ dict "a" }}`, vars)
+	assert.Error(t, err)
+}
+
+func TestDerivePassword(t *testing.T) {
+	a, err := derivePassword("seed", "postgres")
+	require.NoError(t, err)
+	assert.Len(t, a, defaultPasswordLength)
+	for _, c := range a {
+		assert.Contains(t, passwordAlphabet, string(c))
+	}
+
+	again, err := derivePassword("seed", "postgres")
+	require.NoError(t, err)
+	assert.Equal(t, a, again, "passwords should be deterministic")
+
+	other, err := derivePassword("seed", "redis")
+	require.NoError(t, err)
+	assert.NotEqual(t, a, other, "names should get different passwords")
+	reseeded, err := derivePassword("other seed", "postgres")
+	require.NoError(t, err)
+	assert.NotEqual(t, a, reseeded, "seeds should get different passwords")
+
+	short, err := derivePassword("seed", "postgres", 12)
+	require.NoError(t, err)
+	assert.Len(t, short, 12)
+
+	_, err = derivePassword("", "postgres")
+	assert.Error(t, err)
+	_, err = derivePassword("seed", "postgres", 0)
+	assert.Error(t, err)
+
+	got, err := execute(t, `{{ derivePassword .seed "postgres" 12 }}`, map[string]any{"seed": "seed"})
+	require.NoError(t, err)
+	assert.Equal(t, short, got)
+}
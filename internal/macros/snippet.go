@@ -1,9 +1,105 @@
 package macros
 
-import "text/template"
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	"primamateria.systems/materia/pkg/manifests"
+)
 
 type Snippet struct {
-	Name       string
-	Parameters []string
-	Body       *template.Template
+	Name        string
+	Description string
+	Parameters  []manifests.SnippetParameter
+	Source      string
+	Body        *template.Template
+}
+
+// SnippetFunc is the `snippet` template macro
+type SnippetFunc func(name string, args ...any) (string, error)
+
+func NewSnippet(c manifests.SnippetConfig) (*Snippet, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	body, err := template.New(c.Name).Option("missingkey=error").Funcs(Funcs()).Parse(c.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Snippet{
+		Name:        c.Name,
+		Description: c.Description,
+		Parameters:  c.Parameters,
+		Source:      c.Source,
+		Body:        body,
+	}, nil
+}
+
+// LoadSnippets creates snippets from their configs, keyed by name. Later configs replace earlier ones with the same name.
+func LoadSnippets(configs []manifests.SnippetConfig) (map[string]*Snippet, error) {
+	snippets := make(map[string]*Snippet, len(configs))
+	for _, c := range configs {
+		s, err := NewSnippet(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snippet %v from %v: %w", c.Name, c.Source, err)
+		}
+		snippets[s.Name] = s
+	}
+	return snippets, nil
+}
+
+func (s *Snippet) Config() manifests.SnippetConfig {
+	return manifests.SnippetConfig{
+		Name:        s.Name,
+		Description: s.Description,
+		Parameters:  s.Parameters,
+		Source:      s.Source,
+	}
+}
+
+// Execute renders the snippet with positional arguments, filling in defaults for optional parameters that weren't given
+func (s *Snippet) Execute(args ...any) (string, error) {
+	required := 0
+	for _, p := range s.Parameters {
+		if p.Required() {
+			required++
+		}
+	}
+	if len(args) < required || len(args) > len(s.Parameters) {
+		want := fmt.Sprint(len(s.Parameters))
+		if required != len(s.Parameters) {
+			want = fmt.Sprintf("%v to %v", required, len(s.Parameters))
+		}
+		return "", fmt.Errorf("snippet %v takes %v arguments, got %v: usage %v", s.Name, want, len(args), s.Config().Usage())
+	}
+	vars := make(map[string]any, len(s.Parameters))
+	for i, p := range s.Parameters {
+		switch {
+		case i < len(args):
+			vars[p.Name] = args[i]
+		case p.Default != nil:
+			vars[p.Name] = p.Default
+		default:
+			vars[p.Name] = ""
+		}
+	}
+	result := bytes.NewBuffer([]byte{})
+	if err := s.Body.Execute(result, vars); err != nil {
+		return "", err
+	}
+	return result.String(), nil
+}
+
+// NewSnippetFunc looks snippets up by name, falling back to parent for ones it doesn't have
+func NewSnippetFunc(snippets map[string]*Snippet, parent SnippetFunc) SnippetFunc {
+	return func(name string, args ...any) (string, error) {
+		if s, ok := snippets[name]; ok {
+			return s.Execute(args...)
+		}
+		if parent != nil {
+			return parent(name, args...)
+		}
+		return "", fmt.Errorf("snippet %v not found", name)
+	}
 }
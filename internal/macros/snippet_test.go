@@ -0,0 +1,92 @@
+package macros
+
+import (
+	"io"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"primamateria.systems/materia/pkg/manifests"
+)
+
+func TestSnippetExecute(t *testing.T) {
+	s, err := NewSnippet(manifests.SnippetConfig{
+		Name: "proxy",
+		Body: "{{ .host }}:{{ .port }}{{ .path }}",
+		Parameters: []manifests.SnippetParameter{
+			{Name: "host"},
+			{Name: "port", Default: int64(80)},
+			{Name: "path", Optional: true},
+		},
+	})
+	require.NoError(t, err)
+	tests := []struct {
+		name    string
+		args    []any
+		want    string
+		wantErr string
+	}{
+		{name: "defaults", args: []any{"web"}, want: "web:80"},
+		{name: "all args", args: []any{"web", 8080, "/api"}, want: "web:8080/api"},
+		{name: "missing required", args: nil, wantErr: "snippet proxy takes 1 to 3 arguments, got 0: usage proxy host [port=80] [path]"},
+		{name: "too many", args: []any{"web", 80, "/", "extra"}, wantErr: "got 4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Execute(tt.args...)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewSnippet(t *testing.T) {
+	_, err := NewSnippet(manifests.SnippetConfig{Name: "bad", Body: "{{ .x"})
+	assert.Error(t, err)
+	_, err = NewSnippet(manifests.SnippetConfig{
+		Name:       "order",
+		Body:       "",
+		Parameters: []manifests.SnippetParameter{{Name: "a", Optional: true}, {Name: "b"}},
+	})
+	assert.ErrorContains(t, err, "required parameter b after an optional one")
+	s, err := NewSnippet(manifests.SnippetConfig{Name: "funcs", Body: `{{ .name | upper }}`, Parameters: []manifests.SnippetParameter{{Name: "name"}}})
+	require.NoError(t, err)
+	got, err := s.Execute("web")
+	require.NoError(t, err)
+	assert.Equal(t, "WEB", got)
+}
+
+func TestSnippetFunc(t *testing.T) {
+	repo, err := LoadSnippets([]manifests.SnippetConfig{
+		{Name: "onBoot", Body: "builtin"},
+		{Name: "onBoot", Body: "repo"},
+		{Name: "shared", Body: "repo"},
+	})
+	require.NoError(t, err)
+	comp, err := LoadSnippets([]manifests.SnippetConfig{{Name: "shared", Body: "component"}})
+	require.NoError(t, err)
+	snippet := NewSnippetFunc(comp, NewSnippetFunc(repo, nil))
+
+	got, err := snippet("onBoot")
+	require.NoError(t, err)
+	assert.Equal(t, "repo", got)
+	got, err = snippet("shared")
+	require.NoError(t, err)
+	assert.Equal(t, "component", got)
+	_, err = snippet("missing")
+	assert.ErrorContains(t, err, "snippet missing not found")
+
+	needs, err := LoadSnippets([]manifests.SnippetConfig{{Name: "needs", Parameters: []manifests.SnippetParameter{{Name: "a"}}}})
+	require.NoError(t, err)
+	tmpl := template.Must(template.New("app.container.gotmpl").Funcs(template.FuncMap{
+		"snippet": NewSnippetFunc(needs, nil),
+	}).Parse("[Container]\n{{ snippet \"needs\" }}"))
+	err = tmpl.Execute(io.Discard, nil)
+	assert.ErrorContains(t, err, "app.container.gotmpl:2:3")
+	assert.ErrorContains(t, err, "snippet needs takes 1 arguments, got 0")
+}
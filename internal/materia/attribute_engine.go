@@ -3,8 +3,13 @@ package materia
 import (
 	"context"
 	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
 
 	"primamateria.systems/materia/internal/attributes"
+	"primamateria.systems/materia/pkg/source"
 )
 
 type AttributesEngine interface {
@@ -13,14 +18,20 @@ type AttributesEngine interface {
 
 type MultiVaultEngine struct {
 	vaults []AttributesEngine
+	merge  attributes.MergeStrategy
 }
 
 func NewMultiVaultEngine(vaults ...AttributesEngine) (*MultiVaultEngine, error) {
+	return NewMultiVaultEngineWithStrategy(attributes.MergeStrategy{}, vaults...)
+}
+
+func NewMultiVaultEngineWithStrategy(merge attributes.MergeStrategy, vaults ...AttributesEngine) (*MultiVaultEngine, error) {
 	if len(vaults) < 1 {
 		return nil, errors.New("need vaults for multivault engine")
 	}
 	return &MultiVaultEngine{
 		vaults: vaults,
+		merge:  merge,
 	}, nil
 }
 
@@ -32,15 +43,81 @@ func (m *MultiVaultEngine) AddVault(vault AttributesEngine) error {
 	return nil
 }
 
+// Lookup resolves every layer of every vault with the engine's merge strategy, so a deep merge combines tables
+// across engines as well as within them
 func (m *MultiVaultEngine) Lookup(ctx context.Context, filter attributes.AttributesFilter) (map[string]any, error) {
-	results := make(map[string]any)
-	// TODO there's definitely a better way of doing this and we'll burn that bridge when we get to it
-	for _, v := range m.vaults {
-		vaultResult, err := v.Lookup(ctx, filter)
+	t, err := m.Trace(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return t.Resolve(m.merge), nil
+}
+
+// Trace explains where each attribute came from. Earlier vaults win, matching Lookup.
+// Vaults that can't trace are recorded with their values only.
+func (m *MultiVaultEngine) Trace(ctx context.Context, filter attributes.AttributesFilter) (attributes.Trace, error) {
+	results := make(attributes.Trace)
+	for _, v := range slices.Backward(m.vaults) {
+		vaultTrace, err := TraceAttributes(ctx, v, filter)
 		if err != nil {
 			return nil, err
 		}
-		results = attributes.MergeAttributes(results, vaultResult)
+		results.Append(vaultTrace)
 	}
 	return results, nil
 }
+
+// Invalidate passes the source generation on to the vaults that cache
+func (m *MultiVaultEngine) Invalidate(generation string) error {
+	for _, v := range m.vaults {
+		if inv, ok := v.(attributes.Invalidator); ok {
+			if err := inv.Invalidate(generation); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// refreshAttributes tells the attributes engine which source generation is being planned, so cached vaults
+// are reused within it and reloaded once the sources change
+func (m *Materia) refreshAttributes() error {
+	inv, ok := m.Vault.(attributes.Invalidator)
+	if !ok {
+		return nil
+	}
+	if err := inv.Invalidate(sourceGeneration(m.Source.SyncReports())); err != nil {
+		return fmt.Errorf("unable to refresh attributes vaults: %w", err)
+	}
+	return nil
+}
+
+// sourceGeneration identifies the synced revision of every source. It's empty if any revision isn't known.
+func sourceGeneration(reports map[string]*source.SyncReport) string {
+	if len(reports) == 0 {
+		return ""
+	}
+	revisions := make([]string, 0, len(reports))
+	for _, name := range slices.Sorted(maps.Keys(reports)) {
+		r := reports[name]
+		if r == nil || r.NewRevision == "" {
+			return ""
+		}
+		revisions = append(revisions, fmt.Sprintf("%v@%v", name, r.NewRevision))
+	}
+	return strings.Join(revisions, ",")
+}
+
+// TraceAttributes traces an engine's attributes if it supports it, otherwise it only looks them up
+func TraceAttributes(ctx context.Context, engine AttributesEngine, filter attributes.AttributesFilter) (attributes.Trace, error) {
+	if tracer, ok := engine.(attributes.Tracer); ok {
+		return tracer.Trace(ctx, filter)
+	}
+	attrs, err := engine.Lookup(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	t := make(attributes.Trace)
+	t.AddAll(attrs, attributes.Provenance{Engine: "unknown", Secret: true})
+	return t, nil
+}
@@ -42,7 +42,7 @@ func (m *Materia) Execute(ctx context.Context, aplan *plan.Plan) (ExecutionRepor
 		}
 	}
 	if err != nil {
-		return ExecutionReport{}, err
+		return ExecutionReport{StepsCompleted: steps, Error: err}, err
 	}
 
 	return ExecutionReport{steps, false, nil}, nil
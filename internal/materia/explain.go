@@ -0,0 +1,151 @@
+package materia
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"primamateria.systems/materia/internal/attributes"
+	"primamateria.systems/materia/pkg/components"
+	"primamateria.systems/materia/pkg/manifests"
+)
+
+const redacted = "<redacted>"
+
+// AttributeExplanation is a resolved attribute, the value it resolved to and the values it overrode
+type AttributeExplanation struct {
+	Key      string                  `json:"key"`
+	Value    any                     `json:"value"`
+	Source   attributes.Provenance   `json:"source"`
+	Overrode []attributes.Provenance `json:"overrode,omitempty"`
+}
+
+// ExplainAttributes resolves the attributes a component would be templated with, including remote and component defaults,
+// and where each value came from
+func (m *Materia) ExplainAttributes(ctx context.Context, filter attributes.AttributesFilter) ([]AttributeExplanation, error) {
+	if err := m.refreshAttributes(); err != nil {
+		return nil, err
+	}
+	vaultTrace, err := TraceAttributes(ctx, m.Vault, filter)
+	if err != nil {
+		return nil, fmt.Errorf("unable to lookup attributes: %w", err)
+	}
+	exported, err := m.Source.ExportedAttributes()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load remote attribute defaults: %w", err)
+	}
+	var defaults map[string]any
+	t := make(attributes.Trace)
+	if filter.Component != "" {
+		defaults, err = m.traceComponentDefaults(t, filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(exported)) {
+		t.Add(name, attributes.Provenance{Engine: "remote", Source: name, Layer: "exported defaults", Value: exported[name]})
+	}
+	t.Append(vaultTrace)
+
+	// resolve the same way planning does so merged tables show their final value
+	resolved := withRemoteDefaults(m.merge, vaultTrace.Resolve(m.merge), exported)
+	resolved = m.merge.Merge(resolved, defaults)
+
+	results := make([]AttributeExplanation, 0, len(t))
+	for _, k := range t.Keys() {
+		ps := t[k]
+		results = append(results, AttributeExplanation{
+			Key:      k,
+			Value:    resolved[k],
+			Source:   ps[len(ps)-1],
+			Overrode: slices.Clone(ps[:len(ps)-1]),
+		})
+	}
+	return results, nil
+}
+
+// traceComponentDefaults records a component's manifest defaults, as changed by the host's overrides and extensions
+func (m *Materia) traceComponentDefaults(t attributes.Trace, filter attributes.AttributesFilter) (map[string]any, error) {
+	man, err := m.Source.GetManifest(components.NewComponent(filter.Component))
+	if err != nil {
+		return nil, fmt.Errorf("can't load component %v manifest: %w", filter.Component, err)
+	}
+	origin := attributes.Provenance{Engine: "manifest", Source: filter.Component, Layer: "component defaults"}
+	defaults := man.Defaults
+	override, err := m.Manifest.GetComponentOverride(filter.Hostname, filter.Component)
+	if err != nil && !errors.Is(err, manifests.ErrComponentNotAssignedToHost) {
+		return nil, fmt.Errorf("unable to get component overrides: %w", err)
+	}
+	if override != nil && len(override.Defaults) > 0 {
+		defaults = override.Defaults
+		origin.Layer = fmt.Sprintf("host %v override", filter.Hostname)
+	}
+	t.AddAll(defaults, origin)
+	result := maps.Clone(defaults)
+	extension, err := m.Manifest.GetComponentExtension(filter.Hostname, filter.Component)
+	if err != nil && !errors.Is(err, manifests.ErrComponentNotAssignedToHost) {
+		return nil, fmt.Errorf("unable to get component extensions: %w", err)
+	}
+	if extension != nil && len(extension.Defaults) > 0 {
+		origin.Layer = fmt.Sprintf("host %v extension", filter.Hostname)
+		t.AddAll(extension.Defaults, origin)
+		result = m.merge.Merge(maps.Clone(extension.Defaults), result)
+	}
+	return result, nil
+}
+
+// Redacted masks secret values. The resolved value is masked if any layer is secret, since a deep merge can carry a
+// secret table entry into a value whose winning layer isn't.
+func (a AttributeExplanation) Redacted() AttributeExplanation {
+	r := a
+	if r.Source.Secret || slices.ContainsFunc(a.Overrode, func(p attributes.Provenance) bool { return p.Secret }) {
+		r.Value = redacted
+	}
+	if r.Source.Secret {
+		r.Source.Value = redacted
+	}
+	r.Overrode = make([]attributes.Provenance, len(a.Overrode))
+	for i, p := range a.Overrode {
+		if p.Secret {
+			p.Value = redacted
+		}
+		r.Overrode[i] = p
+	}
+	return r
+}
+
+func FormatAttributes(explained []AttributeExplanation) string {
+	var result strings.Builder
+	for _, a := range explained {
+		fmt.Fprintf(&result, "%v = %v\n", a.Key, formatValue(a.Value))
+		fmt.Fprintf(&result, "    from %v\n", formatProvenance(a.Source))
+		for _, p := range slices.Backward(a.Overrode) {
+			fmt.Fprintf(&result, "    overrides %v from %v\n", formatValue(p.Value), formatProvenance(p))
+		}
+	}
+	return result.String()
+}
+
+func formatProvenance(p attributes.Provenance) string {
+	if p.Source == "" {
+		return fmt.Sprintf("%v (%v)", p.Layer, p.Engine)
+	}
+	return fmt.Sprintf("%v in %v (%v)", p.Layer, p.Source, p.Engine)
+}
+
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "<not loaded>"
+	case string:
+		if v == redacted {
+			return v
+		}
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
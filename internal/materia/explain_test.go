@@ -0,0 +1,30 @@
+package materia
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"primamateria.systems/materia/internal/attributes"
+)
+
+func TestAttributeExplanation_Redacted(t *testing.T) {
+	secret := attributes.Provenance{Engine: "sops", Layer: "global", Secret: true, Value: map[string]any{"password": "hunter2"}}
+	plain := attributes.Provenance{Engine: "file", Layer: "host web01", Value: map[string]any{"user": "app"}}
+
+	a := AttributeExplanation{Key: "db", Value: map[string]any{"user": "app", "password": "hunter2"}, Source: plain, Overrode: []attributes.Provenance{secret}}
+	r := a.Redacted()
+	assert.Equal(t, redacted, r.Value, "a secret lower layer can be merged into the value")
+	assert.Equal(t, plain, r.Source)
+	assert.Equal(t, redacted, r.Overrode[0].Value)
+	assert.Equal(t, secret.Value, a.Overrode[0].Value)
+
+	a = AttributeExplanation{Key: "db", Value: "hunter2", Source: secret, Overrode: []attributes.Provenance{plain}}
+	r = a.Redacted()
+	assert.Equal(t, redacted, r.Value)
+	assert.Equal(t, redacted, r.Source.Value)
+	assert.Equal(t, plain, r.Overrode[0])
+
+	r = AttributeExplanation{Key: "user", Value: "app", Source: plain}.Redacted()
+	assert.Equal(t, "app", r.Value)
+	assert.Equal(t, plain, r.Source)
+}
@@ -32,6 +32,15 @@ func (m *Materia) GetFacts(host bool) string {
 			result += fmt.Sprintf("%v ", v)
 		}
 	}
+	if versions := m.Source.RemoteVersions(); len(versions) > 0 {
+		result += "\nRemote Versions: "
+		for _, v := range versions {
+			result += fmt.Sprintf("\nRemote %v: %v (%v)", v.Name, v.Version, v.Constraint)
+			if v.Newer != "" {
+				result += fmt.Sprintf(", %v available", v.Newer)
+			}
+		}
+	}
 	result += "\nNetworks: "
 	for i, v := range m.Host.GetInterfaces() {
 		result += fmt.Sprintf("\nInterface %v: %v", i, v)
@@ -0,0 +1,35 @@
+package materia
+
+import (
+	"errors"
+	"fmt"
+
+	"primamateria.systems/materia/pkg/history"
+)
+
+// NewRun starts a run record for the given trigger, capturing the revisions of the last source sync
+func (m *Materia) NewRun(trigger string) *history.Record {
+	run := history.NewRecord(trigger)
+	run.SetRevisions(m.Source.SyncReports())
+	return run
+}
+
+func (m *Materia) SaveRun(run *history.Record) error {
+	if m.History == nil {
+		return nil
+	}
+	if err := m.History.Save(run); err != nil {
+		return fmt.Errorf("unable to save run to history: %w", err)
+	}
+	return nil
+}
+
+// RecordExecution stores the outcome of an execution in a run record
+func RecordExecution(run *history.Record, rep ExecutionReport, err error) {
+	run.StepsCompleted = rep.StepsCompleted
+	if errors.Is(err, ErrNeedRollback) {
+		run.AddError(rep.Error)
+		return
+	}
+	run.AddError(err)
+}
@@ -16,13 +16,17 @@ import (
 	"github.com/sergi/go-diff/diffmatchpatch"
 	"primamateria.systems/materia/internal/attributes"
 	"primamateria.systems/materia/internal/attributes/age"
+	"primamateria.systems/materia/internal/attributes/creds"
+	execattrs "primamateria.systems/materia/internal/attributes/exec"
 	fileattrs "primamateria.systems/materia/internal/attributes/file"
 	"primamateria.systems/materia/internal/attributes/mem"
 	"primamateria.systems/materia/internal/attributes/sops"
+	vaultattrs "primamateria.systems/materia/internal/attributes/vault"
 	"primamateria.systems/materia/internal/macros"
 	"primamateria.systems/materia/pkg/actions"
 	"primamateria.systems/materia/pkg/components"
 	"primamateria.systems/materia/pkg/executor"
+	"primamateria.systems/materia/pkg/history"
 	"primamateria.systems/materia/pkg/loader"
 	"primamateria.systems/materia/pkg/lock"
 	"primamateria.systems/materia/pkg/manifests"
@@ -39,20 +43,30 @@ type Materia struct {
 	Executor       *executor.Executor
 	Planner        *planner.Planner
 	Notifier       *notify.Notifier
+	History        *history.History
 	Vault          AttributesEngine
 	Hostname       string
 	Roles          []string
 	Lock           Locker
 	Rollback       bool
-	macros         macros.MacroMap
+	macros         func(refs *componentRefs) macros.MacroMap
 	snippets       map[string]*macros.Snippet
 	OutputDir      string
 	defaultTimeout int
 	appMode        bool
 	debug          bool
+	merge          attributes.MergeStrategy
 }
 
-func setupVault(c *MateriaConfig) (AttributesEngine, error) {
+func NewAttributesEngine(c *MateriaConfig) (AttributesEngine, error) {
+	merge, err := c.MergeStrategy()
+	if err != nil {
+		return nil, err
+	}
+	// a single engine still goes through the multivault engine so its layers are merged with the configured strategy
+	single := func(vault AttributesEngine) (AttributesEngine, error) {
+		return NewMultiVaultEngineWithStrategy(merge, vault)
+	}
 	var vaults []AttributesEngine
 	if c.AgeConfig != nil {
 		vault, err := age.NewAgeStore(*c.AgeConfig, c.SourceDir)
@@ -60,7 +74,7 @@ func setupVault(c *MateriaConfig) (AttributesEngine, error) {
 			return nil, fmt.Errorf("error creating age store: %w", err)
 		}
 		if c.Attributes == "age" {
-			return vault, nil
+			return single(vault)
 		}
 		vaults = append(vaults, vault)
 	}
@@ -71,7 +85,7 @@ func setupVault(c *MateriaConfig) (AttributesEngine, error) {
 		}
 
 		if c.Attributes == "file" {
-			return vault, nil
+			return single(vault)
 		}
 		vaults = append(vaults, vault)
 	}
@@ -81,20 +95,50 @@ func setupVault(c *MateriaConfig) (AttributesEngine, error) {
 			return nil, fmt.Errorf("error creating sops store: %w", err)
 		}
 		if c.Attributes == "sops" {
-			return vault, nil
+			return single(vault)
 		}
 
 		vaults = append(vaults, vault)
 	}
+	if c.VaultConfig != nil {
+		vault, err := vaultattrs.NewVaultStore(*c.VaultConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error creating vault store: %w", err)
+		}
+		if c.Attributes == "vault" {
+			return single(vault)
+		}
+		vaults = append(vaults, vault)
+	}
+	if c.CredsConfig != nil {
+		vault, err := creds.NewCredsStore(*c.CredsConfig, c.SourceDir)
+		if err != nil {
+			return nil, fmt.Errorf("error creating systemd credentials store: %w", err)
+		}
+		if c.Attributes == "creds" {
+			return single(vault)
+		}
+		vaults = append(vaults, vault)
+	}
+	if c.ExecConfig != nil {
+		vault, err := execattrs.NewExecStore(*c.ExecConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error creating exec store: %w", err)
+		}
+		if c.Attributes == "exec" {
+			return single(vault)
+		}
+		vaults = append(vaults, vault)
+	}
 	if len(vaults) == 0 {
 		log.Warn("No attributes engines configured: defaulting to in-memory")
 		return mem.NewMemoryEngine(), nil
 	}
-	return NewMultiVaultEngine(vaults...)
+	return NewMultiVaultEngineWithStrategy(merge, vaults...)
 }
 
 func NewMateriaFromConfig(ctx context.Context, c *MateriaConfig, hm HostManager, sm SourceManager) (*Materia, error) {
-	vault, err := setupVault(c)
+	vault, err := NewAttributesEngine(c)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create attributes engine: %w", err)
 	}
@@ -106,12 +150,10 @@ func NewMateria(ctx context.Context, c *MateriaConfig, hm HostManager, attribute
 	if err := c.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid materia config: %w", err)
 	}
-	snips := make(map[string]*macros.Snippet)
-	defaultSnippets := loadDefaultSnippets()
-	for _, v := range defaultSnippets {
-		snips[v.Name] = v
+	merge, err := c.MergeStrategy()
+	if err != nil {
+		return nil, err
 	}
-
 	man, err := srcman.LoadManifest(manifests.MateriaManifestFile)
 	if err != nil {
 		return nil, fmt.Errorf("error loading manifest: %w", err)
@@ -119,23 +161,18 @@ func NewMateria(ctx context.Context, c *MateriaConfig, hm HostManager, attribute
 	if err := man.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid materia manifest: %w", err)
 	}
-	for _, v := range man.Snippets {
-		s, err := configToSnippet(v)
-		if err != nil {
-			return nil, fmt.Errorf("can't generate snippet %v from config: %w", v.Name, err)
-		}
-		snips[s.Name] = s
+	// the repository's snippets replace the builtin ones with the same name
+	snips, err := macros.LoadSnippets(append(loadDefaultSnippets(), man.Snippets...))
+	if err != nil {
+		return nil, err
 	}
 	name := c.Hostname
 	if name == "" {
 		name = hm.GetHostname()
 	}
-	roles := c.Roles
-	if len(roles) == 0 {
-		roles, err = getRolesFromManifest(man, name)
-		if err != nil {
-			return nil, fmt.Errorf("unable to load roles form manifest: %w", err)
-		}
+	roles, err := HostRoles(c, man, name)
+	if err != nil {
+		return nil, err
 	}
 	pc := planner.PlannerConfig{
 		BackupVolumes: true,
@@ -185,6 +222,14 @@ func NewMateria(ctx context.Context, c *MateriaConfig, hm HostManager, attribute
 	if c.RollbackConfig != nil {
 		rollback = c.RollbackConfig.Kind != ""
 	}
+	hc := history.DefaultHistoryConfig()
+	if c.HistoryConfig != nil {
+		hc = c.HistoryConfig
+	}
+	hist, err := history.NewHistory(filepath.Join(c.OutputDir, "history"), hc.Retention)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create run history: %w", err)
+	}
 
 	return &Materia{
 		Host:           hm,
@@ -196,14 +241,18 @@ func NewMateria(ctx context.Context, c *MateriaConfig, hm HostManager, attribute
 		OutputDir:      c.OutputDir,
 		appMode:        c.AppMode,
 		snippets:       snips,
-		macros:         loadDefaultMacros(c, hm, snips),
-		Executor:       e,
-		Planner:        p,
-		Notifier:       n,
-		Hostname:       name,
-		Roles:          roles,
-		Lock:           l,
-		Rollback:       rollback,
+		macros: func(refs *componentRefs) macros.MacroMap {
+			return loadDefaultMacros(c, hm, snips, refs)
+		},
+		Executor: e,
+		Planner:  p,
+		Notifier: n,
+		History:  hist,
+		Hostname: name,
+		Roles:    roles,
+		Lock:     l,
+		Rollback: rollback,
+		merge:    merge,
 	}, nil
 }
 
@@ -227,16 +276,20 @@ func (m *Materia) unlock() {
 }
 
 func (m *Materia) GetAssignedComponents() ([]string, error) {
+	return m.assignedComponents(m.Hostname, m.Roles)
+}
+
+func (m *Materia) assignedComponents(hostname string, roles []string) ([]string, error) {
 	var assignedComponents []string
 	hostComps, ok := m.Manifest.Hosts["all"]
 	if ok {
 		assignedComponents = append(assignedComponents, hostComps.Components...)
 	}
-	hostComps, ok = m.Manifest.Hosts[m.Hostname]
+	hostComps, ok = m.Manifest.Hosts[hostname]
 	if ok {
 		assignedComponents = append(assignedComponents, hostComps.Components...)
 	}
-	for _, v := range m.Roles {
+	for _, v := range roles {
 		if len(m.Manifest.Roles[v].Components) != 0 {
 			assignedComponents = append(assignedComponents, m.Manifest.Roles[v].Components...)
 		}
@@ -245,6 +298,18 @@ func (m *Materia) GetAssignedComponents() ([]string, error) {
 	return assignedComponents, nil
 }
 
+// HostRoles returns the configured roles, or the roles the manifest gives hostname if none are configured
+func HostRoles(c *MateriaConfig, man *manifests.MateriaManifest, hostname string) ([]string, error) {
+	if len(c.Roles) > 0 {
+		return c.Roles, nil
+	}
+	roles, err := getRolesFromManifest(man, hostname)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load roles form manifest: %w", err)
+	}
+	return roles, nil
+}
+
 func getRolesFromManifest(man *manifests.MateriaManifest, hostname string) ([]string, error) {
 	var roles []string
 	if man.RoleCommand != "" {
@@ -333,6 +398,9 @@ func (m *Materia) Plan(ctx context.Context) (*plan.Plan, error) {
 		return nil, fmt.Errorf("unable to get materia dbus lock: %v", err)
 	}
 	defer m.unlock()
+	if err := m.refreshAttributes(); err != nil {
+		return nil, err
+	}
 	log.Debug("determining installed components")
 	installedNames, err := m.Host.ListInstalledComponents()
 	if err != nil {
@@ -343,6 +411,9 @@ func (m *Materia) Plan(ctx context.Context) (*plan.Plan, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to determine assigned component names: %w", err)
 	}
+	if err := m.Source.SetComponents(ctx, assignedNames); err != nil {
+		return nil, fmt.Errorf("unable to update sparse checkout: %w", err)
+	}
 	hostPipeline := loader.NewHostComponentPipeline(m.Host, m.Host)
 	installedComponents := make([]*components.Component, 0, len(installedNames))
 	for _, n := range installedNames {
@@ -353,55 +424,118 @@ func (m *Materia) Plan(ctx context.Context) (*plan.Plan, error) {
 		}
 		installedComponents = append(installedComponents, hostComponent)
 	}
-	assignedComponents := make([]*components.Component, 0, len(assignedNames))
-	for _, n := range assignedNames {
-		sourceComponent := components.NewComponent(n)
-		attrs, err := m.Vault.Lookup(ctx, attributes.AttributesFilter{
-			Hostname:  m.Hostname,
-			Roles:     m.Roles,
-			Component: sourceComponent.Name,
-			Instance:  sourceComponent.Instance,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("unable to lookup attributes for %v:, %w", n, err)
-		}
-		overrides := make([]*manifests.ComponentManifest, 0)
-		override, err := m.Manifest.GetComponentOverride(m.Hostname, n)
-		if err != nil && !errors.Is(err, manifests.ErrComponentNotAssignedToHost) {
-			return nil, fmt.Errorf("unable to get component overrides: %w", err)
-		}
-		if override != nil {
-			overrides = append(overrides, override)
+	exported, err := m.Source.ExportedAttributes()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load remote attribute defaults: %w", err)
+	}
+	assignedComponents, err := m.loadSourceComponents(ctx, assignedNames, assignedNames, m.Hostname, m.Roles, exported, false)
+	if err != nil {
+		return nil, err
+	}
+
+	actionPlan, err := m.Planner.Plan(ctx, m.Hostname, installedComponents, assignedComponents)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate plan: %w", err)
+	}
+	for _, v := range m.Source.RemoteVersions() {
+		if v.Version != "" {
+			actionPlan.AddNote(fmt.Sprintf("remote %v resolved to %v (%v)", v.Name, v.Version, v.Constraint))
 		}
-		extensions := make([]*manifests.ComponentManifest, 0)
-		extension, err := m.Manifest.GetComponentExtension(m.Hostname, n)
-		if err != nil && !errors.Is(err, manifests.ErrComponentNotAssignedToHost) {
-			return nil, fmt.Errorf("unable to get component extensions: %w", err)
+		if v.Newer != "" {
+			warning := fmt.Sprintf("remote %v has a newer version %v outside its constraint %v", v.Name, v.Newer, v.Constraint)
+			log.Warn(warning)
+			actionPlan.AddWarning(warning)
 		}
-		if extension != nil {
-			extensions = append(extensions, extension)
+	}
+	for _, d := range m.Source.RemoteDrift() {
+		warning := fmt.Sprintf("remote %v is locked to %v but its source is at %v", d.Name, d.Locked, d.Latest)
+		log.Warn(warning)
+		actionPlan.AddWarning(warning)
+	}
+	planValidator := plan.NewDefaultValidationPipeline(installedNames)
+	return actionPlan, planValidator.Validate(actionPlan)
+}
+
+// loadSourceComponents loads the named components from the source for a host. Their templates can reference any of
+// the assigned components, which are loaded as they're needed. With redact set, secret attributes are templated as placeholders.
+func (m *Materia) loadSourceComponents(ctx context.Context, names, assigned []string, hostname string, roles []string, exported map[string]map[string]any, redact bool) ([]*components.Component, error) {
+	var refs *componentRefs
+	refs = newComponentRefs(hostname, assigned, func(n string) (*componentRef, error) {
+		return m.loadSourceComponent(ctx, refs, n, hostname, roles, exported, redact)
+	})
+	result := make([]*components.Component, 0, len(names))
+	for _, n := range names {
+		ref, err := refs.get(n)
+		if err != nil {
+			return nil, err
 		}
+		result = append(result, ref.component)
+	}
+	return result, nil
+}
 
-		sourcePipeline := loader.NewSourceComponentPipeline(m.Source, m.macros, attrs, overrides, extensions)
-		if m.appMode {
-			err = sourcePipeline.AddStage(&loader.AppCompatibilityStage{})
-			if err != nil {
-				return nil, fmt.Errorf("unable to enable quadlet appfile compatibility mode: %w", err)
-			}
+// loadSourceComponent loads and templates an assigned component from the source for a host, resolving its references with refs
+func (m *Materia) loadSourceComponent(ctx context.Context, refs *componentRefs, n, hostname string, roles []string, exported map[string]map[string]any, redact bool) (*componentRef, error) {
+	sourceComponent := components.NewComponent(n)
+	filter := attributes.AttributesFilter{
+		Hostname:  hostname,
+		Roles:     roles,
+		Component: sourceComponent.Name,
+		Instance:  sourceComponent.Instance,
+	}
+	var attrs map[string]any
+	var err error
+	if redact {
+		var trace attributes.Trace
+		trace, err = TraceAttributes(ctx, m.Vault, filter)
+		if err == nil {
+			attrs = redactedTrace(trace).Resolve(m.merge)
 		}
-		err = sourcePipeline.Load(ctx, sourceComponent)
+	} else {
+		attrs, err = m.Vault.Lookup(ctx, filter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to lookup attributes for %v:, %w", n, err)
+	}
+	attrs = withRemoteDefaults(m.merge, attrs, exported)
+	overrides := make([]*manifests.ComponentManifest, 0)
+	override, err := m.Manifest.GetComponentOverride(hostname, n)
+	if err != nil && !errors.Is(err, manifests.ErrComponentNotAssignedToHost) {
+		return nil, fmt.Errorf("unable to get component overrides: %w", err)
+	}
+	if override != nil {
+		overrides = append(overrides, override)
+	}
+	extensions := make([]*manifests.ComponentManifest, 0)
+	extension, err := m.Manifest.GetComponentExtension(hostname, n)
+	if err != nil && !errors.Is(err, manifests.ErrComponentNotAssignedToHost) {
+		return nil, fmt.Errorf("unable to get component extensions: %w", err)
+	}
+	if extension != nil {
+		extensions = append(extensions, extension)
+	}
+
+	sourcePipeline := loader.NewSourceComponentPipeline(m.Source, m.macros(refs), attrs, m.merge, overrides, extensions)
+	if m.appMode {
+		err = sourcePipeline.AddStage(&loader.AppCompatibilityStage{})
 		if err != nil {
-			return nil, fmt.Errorf("error loading source component %v: %w", n, err)
+			return nil, fmt.Errorf("unable to enable quadlet appfile compatibility mode: %w", err)
 		}
-		assignedComponents = append(assignedComponents, sourceComponent)
 	}
-
-	actionPlan, err := m.Planner.Plan(ctx, m.Hostname, installedComponents, assignedComponents)
+	err = sourcePipeline.Load(ctx, sourceComponent)
 	if err != nil {
-		return nil, fmt.Errorf("unable to generate plan: %w", err)
+		return nil, fmt.Errorf("error loading source component %v: %w", n, err)
+	}
+	vars := m.merge.Merge(attrs, sourceComponent.Defaults)
+	published := make(map[string]any, len(sourceComponent.Publish))
+	for _, k := range sourceComponent.Publish {
+		v, ok := vars[k]
+		if !ok {
+			return nil, fmt.Errorf("component %v publishes attribute %v but it isn't set", n, k)
+		}
+		published[k] = v
 	}
-	planValidator := plan.NewDefaultValidationPipeline(installedNames)
-	return actionPlan, planValidator.Validate(actionPlan)
+	return &componentRef{component: sourceComponent, published: published}, nil
 }
 
 func (m *Materia) PlanComponent(ctx context.Context, name string, roles []string) (*plan.Plan, error) {
@@ -409,6 +543,9 @@ func (m *Materia) PlanComponent(ctx context.Context, name string, roles []string
 		return nil, errors.New("need component name or roles to plan")
 	}
 
+	if err := m.refreshAttributes(); err != nil {
+		return nil, err
+	}
 	attrs, err := m.Vault.Lookup(ctx, attributes.AttributesFilter{
 		Hostname:  m.Hostname,
 		Roles:     roles,
@@ -417,6 +554,11 @@ func (m *Materia) PlanComponent(ctx context.Context, name string, roles []string
 	if err != nil {
 		return nil, fmt.Errorf("unable to lookup attributes: %w", err)
 	}
+	exported, err := m.Source.ExportedAttributes()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load remote attribute defaults: %w", err)
+	}
+	attrs = withRemoteDefaults(m.merge, attrs, exported)
 
 	overrides := make([]*manifests.ComponentManifest, 0)
 	override, err := m.Manifest.GetComponentOverride(m.Hostname, name)
@@ -434,7 +576,15 @@ func (m *Materia) PlanComponent(ctx context.Context, name string, roles []string
 	if extension != nil {
 		extensions = append(extensions, extension)
 	}
-	sourcePipeline := loader.NewSourceComponentPipeline(m.Source, m.macros, attrs, overrides, extensions)
+	assigned, err := m.assignedComponents(m.Hostname, roles)
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine assigned component names: %w", err)
+	}
+	var refs *componentRefs
+	refs = newComponentRefs(m.Hostname, assigned, func(n string) (*componentRef, error) {
+		return m.loadSourceComponent(ctx, refs, n, m.Hostname, roles, exported, false)
+	})
+	sourcePipeline := loader.NewSourceComponentPipeline(m.Source, m.macros(refs), attrs, m.merge, overrides, extensions)
 	sourceComponent := components.NewComponent(name)
 	err = sourcePipeline.Load(ctx, sourceComponent)
 	if err != nil {
@@ -523,3 +673,11 @@ func (m *Materia) Close() error {
 	}
 	return nil
 }
+
+// withRemoteDefaults adds the attribute defaults exported by remotes under their names, below the repository's own attributes
+func withRemoteDefaults(merge attributes.MergeStrategy, attrs map[string]any, exported map[string]map[string]any) map[string]any {
+	for name, defaults := range exported {
+		attrs = merge.MergeNamespaced(attrs, name, defaults)
+	}
+	return attrs
+}
@@ -8,11 +8,16 @@ import (
 	"path/filepath"
 
 	"github.com/knadh/koanf/v2"
+	"primamateria.systems/materia/internal/attributes"
 	"primamateria.systems/materia/internal/attributes/age"
+	"primamateria.systems/materia/internal/attributes/creds"
+	execattrs "primamateria.systems/materia/internal/attributes/exec"
 	fileattrs "primamateria.systems/materia/internal/attributes/file"
 	"primamateria.systems/materia/internal/attributes/sops"
+	vaultattrs "primamateria.systems/materia/internal/attributes/vault"
 	"primamateria.systems/materia/pkg/containers"
 	"primamateria.systems/materia/pkg/executor"
+	"primamateria.systems/materia/pkg/history"
 	"primamateria.systems/materia/pkg/notify"
 	"primamateria.systems/materia/pkg/planner"
 	"primamateria.systems/materia/pkg/services"
@@ -48,16 +53,22 @@ type MateriaConfig struct {
 	AppMode          bool                         `toml:"appmode"`
 	Rootless         bool                         `toml:"rootless"`
 	Attributes       string                       `toml:"attributes"`
+	AttributesMerge  string                       `toml:"attributes_merge"`
+	AttributesLists  string                       `toml:"attributes_lists"`
 	CommandPodman    bool                         `toml:"podman_command"`
 	AgeConfig        *age.Config                  `toml:"age"`
 	FileConfig       *fileattrs.Config            `toml:"file"`
 	SopsConfig       *sops.Config                 `toml:"sops"`
+	VaultConfig      *vaultattrs.Config           `toml:"vault"`
+	CredsConfig      *creds.Config                `toml:"creds"`
+	ExecConfig       *execattrs.Config            `toml:"exec"`
 	PlannerConfig    *planner.PlannerConfig       `toml:"planner"`
 	ExecutorConfig   *executor.ExecutorConfig     `toml:"executor"`
 	ServicesConfig   *services.ServicesConfig     `toml:"services"`
 	ContainersConfig *containers.ContainersConfig `toml:"containers"`
 	NotifyConfig     *notify.NotifyConfig         `toml:"notify"`
 	RollbackConfig   *RollbackConfig              `toml:"rollback"`
+	HistoryConfig    *history.HistoryConfig       `toml:"history"`
 	User             *user.User
 }
 
@@ -70,6 +81,8 @@ func NewConfig(k *koanf.Koanf) (*MateriaConfig, error) {
 	c.Roles = k.Strings("roles")
 
 	c.Attributes = k.String("attributes")
+	c.AttributesMerge = k.String("attributes_merge")
+	c.AttributesLists = k.String("attributes_lists")
 	c.UseStdout = k.Bool("use_stdout")
 	c.MateriaDir = k.String("materia_dir")
 	c.QuadletDir = k.String("quadlet_dir")
@@ -98,6 +111,24 @@ func NewConfig(k *koanf.Koanf) (*MateriaConfig, error) {
 			return nil, err
 		}
 	}
+	if k.Exists("vault") || c.Attributes == "vault" {
+		c.VaultConfig, err = vaultattrs.NewConfig(k)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if k.Exists("creds") || c.Attributes == "creds" {
+		c.CredsConfig, err = creds.NewConfig(k)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if k.Exists("exec") || c.Attributes == "exec" {
+		c.ExecConfig, err = execattrs.NewConfig(k)
+		if err != nil {
+			return nil, err
+		}
+	}
 	c.ServicesConfig, err = services.NewServicesConfig(k)
 	if err != nil {
 		return nil, err
@@ -123,6 +154,10 @@ func NewConfig(k *koanf.Koanf) (*MateriaConfig, error) {
 	if err != nil {
 		return nil, err
 	}
+	c.HistoryConfig, err = history.NewHistoryConfig(k)
+	if err != nil {
+		return nil, err
+	}
 	currentUser, err := user.Current()
 	if err != nil {
 		return nil, err
@@ -206,6 +241,9 @@ func (c *MateriaConfig) Validate() error {
 	if c.SourceDir == "" {
 		return errors.New("need source directory")
 	}
+	if _, err := c.MergeStrategy(); err != nil {
+		return err
+	}
 	if c.PlannerConfig != nil {
 		if err := c.PlannerConfig.Validate(); err != nil {
 			return fmt.Errorf("invalid planner config: %w", err)
@@ -221,9 +259,18 @@ func (c *MateriaConfig) Validate() error {
 			return fmt.Errorf("invalid rollback config: %w", err)
 		}
 	}
+	if c.HistoryConfig != nil {
+		if err := c.HistoryConfig.Validate(); err != nil {
+			return fmt.Errorf("invalid history config: %w", err)
+		}
+	}
 	return nil
 }
 
+func (c *MateriaConfig) MergeStrategy() (attributes.MergeStrategy, error) {
+	return attributes.NewMergeStrategy(c.AttributesMerge, c.AttributesLists)
+}
+
 func (c *MateriaConfig) String() string {
 	var result string
 	result += "Materia Config\n"
@@ -254,6 +301,10 @@ func (c *MateriaConfig) String() string {
 		result += "Rollback mode: None\n"
 	}
 	result += fmt.Sprintf("Rootless mode: %v\n", c.Rootless)
+	if c.HistoryConfig != nil {
+		result += "\nHistory Config: \n"
+		result += fmt.Sprintf("%v", c.HistoryConfig.String())
+	}
 	if c.ContainersConfig != nil {
 		result += "\nContainers Config: \n"
 		result += fmt.Sprintf("%v", c.ContainersConfig.String())
@@ -274,6 +325,9 @@ func (c *MateriaConfig) String() string {
 	if c.Attributes != "" {
 		result += fmt.Sprintf("Manually Specified Engine: %v\n", c.Attributes)
 	}
+	if merge, err := c.MergeStrategy(); err == nil {
+		result += fmt.Sprintf("Merge Strategy: %v\n", merge)
+	}
 	if c.AgeConfig != nil {
 		result += "\nAge Config: \n"
 		result += fmt.Sprintf("%v", c.AgeConfig.String())
@@ -286,6 +340,18 @@ func (c *MateriaConfig) String() string {
 		result += "\nSops Config: \n"
 		result += fmt.Sprintf("%v", c.SopsConfig.String())
 	}
+	if c.VaultConfig != nil {
+		result += "\nVault Config: \n"
+		result += fmt.Sprintf("%v", c.VaultConfig.String())
+	}
+	if c.CredsConfig != nil {
+		result += "\nCreds Config: \n"
+		result += fmt.Sprintf("%v", c.CredsConfig.String())
+	}
+	if c.ExecConfig != nil {
+		result += "\nExec Config: \n"
+		result += fmt.Sprintf("%v", c.ExecConfig.String())
+	}
 
 	return result
 }
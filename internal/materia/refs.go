@@ -0,0 +1,110 @@
+package materia
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"primamateria.systems/materia/pkg/components"
+)
+
+// componentRefs loads the components assigned to a host on demand, so a component's templates can reference the
+// resolved host objects, services and published attributes of another
+type componentRefs struct {
+	hostname string
+	assigned []string
+	load     func(name string) (*componentRef, error)
+	loaded   map[string]*componentRef
+	loading  []string
+}
+
+type componentRef struct {
+	component *components.Component
+	// published are the attributes the component lists in its manifest's Publish
+	published map[string]any
+}
+
+// newComponentRefs starts resolving references between the components assigned to a host. Each plan or render
+// gets its own so concurrent calls don't share loaded components.
+func newComponentRefs(hostname string, assigned []string, load func(name string) (*componentRef, error)) *componentRefs {
+	return &componentRefs{
+		hostname: hostname,
+		assigned: assigned,
+		load:     load,
+		loaded:   make(map[string]*componentRef),
+	}
+}
+
+func (r *componentRefs) get(name string) (*componentRef, error) {
+	if r == nil {
+		return nil, fmt.Errorf("can't reference component %v outside of planning", name)
+	}
+	if ref, ok := r.loaded[name]; ok {
+		return ref, nil
+	}
+	if slices.Contains(r.loading, name) {
+		return nil, fmt.Errorf("circular component reference: %v -> %v", strings.Join(r.loading, " -> "), name)
+	}
+	if !slices.Contains(r.assigned, name) {
+		return nil, fmt.Errorf("referenced component %v isn't assigned to %v", name, r.hostname)
+	}
+	r.loading = append(r.loading, name)
+	defer func() { r.loading = r.loading[:len(r.loading)-1] }()
+	ref, err := r.load(name)
+	if err != nil {
+		return nil, err
+	}
+	r.loaded[name] = ref
+	return ref, nil
+}
+
+func (r *componentRefs) resource(name, path string) (components.Resource, error) {
+	ref, err := r.get(name)
+	if err != nil {
+		return components.Resource{}, err
+	}
+	res, err := ref.component.Resources.Get(ref.component.Instantiate(path))
+	if err != nil {
+		return components.Resource{}, fmt.Errorf("component %v has no resource %v", name, path)
+	}
+	return res, nil
+}
+
+// hostObject returns the podman object name of a quadlet in another component, checking it's one of the given kinds
+func (r *componentRefs) hostObject(name, path string, kinds ...components.ResourceType) (string, error) {
+	res, err := r.resource(name, path)
+	if err != nil {
+		return "", err
+	}
+	if len(kinds) > 0 && !slices.Contains(kinds, res.Kind) {
+		return "", fmt.Errorf("resource %v in component %v is a %v", path, name, res.Kind)
+	}
+	if !res.IsQuadlet() || res.HostObject == "" {
+		return "", fmt.Errorf("resource %v in component %v has no host object", path, name)
+	}
+	return res.HostObject, nil
+}
+
+// service returns the systemd service for a quadlet or service in another component
+func (r *componentRefs) service(name, path string) (string, error) {
+	res, err := r.resource(name, path)
+	if err != nil {
+		return "", err
+	}
+	if s := res.Service(); s != "" {
+		return s, nil
+	}
+	return "", fmt.Errorf("resource %v in component %v has no service", path, name)
+}
+
+func (r *componentRefs) attribute(name, key string) (any, error) {
+	ref, err := r.get(name)
+	if err != nil {
+		return nil, err
+	}
+	val, ok := ref.published[key]
+	if !ok {
+		return nil, fmt.Errorf("component %v doesn't publish attribute %v", name, key)
+	}
+	return val, nil
+}
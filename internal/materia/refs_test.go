@@ -0,0 +1,70 @@
+package materia
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"primamateria.systems/materia/pkg/components"
+)
+
+func testRefs() *componentRefs {
+	var refs *componentRefs
+	refs = newComponentRefs("web01", []string{"postgres", "app", "loop", "cache@blue"}, func(name string) (*componentRef, error) {
+		comp := components.NewComponent(name)
+		switch comp.Name {
+		case "postgres":
+			comp.Resources.Set(components.Resource{Path: "db.network", Kind: components.ResourceTypeNetwork, HostObject: "pgnet"})
+			comp.Resources.Set(components.Resource{Path: "data.volume", Kind: components.ResourceTypeVolume, HostObject: "systemd-data"})
+			comp.Resources.Set(components.Resource{Path: "postgres.container", Kind: components.ResourceTypeContainer, HostObject: "postgres"})
+			return &componentRef{component: comp, published: map[string]any{"port": 5432}}, nil
+		case "cache":
+			comp.Resources.Set(comp.InstantiateResource(components.Resource{Path: "cache@.container", Kind: components.ResourceTypeContainer, HostObject: "systemd-cache_blue"}))
+		case "loop":
+			if _, err := refs.get("loop"); err != nil {
+				return nil, err
+			}
+		}
+		return &componentRef{component: comp}, nil
+	})
+	return refs
+}
+
+func Test_componentRefs(t *testing.T) {
+	refs := testRefs()
+
+	net, err := refs.hostObject("postgres", "db.network", components.ResourceTypeNetwork)
+	require.NoError(t, err)
+	assert.Equal(t, "pgnet", net)
+	_, err = refs.hostObject("postgres", "data.volume", components.ResourceTypeNetwork)
+	assert.ErrorContains(t, err, "data.volume")
+	_, err = refs.hostObject("postgres", "missing.network")
+	assert.ErrorContains(t, err, "has no resource")
+
+	svc, err := refs.service("postgres", "postgres.container")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres.service", svc)
+	svc, err = refs.service("cache@blue", "cache@.container")
+	require.NoError(t, err)
+	assert.Equal(t, "cache@blue.service", svc)
+
+	port, err := refs.attribute("postgres", "port")
+	require.NoError(t, err)
+	assert.Equal(t, 5432, port)
+	_, err = refs.attribute("postgres", "password")
+	assert.ErrorContains(t, err, "doesn't publish")
+
+	_, err = refs.get("redis")
+	assert.ErrorContains(t, err, "isn't assigned to web01")
+	_, err = refs.get("loop")
+	assert.ErrorContains(t, err, "circular component reference: loop -> loop")
+
+	// separate refs don't share loaded components
+	other := testRefs()
+	_, err = other.get("postgres")
+	require.NoError(t, err)
+	assert.NotSame(t, refs.loaded["postgres"], other.loaded["postgres"])
+	var unset *componentRefs
+	_, err = unset.get("postgres")
+	assert.Error(t, err)
+}
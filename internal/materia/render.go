@@ -0,0 +1,157 @@
+package materia
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"primamateria.systems/materia/internal/attributes"
+	"primamateria.systems/materia/pkg/components"
+)
+
+// secretsDir holds a rendered component's podman secrets, separate from its own files
+const secretsDir = ".podman-secrets"
+
+type RenderOptions struct {
+	// Hostname defaults to this host
+	Hostname string
+	// Roles defaults to the roles assigned to Hostname
+	Roles []string
+	// Components defaults to every component assigned to the host
+	Components []string
+	// Reveal keeps secret values instead of replacing them with placeholders
+	Reveal bool
+}
+
+// RolesFor returns the roles assigned to hostname, which are this host's own roles if it's this host
+func (m *Materia) RolesFor(hostname string) ([]string, error) {
+	if hostname == m.Hostname {
+		return m.Roles, nil
+	}
+	roles, err := getRolesFromManifest(m.Manifest, hostname)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load roles for %v: %w", hostname, err)
+	}
+	return roles, nil
+}
+
+// Render loads and templates components from the source the same way planning does, without touching the host or
+// changing the source checkout
+func (m *Materia) Render(ctx context.Context, opts RenderOptions) ([]*components.Component, error) {
+	hostname := opts.Hostname
+	roles := opts.Roles
+	if hostname == "" {
+		hostname = m.Hostname
+	}
+	if roles == nil {
+		var err error
+		roles, err = m.RolesFor(hostname)
+		if err != nil {
+			return nil, err
+		}
+	}
+	assigned, err := m.assignedComponents(hostname, roles)
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine assigned component names: %w", err)
+	}
+	names := opts.Components
+	if len(names) == 0 {
+		if len(assigned) == 0 {
+			return nil, fmt.Errorf("no components assigned to %v", hostname)
+		}
+		names = assigned
+	}
+	// components rendered by name can still reference the rest of the host's components
+	for _, n := range names {
+		if !slices.Contains(assigned, n) {
+			assigned = append(assigned, n)
+		}
+	}
+	if err := m.refreshAttributes(); err != nil {
+		return nil, err
+	}
+	exported, err := m.Source.ExportedAttributes()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load remote attribute defaults: %w", err)
+	}
+	return m.loadSourceComponents(ctx, names, assigned, hostname, roles, exported, !opts.Reveal)
+}
+
+// redactedTrace replaces the values from secret layers with placeholders naming the attribute. Values from other layers
+// are kept, so a deep merge still renders the parts of a table that aren't secret.
+func redactedTrace(t attributes.Trace) attributes.Trace {
+	result := make(attributes.Trace, len(t))
+	for k, ps := range t {
+		redacted := make([]attributes.Provenance, len(ps))
+		for i, p := range ps {
+			if p.Secret {
+				p.Value = secretPlaceholder(k, p.Value)
+			}
+			redacted[i] = p
+		}
+		result[k] = redacted
+	}
+	return result
+}
+
+func secretPlaceholder(path string, v any) any {
+	if v == attributes.Unset {
+		return v
+	}
+	if table, ok := v.(map[string]any); ok {
+		result := make(map[string]any, len(table))
+		for k, e := range table {
+			result[k] = secretPlaceholder(path+"."+k, e)
+		}
+		return result
+	}
+	if list := reflect.ValueOf(v); list.Kind() == reflect.Slice {
+		result := make([]any, list.Len())
+		for i := range list.Len() {
+			result[i] = secretPlaceholder(fmt.Sprintf("%v[%v]", path, i), list.Index(i).Interface())
+		}
+		return result
+	}
+	return fmt.Sprintf("<secret:%v>", path)
+}
+
+// WriteRendered writes each component's resources to <dir>/<component>, with podman secrets under .podman-secrets,
+// returning the files written
+func WriteRendered(dir string, comps []*components.Component) ([]string, error) {
+	var written []string
+	for _, comp := range comps {
+		compDir := filepath.Join(dir, comp.InstanceName())
+		for _, r := range comp.Resources.List() {
+			path := filepath.Join(compDir, r.Path)
+			if r.Kind == components.ResourceTypePodmanSecret {
+				path = filepath.Join(compDir, secretsDir, r.Path)
+			}
+			if !strings.HasPrefix(path, filepath.Clean(compDir)+string(filepath.Separator)) {
+				return written, fmt.Errorf("resource %v is outside component %v", r.Path, comp.InstanceName())
+			}
+			switch r.Kind {
+			case components.ResourceTypeDirectory, components.ResourceTypeDropinDir:
+				if err := os.MkdirAll(path, 0o755); err != nil {
+					return written, err
+				}
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return written, err
+			}
+			mode := os.FileMode(0o644)
+			if r.Kind == components.ResourceTypePodmanSecret {
+				mode = 0o600
+			}
+			if err := os.WriteFile(path, []byte(r.Content), mode); err != nil {
+				return written, fmt.Errorf("unable to write %v: %w", path, err)
+			}
+			written = append(written, path)
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,88 @@
+package materia
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"primamateria.systems/materia/internal/attributes"
+	"primamateria.systems/materia/pkg/components"
+	"primamateria.systems/materia/pkg/manifests"
+)
+
+func renderedComponent() *components.Component {
+	comp := components.NewComponent("app@blue")
+	comp.Resources.Set(components.Resource{Path: "app@blue.container", Kind: components.ResourceTypeContainer, Content: "[Container]\nEnvironment=DB_PASSWORD=hunter22 TOKEN=hunter2\n"})
+	comp.Resources.Set(components.Resource{Path: "config/app.yaml", Kind: components.ResourceTypeFile, Content: "password: hunter22\n"})
+	comp.Resources.Set(components.Resource{Path: "data", Kind: components.ResourceTypeDirectory})
+	comp.Resources.Set(components.Resource{Path: "db_password", Kind: components.ResourceTypePodmanSecret, Content: "hunter22"})
+	comp.Resources.Set(components.Resource{Path: "token", Kind: components.ResourceTypePodmanSecret, Content: "hunter2"})
+	return comp
+}
+
+func Test_redactedTrace(t *testing.T) {
+	plain := attributes.Provenance{Engine: "file", Layer: "global"}
+	secret := attributes.Provenance{Engine: "sops", Layer: "host web01", Secret: true}
+	trace := make(attributes.Trace)
+	trace.AddAll(map[string]any{"port": 80, "enabled": true, "db": map[string]any{"user": "app", "host": "db"}}, plain)
+	trace.AddAll(map[string]any{
+		"db_password": "hunter22",
+		"db":          map[string]any{"password": "hunter22", "host": attributes.Unset},
+		"keys":        []any{"a", "b"},
+		"enabled":     attributes.Unset,
+	}, secret)
+
+	redacted := redactedTrace(trace)
+	assert.Equal(t, map[string]any{
+		"port":        80,
+		"db_password": "<secret:db_password>",
+		"db":          map[string]any{"user": "app", "password": "<secret:db.password>"},
+		"keys":        []any{"<secret:keys[0]>", "<secret:keys[1]>"},
+	}, redacted.Resolve(attributes.MergeStrategy{Deep: true, Lists: attributes.ListsReplace}))
+	assert.Equal(t, "hunter22", trace.Resolved()["db_password"], "the original trace is left alone")
+}
+
+func Test_WriteRendered(t *testing.T) {
+	dir := t.TempDir()
+	written, err := WriteRendered(dir, []*components.Component{renderedComponent()})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(dir, "app@blue", "app@blue.container"),
+		filepath.Join(dir, "app@blue", "config", "app.yaml"),
+		filepath.Join(dir, "app@blue", secretsDir, "db_password"),
+		filepath.Join(dir, "app@blue", secretsDir, "token"),
+	}, written)
+	data, err := os.ReadFile(filepath.Join(dir, "app@blue", "config", "app.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "password: hunter22\n", string(data))
+	info, err := os.Stat(filepath.Join(dir, "app@blue", "data"))
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+
+	escape := components.NewComponent("evil")
+	escape.Resources.Set(components.Resource{Path: "../../etc/passwd", Kind: components.ResourceTypeFile})
+	_, err = WriteRendered(dir, []*components.Component{escape})
+	assert.Error(t, err)
+}
+
+func TestMateria_RolesFor(t *testing.T) {
+	m := &Materia{
+		Hostname: "local",
+		Roles:    []string{"configured"},
+		Manifest: &manifests.MateriaManifest{Hosts: map[string]manifests.Host{
+			"local": {Roles: []string{"manifest"}},
+			"web01": {Roles: []string{"web", "edge"}},
+		}},
+	}
+	roles, err := m.RolesFor("local")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"configured"}, roles)
+	roles, err = m.RolesFor("web01")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"web", "edge"}, roles)
+	roles, err = m.RolesFor("unknown")
+	require.NoError(t, err)
+	assert.Empty(t, roles)
+}
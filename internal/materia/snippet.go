@@ -1,46 +1,40 @@
 package materia
 
 import (
-	"bytes"
-	"errors"
+	"context"
 	"fmt"
+	"maps"
 	"path/filepath"
+	"slices"
+	"strings"
 	"text/template"
 
 	"primamateria.systems/materia/internal/macros"
+	"primamateria.systems/materia/pkg/components"
 	"primamateria.systems/materia/pkg/manifests"
 )
 
-func configToSnippet(c manifests.SnippetConfig) (*macros.Snippet, error) {
-	var err error
-	t := template.New(c.Name)
-	t, err = t.Parse(c.Body)
-	if err != nil {
-		return nil, err
-	}
-	return &macros.Snippet{
-		Name:       c.Name,
-		Parameters: c.Parameters,
-		Body:       t,
-	}, nil
-}
-
-func loadDefaultSnippets() []*macros.Snippet {
-	return []*macros.Snippet{
+func loadDefaultSnippets() []manifests.SnippetConfig {
+	return []manifests.SnippetConfig{
 		{
-			Name: "onBoot",
-			Body: template.Must(template.New("onBoot").Parse("[Install]\nWantedBy=default.target")),
+			Name:        "onBoot",
+			Description: "Start the service when the host boots",
+			Body:        "[Install]\nWantedBy=default.target",
+			Source:      "builtin",
 		},
 		{
-			Name: "harden",
-			Body: template.Must(template.New("harden").Parse("DropCapability=ALL\nReadOnly=true\n\nNoNewPrivileges=true")),
+			Name:        "harden",
+			Description: "Drop capabilities and make the container read only",
+			Body:        "DropCapability=ALL\nReadOnly=true\n\nNoNewPrivileges=true",
+			Source:      "builtin",
 		},
 	}
 }
 
-func loadDefaultMacros(c *MateriaConfig, host HostManager, snippets map[string]*macros.Snippet) macros.MacroMap {
+func loadDefaultMacros(c *MateriaConfig, host HostManager, snippets map[string]*macros.Snippet, refs *componentRefs) macros.MacroMap {
 	return func(vars map[string]any) template.FuncMap {
-		return template.FuncMap{
+		funcs := macros.Funcs()
+		maps.Copy(funcs, template.FuncMap{
 			"m_dataDir": func(arg string) (string, error) {
 				return filepath.Join(filepath.Join(c.ExecutorConfig.MateriaDir, "components"), arg), nil
 			},
@@ -59,10 +53,10 @@ func loadDefaultMacros(c *MateriaConfig, host HostManager, snippets map[string]*
 			"m_facts": func(arg string) (any, error) {
 				return host.Lookup(arg)
 			},
-			"m_default": func(arg string, def string) string {
+			"m_default": func(arg string, def any) any {
 				val, ok := vars[arg]
 				if ok {
-					return val.(string)
+					return val
 				}
 				return def
 			},
@@ -70,6 +64,33 @@ func loadDefaultMacros(c *MateriaConfig, host HostManager, snippets map[string]*
 				_, ok := vars[arg]
 				return ok
 			},
+			"attr": func(arg string) any {
+				return vars[arg]
+			},
+			"m_network": func(component, path string) (string, error) {
+				return refs.hostObject(component, path, components.ResourceTypeNetwork)
+			},
+			"m_volume": func(component, path string) (string, error) {
+				return refs.hostObject(component, path, components.ResourceTypeVolume)
+			},
+			"m_pod": func(component, path string) (string, error) {
+				return refs.hostObject(component, path, components.ResourceTypePod)
+			},
+			"m_container": func(component, path string) (string, error) {
+				return refs.hostObject(component, path, components.ResourceTypeContainer)
+			},
+			"m_image": func(component, path string) (string, error) {
+				return refs.hostObject(component, path, components.ResourceTypeImage, components.ResourceTypeBuild)
+			},
+			"m_hostObject": func(component, path string) (string, error) {
+				return refs.hostObject(component, path)
+			},
+			"m_service": func(component, path string) (string, error) {
+				return refs.service(component, path)
+			},
+			"m_attr": func(component, key string) (any, error) {
+				return refs.attribute(component, key)
+			},
 			"isRoot": func(_ string) bool {
 				return c.User.Username == "root" || !c.Rootless
 			},
@@ -91,20 +112,50 @@ func loadDefaultMacros(c *MateriaConfig, host HostManager, snippets map[string]*
 				}
 				return fmt.Sprintf("Secret=%v,type=mount,target=%v", host.SecretName(args[0]), args[1])
 			},
-			"snippet": func(name string, args ...string) (string, error) {
-				s, ok := snippets[name]
-				if !ok {
-					return "", errors.New("snippet not found")
-				}
-				snipVars := make(map[string]string, len(s.Parameters))
-				for k, v := range s.Parameters {
-					snipVars[v] = args[k]
-				}
+			"snippet": macros.NewSnippetFunc(snippets, nil),
+		})
+		return funcs
+	}
+}
 
-				result := bytes.NewBuffer([]byte{})
-				err := s.Body.Execute(result, snipVars)
-				return result.String(), err
-			},
+// ListSnippets returns the snippets templates can use, sorted by name. With a component, its own snippets are
+// included and replace repository snippets with the same name.
+func (m *Materia) ListSnippets(ctx context.Context, component string) ([]manifests.SnippetConfig, error) {
+	snippets := maps.Clone(m.snippets)
+	if component != "" {
+		// read the component as it's checked out, a sparse checkout only has the host's components
+		comp, err := m.Source.GetComponent(component)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load component %v: %w", component, err)
+		}
+		man, err := m.Source.GetManifest(comp)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load component %v manifest: %w", component, err)
+		}
+		if err := comp.ApplyManifest(man); err != nil {
+			return nil, err
+		}
+		own, err := macros.LoadSnippets(comp.Snippets)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(snippets, own)
+	}
+	result := make([]manifests.SnippetConfig, 0, len(snippets))
+	for _, name := range slices.Sorted(maps.Keys(snippets)) {
+		result = append(result, snippets[name].Config())
+	}
+	return result, nil
+}
+
+func FormatSnippets(snippets []manifests.SnippetConfig) string {
+	var result strings.Builder
+	for _, s := range snippets {
+		fmt.Fprintf(&result, "%v\n", s.Usage())
+		if s.Description != "" {
+			fmt.Fprintf(&result, "    %v\n", s.Description)
 		}
+		fmt.Fprintf(&result, "    from %v\n", s.Source)
 	}
+	return result.String()
 }
@@ -12,7 +12,7 @@ func Test_secretEnv(t *testing.T) {
 	hm.EXPECT().SecretName("mysecret").Return("materia-mysecret")
 	hm.EXPECT().SecretName("db_password").Return("materia-db_password")
 
-	macros := loadDefaultMacros(&MateriaConfig{}, hm, nil)(nil)
+	macros := loadDefaultMacros(&MateriaConfig{}, hm, nil, nil)(nil)
 
 	tests := []struct {
 		name string
@@ -37,7 +37,7 @@ func Test_secretMount(t *testing.T) {
 	hm.EXPECT().SecretName("mysecret").Return("materia-mysecret")
 	hm.EXPECT().SecretName("tls_cert").Return("materia-tls_cert")
 
-	macros := loadDefaultMacros(&MateriaConfig{}, hm, nil)(nil)
+	macros := loadDefaultMacros(&MateriaConfig{}, hm, nil, nil)(nil)
 
 	tests := []struct {
 		name string
@@ -59,21 +59,23 @@ func Test_secretMount(t *testing.T) {
 
 func Test_m_default(t *testing.T) {
 	hm := mocks.NewMockHostManager(t)
-	macros := loadDefaultMacros(&MateriaConfig{}, hm, nil)(map[string]any{"existing": "value"})
+	macros := loadDefaultMacros(&MateriaConfig{}, hm, nil, nil)(map[string]any{"existing": "value", "port": 8080})
 
 	tests := []struct {
 		name    string
 		varName string
-		defVal  string
-		want    string
+		defVal  any
+		want    any
 	}{
 		{"existing var", "existing", "default", "value"},
 		{"missing var", "missing", "default", "default"},
+		{"non-string var", "port", 80, 8080},
+		{"missing typed default", "replicas", 3, 3},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := macros["m_default"].(func(string, string) string)(tt.varName, tt.defVal)
+			got := macros["m_default"].(func(string, any) any)(tt.varName, tt.defVal)
 			assert.Equal(t, tt.want, got)
 		})
 	}
@@ -81,7 +83,7 @@ func Test_m_default(t *testing.T) {
 
 func Test_exists(t *testing.T) {
 	hm := mocks.NewMockHostManager(t)
-	macros := loadDefaultMacros(&MateriaConfig{}, hm, nil)(map[string]any{"existing": "value"})
+	macros := loadDefaultMacros(&MateriaConfig{}, hm, nil, nil)(map[string]any{"existing": "value"})
 
 	tests := []struct {
 		name    string
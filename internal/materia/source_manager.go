@@ -14,4 +14,9 @@ type SourceManager interface {
 	AddSource(source.Source, *source.SyncOpts, *source.SyncReport, bool) error
 	Sync(context.Context, *source.SyncOpts) error
 	Rollback(context.Context) error
+	SyncReports() map[string]*source.SyncReport
+	SetComponents(context.Context, []string) error
+	RemoteDrift() []manifests.RemoteDrift
+	RemoteVersions() []manifests.RemoteVersion
+	ExportedAttributes() (map[string]map[string]any, error)
 }
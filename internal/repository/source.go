@@ -125,6 +125,10 @@ func (s *SourceComponentRepository) GetComponent(name string) (*components.Compo
 		if d.Name() == c.Name || d.Name() == manifests.ComponentManifestFile {
 			return nil
 		}
+		// snippets are used while templating and aren't installed
+		if d.IsDir() && fullPath == filepath.Join(path, manifests.SnippetDir) {
+			return filepath.SkipDir
+		}
 		if strings.Contains(fullPath, ".git") {
 			return nil
 		}
@@ -137,6 +141,10 @@ func (s *SourceComponentRepository) GetComponent(name string) (*components.Compo
 	if err != nil {
 		return nil, err
 	}
+	c.Snippets, err = manifests.LoadSnippetDir(filepath.Join(path, manifests.SnippetDir), filepath.Join("components", c.Name, manifests.SnippetDir))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load snippets for component %v: %w", c.Name, err)
+	}
 	if scripts != 0 && scripts != 2 {
 		return nil, errors.New("scripted component is missing install or cleanup")
 	}
@@ -0,0 +1,162 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"charm.land/log/v2"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	xssh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// defaultKeyFiles are tried in order from $HOME/.ssh when no key or agent is available
+var defaultKeyFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// newAuth picks the auth method for a repository: an explicit private key, then HTTP basic auth,
+// then for SSH remotes the ssh-agent and finally the default keys in $HOME/.ssh
+func newAuth(c *Config, proto string) (transport.AuthMethod, error) {
+	passphrase, err := c.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if c.PrivateKey != "" {
+		if _, err := os.Stat(c.PrivateKey); err != nil {
+			return nil, err
+		}
+		publicKeys, err := loadPrivateKey(c.PrivateKey, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		publicKeys.HostKeyCallback, err = hostKeyCallback(c, true)
+		if err != nil {
+			return nil, err
+		}
+		return publicKeys, nil
+	}
+	if c.Username != "" {
+		return &http.BasicAuth{
+			Username: c.Username,
+			Password: c.Password,
+		}, nil
+	}
+	if proto != "ssh" {
+		return nil, nil
+	}
+	callback, err := hostKeyCallback(c, false)
+	if err != nil {
+		return nil, err
+	}
+	if !c.DisableAgent && os.Getenv("SSH_AUTH_SOCK") != "" {
+		agentAuth, err := agentAuth()
+		if err != nil {
+			log.Debugf("not using ssh-agent: %v", err)
+		} else {
+			agentAuth.HostKeyCallback = callback
+			return agentAuth, nil
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range defaultKeyFiles {
+		privkey := filepath.Join(home, ".ssh", name)
+		_, err := os.Stat(privkey)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		publicKeys, err := loadPrivateKey(privkey, passphrase)
+		if err != nil {
+			if _, ok := errors.AsType[*xssh.PassphraseMissingError](err); ok {
+				log.Warnf("skipping passphrase protected key %v: no passphrase configured", privkey)
+				continue
+			}
+			return nil, err
+		}
+		publicKeys.HostKeyCallback = callback
+		return publicKeys, nil
+	}
+	return nil, nil
+}
+
+func agentAuth() (*ssh.PublicKeysCallback, error) {
+	auth, err := ssh.NewSSHAgentAuth("git")
+	if err != nil {
+		return nil, err
+	}
+	signers, err := auth.Callback()
+	if err != nil {
+		return nil, err
+	}
+	if len(signers) == 0 {
+		return nil, errors.New("agent has no keys")
+	}
+	return auth, nil
+}
+
+func loadPrivateKey(path, passphrase string) (*ssh.PublicKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := xssh.ParsePrivateKey(data)
+	if _, ok := errors.AsType[*xssh.PassphraseMissingError](err); ok {
+		if passphrase == "" {
+			return nil, fmt.Errorf("private key %v is passphrase protected: %w", path, err)
+		}
+		signer, err = xssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to load private key %v: %w", path, err)
+	}
+	return &ssh.PublicKeys{User: "git", Signer: signer}, nil
+}
+
+// hostKeyCallback returns nil when go-git's default known hosts handling should be used
+func hostKeyCallback(c *Config, requireKnownHosts bool) (xssh.HostKeyCallback, error) {
+	if c.Insecure {
+		return xssh.InsecureIgnoreHostKey(), nil
+	}
+	hostsfile := c.KnownHosts
+	if hostsfile == "" {
+		if !requireKnownHosts {
+			return nil, nil
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		hostsfile = filepath.Join(home, ".ssh", "known_hosts")
+		if _, err := os.Stat(hostsfile); err != nil {
+			return nil, err
+		}
+	}
+	callback, err := knownhosts.New(hostsfile)
+	if err != nil {
+		return nil, fmt.Errorf("can't use knownhosts %v: %w", hostsfile, err)
+	}
+	return callback, nil
+}
+
+func (c *Config) passphrase() (string, error) {
+	if c.Passphrase != "" {
+		return c.Passphrase, nil
+	}
+	if c.PassphraseFile == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(c.PassphraseFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to read passphrase file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,79 @@
+package git
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	xssh "golang.org/x/crypto/ssh"
+)
+
+func writeKey(t *testing.T, path string, key any, passphrase string) xssh.PublicKey {
+	var block *pem.Block
+	var err error
+	if passphrase != "" {
+		block, err = xssh.MarshalPrivateKeyWithPassphrase(key, "", []byte(passphrase))
+	} else {
+		block, err = xssh.MarshalPrivateKey(key, "")
+	}
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0o600))
+	signer, err := xssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return signer.PublicKey()
+}
+
+func TestNewAuth_DefaultKeys(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	sshDir := filepath.Join(home, ".ssh")
+	require.NoError(t, os.Mkdir(sshDir, 0o700))
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edPub := writeKey(t, filepath.Join(sshDir, "id_ed25519"), edKey, "hunter2")
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecPub := writeKey(t, filepath.Join(sshDir, "id_ecdsa"), ecKey, "")
+
+	// no passphrase: the protected ed25519 key is skipped
+	auth, err := newAuth(&Config{Insecure: true}, "ssh")
+	require.NoError(t, err)
+	require.IsType(t, &ssh.PublicKeys{}, auth)
+	assert.Equal(t, ecPub.Marshal(), auth.(*ssh.PublicKeys).Signer.PublicKey().Marshal())
+
+	passFile := filepath.Join(home, "passphrase")
+	require.NoError(t, os.WriteFile(passFile, []byte("hunter2\n"), 0o600))
+	auth, err = newAuth(&Config{Insecure: true, PassphraseFile: passFile}, "ssh")
+	require.NoError(t, err)
+	assert.Equal(t, edPub.Marshal(), auth.(*ssh.PublicKeys).Signer.PublicKey().Marshal())
+
+	// non ssh remotes don't use keys
+	auth, err = newAuth(&Config{}, "https")
+	require.NoError(t, err)
+	assert.Nil(t, auth)
+}
+
+func TestNewAuth_ExplicitKey(t *testing.T) {
+	dir := t.TempDir()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keyFile := filepath.Join(dir, "deploy_key")
+	writeKey(t, keyFile, key, "secret")
+
+	_, err = newAuth(&Config{PrivateKey: keyFile, Insecure: true}, "ssh")
+	assert.ErrorContains(t, err, "passphrase protected")
+
+	auth, err := newAuth(&Config{PrivateKey: keyFile, Passphrase: "secret", Insecure: true}, "ssh")
+	require.NoError(t, err)
+	assert.IsType(t, &ssh.PublicKeys{}, auth)
+}
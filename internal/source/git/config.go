@@ -10,6 +10,9 @@ type Config struct {
 	URL             string `toml:"URL" json:"URL" yaml:"URL"`
 	Branch          string `toml:"branch" json:"branch" yaml:"branch"`
 	PrivateKey      string `koanf:"private_key" toml:"private_key" json:"private_key" yaml:"private_key"`
+	Passphrase      string `toml:"passphrase" json:"passphrase" yaml:"passphrase"`
+	PassphraseFile  string `toml:"passphrase_file" json:"passphrase_file" yaml:"passphrase_file"`
+	DisableAgent    bool   `toml:"disable_agent" json:"disable_agent" yaml:"disable_agent"`
 	Username        string `toml:"username" json:"username" yaml:"username"`
 	Password        string `toml:"password" json:"password" yaml:"password"`
 	KnownHosts      string `toml:"known_hosts" json:"known_hosts" yaml:"known_hosts"`
@@ -17,6 +20,13 @@ type Config struct {
 	LocalRepository string `toml:"local_repository" json:"local_repository" yaml:"local_repository"`
 	Careful         bool   `toml:"careful" json:"careful" yaml:"careful"`
 	Default         string `yaml:"default" toml:"default" json:"default"`
+	Tag             string `toml:"tag" json:"tag" yaml:"tag"`
+	Version         string `toml:"version" json:"version" yaml:"version"`
+	Verify          bool   `toml:"verify" json:"verify" yaml:"verify"`
+	SigningKeys     string `toml:"signing_keys" json:"signing_keys" yaml:"signing_keys"`
+	AllowedSigners  string `toml:"allowed_signers" json:"allowed_signers" yaml:"allowed_signers"`
+	Depth           int    `toml:"depth" json:"depth" yaml:"depth"`
+	SparseCheckout  bool   `toml:"sparse_checkout" json:"sparse_checkout" yaml:"sparse_checkout"`
 }
 
 func NewConfig(k *koanf.Koanf, localDir, remoteURL string) (*Config, error) {
@@ -25,11 +35,21 @@ func NewConfig(k *koanf.Koanf, localDir, remoteURL string) (*Config, error) {
 	c.Branch = k.String("git.branch")
 	c.Default = k.String("git.default")
 	c.PrivateKey = k.String("git.private_key")
+	c.Passphrase = k.String("git.passphrase")
+	c.PassphraseFile = k.String("git.passphrase_file")
+	c.DisableAgent = k.Bool("git.disable_agent")
 	c.Insecure = k.Bool("git.insecure")
 	c.Username = k.String("git.username")
 	c.Password = k.String("git.password")
 	c.KnownHosts = k.String("git.knownhosts")
 	c.Careful = k.Bool("git.careful")
+	c.Tag = k.String("git.tag")
+	c.Version = k.String("git.version")
+	c.Verify = k.Bool("git.verify")
+	c.SigningKeys = k.String("git.signing_keys")
+	c.AllowedSigners = k.String("git.allowed_signers")
+	c.Depth = k.Int("git.depth")
+	c.SparseCheckout = k.Bool("git.sparse_checkout")
 	c.LocalRepository = localDir
 	c.URL = remoteURL
 	return &c, nil
@@ -39,12 +59,33 @@ func (c *Config) String() string {
 	var result string
 	result += fmt.Sprintf("URL: %v\n", c.URL)
 	result += fmt.Sprintf("Branch: %v\n", c.Branch)
+	if c.Tag != "" {
+		result += fmt.Sprintf("Tag: %v\n", c.Tag)
+	}
+	if c.Version != "" {
+		result += fmt.Sprintf("Version: %v\n", c.Version)
+	}
 	result += fmt.Sprintf("Known Hosts: %v\n", c.KnownHosts)
 	result += fmt.Sprintf("Allow Insecure: %v\n", c.Insecure)
 	result += fmt.Sprintf("Carreful mode: %v\n", c.Careful)
 	if c.PrivateKey != "" {
 		result += fmt.Sprintf("PrivateKey file: %v\n", c.PrivateKey)
 	}
+	if c.PassphraseFile != "" {
+		result += fmt.Sprintf("Passphrase file: %v\n", c.PassphraseFile)
+	}
+	result += fmt.Sprintf("Disable ssh-agent: %v\n", c.DisableAgent)
+	result += fmt.Sprintf("Verify signatures: %v\n", c.Verify)
+	if c.SigningKeys != "" {
+		result += fmt.Sprintf("Signing keyring: %v\n", c.SigningKeys)
+	}
+	if c.AllowedSigners != "" {
+		result += fmt.Sprintf("Allowed signers: %v\n", c.AllowedSigners)
+	}
+	if c.Depth > 0 {
+		result += fmt.Sprintf("Clone depth: %v\n", c.Depth)
+	}
+	result += fmt.Sprintf("Sparse checkout: %v\n", c.SparseCheckout)
 	if c.Username != "" {
 		result += fmt.Sprintf("Username: %v\n", c.Username)
 	}
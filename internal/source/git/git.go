@@ -5,27 +5,29 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 	"slices"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/transport"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
-	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
-	xssh "golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/knownhosts"
+	"primamateria.systems/materia/internal/source/version"
 	"primamateria.systems/materia/pkg/source"
 )
 
 type GitSource struct {
 	activeBranch     string
+	tag              string
+	version          *version.Constraint
 	defaultBranch    string
 	localRepository  string
 	remoteRepository string
 	auth             transport.AuthMethod
 	resetIfNeeded    bool
+	verifier         *signatureVerifier
+	depth            int
+	sparse           bool
+	components       []string
 }
 
 func NewGitSource(c *Config) (*GitSource, error) {
@@ -48,66 +50,31 @@ func NewGitSource(c *Config) (*GitSource, error) {
 	proto = ep.Protocol
 
 	g.activeBranch = c.Branch
-
-	if c.PrivateKey != "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return nil, err
-		}
-		hostsfile := c.KnownHosts
-		if hostsfile == "" {
-			hostsfile = fmt.Sprintf("%v/.ssh/known_hosts", home)
-			_, err = os.Stat(hostsfile)
-			if err != nil {
-				return nil, err
-			}
-
+	g.tag = c.Tag
+	if c.Version != "" {
+		if c.Tag != "" {
+			return nil, errors.New("git version and tag can't both be set")
 		}
-		_, err = os.Stat(c.PrivateKey)
-		if err != nil {
+		if g.version, err = version.ParseConstraint(c.Version); err != nil {
 			return nil, err
 		}
-		publicKeys, err := ssh.NewPublicKeysFromFile("git", c.PrivateKey, "")
-		if err != nil {
-			return nil, err
-		}
-		if c.Insecure {
-			publicKeys.HostKeyCallback = xssh.InsecureIgnoreHostKey()
-		}
-		if hostsfile != "" {
-			publicKeys.HostKeyCallback, err = knownhosts.New(hostsfile)
-			if err != nil {
-				return nil, fmt.Errorf("can't use knownhosts %v: %w", hostsfile, err)
-			}
-		}
+	}
+	if c.Depth < 0 {
+		return nil, fmt.Errorf("invalid clone depth: %v", c.Depth)
+	}
+	g.depth = c.Depth
+	g.sparse = c.SparseCheckout
 
-		g.auth = publicKeys
-	} else if c.Username != "" {
-		g.auth = &http.BasicAuth{
-			Username: c.Username,
-			Password: c.Password,
-		}
-	} else if proto == "ssh" {
-		// we want to try to find any private keys in $HOME/.ssh to use here
-		home, err := os.UserHomeDir()
+	if c.Verify {
+		g.verifier, err = newSignatureVerifier(c.SigningKeys, c.AllowedSigners)
 		if err != nil {
 			return nil, err
 		}
-		privkey := filepath.Join(home, ".ssh", "id_rsa")
-		_, err = os.Stat(privkey)
-		if err != nil && !errors.Is(err, os.ErrNotExist) {
-			return nil, err
-		}
-		if !errors.Is(err, os.ErrNotExist) {
-			publicKeys, err := ssh.NewPublicKeysFromFile("git", privkey, "")
-			if err != nil {
-				return nil, err
-			}
-			if c.Insecure {
-				publicKeys.HostKeyCallback = xssh.InsecureIgnoreHostKey()
-			}
-			g.auth = publicKeys
-		}
+	}
+
+	g.auth, err = newAuth(c, proto)
+	if err != nil {
+		return nil, err
 	}
 	return g, nil
 }
@@ -120,14 +87,35 @@ func (g *GitSource) Sync(ctx context.Context, opts source.SyncOpts) (*source.Syn
 		Auth:              g.auth,
 		Progress:          os.Stdout,
 		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+		Depth:             g.depth,
 	}
+	// a sparse checkout is driven by the assigned components, unless a subpath is already requested
+	sparse := g.sparse && opts.Subpath == ""
+	// the sparse worktree is checked out at the end
+	gco.NoCheckout = sparse
 	r, oldRevision, err := g.createOrOpenRepo(ctx, gco)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open repository: %w", err)
 	}
 	report.OldRevision = oldRevision
 
-	if opts.Revision == "" {
+	tag := ""
+	target := g.tag
+	if opts.Revision == "" && g.version != nil {
+		resolution, err := g.resolveVersion(ctx)
+		if err != nil {
+			return nil, err
+		}
+		target = resolution.Tag
+		report.Version, report.NewerVersion = resolution.Tag, resolution.Newer
+	}
+	switch {
+	case opts.Revision == "" && target != "":
+		tag = target
+		if err := g.checkoutTag(ctx, r, tag, opts.Subpath); err != nil {
+			return nil, fmt.Errorf("failed to checkout tag %v: %w", tag, err)
+		}
+	case opts.Revision == "":
 		if err := g.ensureBranch(ctx, r, opts.Subpath); err != nil {
 			return nil, err
 		}
@@ -151,10 +139,15 @@ func (g *GitSource) Sync(ctx context.Context, opts source.SyncOpts) (*source.Syn
 				return nil, fmt.Errorf("failed to checkout branch: %w", err)
 			}
 		}
-		if err := g.pull(ctx, r); err != nil {
+		if sparse {
+			// only move the branch, the worktree is updated once the new revision is accepted
+			if err := g.fetchBranch(ctx, r, target); err != nil {
+				return nil, err
+			}
+		} else if err := g.pull(ctx, r); err != nil {
 			return nil, err
 		}
-	} else {
+	default:
 		if err := g.checkoutRevision(ctx, r, opts.Revision); err != nil {
 			return nil, fmt.Errorf("failed to checkout revision %v: %w", opts.Revision, err)
 		}
@@ -163,6 +156,31 @@ func (g *GitSource) Sync(ctx context.Context, opts source.SyncOpts) (*source.Syn
 	if err != nil {
 		return nil, fmt.Errorf("failed to get HEAD after sync: %w", err)
 	}
+	if g.verifier != nil {
+		tags := []string{tag}
+		var err error
+		if opts.Revision != "" && (g.tag != "" || g.version != nil) {
+			// a revision pinned from a tag is only trusted if a tag it was taken from is
+			tags, err = g.pinnedTags(ctx, r, newHead.Hash())
+		}
+		for _, t := range tags {
+			if err = g.verifyRevision(r, newHead.Hash(), t); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			// don't leave unverified content around for planning
+			if rerr := g.restore(r, oldRevision, sparse); rerr != nil {
+				return nil, fmt.Errorf("%w; plus restoring previous revision failed: %w", err, rerr)
+			}
+			return nil, err
+		}
+	}
+	if sparse {
+		if err := g.resetTo(r, newHead.Hash(), true); err != nil {
+			return nil, fmt.Errorf("failed to update sparse checkout: %w", err)
+		}
+	}
 	report.NewRevision = newHead.Hash().String()
 	return report, nil
 }
@@ -251,6 +269,7 @@ func (g *GitSource) fetchOrigin(ctx context.Context, repo *git.Repository, refSp
 	if err = remote.FetchContext(ctx, &git.FetchOptions{
 		RefSpecs: refSpecs,
 		Auth:     g.auth,
+		Depth:    g.depth,
 	}); err != nil {
 		if err == git.NoErrAlreadyUpToDate {
 			fmt.Print("refs already up to date")
@@ -311,6 +330,7 @@ func (g *GitSource) pull(ctx context.Context, r *git.Repository) error {
 	err = w.PullContext(ctx, &git.PullOptions{
 		Auth:  g.auth,
 		Force: g.resetIfNeeded,
+		Depth: g.depth,
 	})
 	if err == nil || errors.Is(err, git.NoErrAlreadyUpToDate) {
 		return nil
@@ -321,7 +341,7 @@ func (g *GitSource) pull(ctx context.Context, r *git.Repository) error {
 	if err := g.HardReset(r); err != nil {
 		return fmt.Errorf("failed to hard reset: %w", err)
 	}
-	if err := w.PullContext(ctx, &git.PullOptions{Auth: g.auth, Force: true}); err != nil {
+	if err := w.PullContext(ctx, &git.PullOptions{Auth: g.auth, Force: true, Depth: g.depth}); err != nil {
 		return fmt.Errorf("failed to pull after hard reset: %w", err)
 	}
 	return nil
@@ -378,13 +398,23 @@ func (g *GitSource) checkoutBranch(ctx context.Context, r *git.Repository, branc
 	return nil
 }
 
-func (g *GitSource) checkoutRevision(_ context.Context, r *git.Repository, revision string) error {
+func (g *GitSource) checkoutRevision(ctx context.Context, r *git.Repository, revision string) error {
 	w, err := r.Worktree()
 	if err != nil {
 		return fmt.Errorf("failed to get worktree: %w", err)
 	}
 
 	hash, err := r.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		// the revision may be on a branch or tag that hasn't been fetched yet, e.g. when pinned by a lockfile
+		if ferr := g.fetchOrigin(ctx, r, "+refs/heads/*:refs/remotes/origin/*"); ferr != nil {
+			return fmt.Errorf("failed to resolve revision %q: %w", revision, err)
+		}
+		if ferr := g.fetchOrigin(ctx, r, "+refs/tags/*:refs/tags/*"); ferr != nil {
+			return fmt.Errorf("failed to resolve revision %q: %w", revision, err)
+		}
+		hash, err = r.ResolveRevision(plumbing.Revision(revision))
+	}
 	if err != nil {
 		return fmt.Errorf("failed to resolve revision %q: %w", revision, err)
 	}
@@ -395,6 +425,136 @@ func (g *GitSource) checkoutRevision(_ context.Context, r *git.Repository, revis
 	})
 }
 
+func (g *GitSource) checkoutTag(ctx context.Context, r *git.Repository, tag, subpath string) error {
+	tagRefSpec := fmt.Sprintf("+refs/tags/%s:refs/tags/%s", tag, tag)
+	if err := g.fetchOrigin(ctx, r, tagRefSpec); err != nil {
+		return err
+	}
+	ref, err := r.Tag(tag)
+	if err != nil {
+		return err
+	}
+	hash := ref.Hash()
+	if t, err := r.TagObject(hash); err == nil {
+		c, err := t.Commit()
+		if err != nil {
+			return fmt.Errorf("tag does not point to a commit: %w", err)
+		}
+		hash = c.Hash
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+	coOpts := &git.CheckoutOptions{
+		Hash:  hash,
+		Force: true,
+	}
+	if subpath != "" {
+		coOpts.SparseCheckoutDirectories = []string{subpath}
+	}
+	return w.Checkout(coOpts)
+}
+
+// pinnedTags returns the tracked tag, or the tags matching the version constraint, that point at a pinned revision
+func (g *GitSource) pinnedTags(ctx context.Context, r *git.Repository, hash plumbing.Hash) ([]string, error) {
+	tags, err := g.tagsAt(r, hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		refSpec := "+refs/tags/*:refs/tags/*"
+		if g.tag != "" {
+			refSpec = fmt.Sprintf("+refs/tags/%s:refs/tags/%s", g.tag, g.tag)
+		}
+		if err := g.fetchOrigin(ctx, r, refSpec); err != nil {
+			return nil, err
+		}
+		if tags, err = g.tagsAt(r, hash); err != nil {
+			return nil, err
+		}
+	}
+	if len(tags) == 0 {
+		expected := g.tag
+		if expected == "" {
+			expected = fmt.Sprintf("with a version matching %v", g.version)
+		}
+		return nil, fmt.Errorf("%w: revision %v isn't tagged %v", ErrUnverifiedRevision, hash, expected)
+	}
+	return tags, nil
+}
+
+func (g *GitSource) tagsAt(r *git.Repository, hash plumbing.Hash) ([]string, error) {
+	refs, err := r.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	var tags []string
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().Short()
+		if g.tag != "" && name != g.tag {
+			return nil
+		}
+		if g.version != nil {
+			v, err := version.ParseTag(name)
+			if err != nil || !g.version.Check(v) {
+				return nil
+			}
+		}
+		target := ref.Hash()
+		if t, err := r.TagObject(target); err == nil {
+			c, err := t.Commit()
+			if err != nil {
+				return nil
+			}
+			target = c.Hash
+		}
+		if target == hash {
+			tags = append(tags, name)
+		}
+		return nil
+	})
+	slices.Sort(tags)
+	return tags, err
+}
+
+// verifyRevision checks the signature of the tag if tracking one, or of the commit otherwise
+func (g *GitSource) verifyRevision(r *git.Repository, hash plumbing.Hash, tag string) error {
+	if tag != "" {
+		ref, err := r.Tag(tag)
+		if err != nil {
+			return fmt.Errorf("failed to find tag %v: %w", tag, err)
+		}
+		t, err := r.TagObject(ref.Hash())
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			return fmt.Errorf("%w: tag %v is not annotated and can't be signed", ErrUnverifiedRevision, tag)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load tag %v: %w", tag, err)
+		}
+		if err := g.verifier.verifyTag(t); err != nil {
+			return fmt.Errorf("%w: tag %v: %w", ErrUnverifiedRevision, tag, err)
+		}
+		return nil
+	}
+	c, err := r.CommitObject(hash)
+	if err != nil {
+		return fmt.Errorf("failed to load commit %v: %w", hash, err)
+	}
+	if err := g.verifier.verifyCommit(c); err != nil {
+		return fmt.Errorf("%w: commit %v: %w", ErrUnverifiedRevision, hash, err)
+	}
+	return nil
+}
+
+// restore resets the local repository to a previous revision, or removes it if there wasn't one
+func (g *GitSource) restore(r *git.Repository, revision string, sparse bool) error {
+	if revision == "" {
+		return g.Clean()
+	}
+	return g.resetTo(r, plumbing.NewHash(revision), sparse)
+}
+
 func (g *GitSource) Inspect() source.SyncInspectReport {
 	return source.SyncInspectReport{
 		SupportsRollback: true,
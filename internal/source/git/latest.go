@@ -0,0 +1,98 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"charm.land/log/v2"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"primamateria.systems/materia/internal/source/version"
+)
+
+// LatestRevision returns the commit the tracked tag, version or branch currently points to on the remote
+func (g *GitSource) LatestRevision(ctx context.Context) (string, error) {
+	byName, err := g.listRemote(ctx)
+	if err != nil {
+		return "", err
+	}
+	tag := g.tag
+	if g.version != nil {
+		resolution, err := g.version.Resolve(tagNames(byName))
+		if err != nil {
+			return "", err
+		}
+		tag = resolution.Tag
+	}
+	var target plumbing.ReferenceName
+	switch {
+	case tag != "":
+		target = plumbing.NewTagReferenceName(tag)
+		// annotated tags are peeled to their commit
+		if peeled, ok := byName[target+"^{}"]; ok {
+			return peeled.Hash().String(), nil
+		}
+	case g.activeBranch != "":
+		target = plumbing.NewBranchReferenceName(g.activeBranch)
+	case g.defaultBranch != "":
+		target = plumbing.NewBranchReferenceName(g.defaultBranch)
+	default:
+		target = plumbing.NewBranchReferenceName("master")
+		if head, ok := byName[plumbing.HEAD]; ok && head.Type() == plumbing.SymbolicReference {
+			target = head.Target()
+		}
+	}
+	ref, ok := byName[target]
+	if !ok {
+		return "", fmt.Errorf("remote has no %v", target)
+	}
+	return ref.Hash().String(), nil
+}
+
+// resolveVersion picks the remote tag matching the version constraint
+func (g *GitSource) resolveVersion(ctx context.Context) (version.Resolution, error) {
+	byName, err := g.listRemote(ctx)
+	if err != nil {
+		return version.Resolution{}, err
+	}
+	resolution, err := g.version.Resolve(tagNames(byName))
+	if err != nil {
+		return version.Resolution{}, err
+	}
+	if resolution.Newer != "" {
+		log.Infof("%v resolved to %v, %v is available outside the version constraint", g.version, resolution.Tag, resolution.Newer)
+	}
+	return resolution, nil
+}
+
+func (g *GitSource) listRemote(ctx context.Context) (map[plumbing.ReferenceName]*plumbing.Reference, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{g.remoteRepository},
+	})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{
+		Auth:          g.auth,
+		PeelingOption: git.AppendPeeled,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote references: %w", err)
+	}
+	byName := make(map[plumbing.ReferenceName]*plumbing.Reference, len(refs))
+	for _, ref := range refs {
+		byName[ref.Name()] = ref
+	}
+	return byName, nil
+}
+
+func tagNames(refs map[plumbing.ReferenceName]*plumbing.Reference) []string {
+	var tags []string
+	for name := range refs {
+		if name.IsTag() && !strings.HasSuffix(name.String(), "^{}") {
+			tags = append(tags, name.Short())
+		}
+	}
+	return tags
+}
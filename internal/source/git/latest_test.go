@@ -0,0 +1,116 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"primamateria.systems/materia/pkg/source"
+)
+
+func TestGitSource_LatestRevision(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	remoteDir := filepath.Join(dir, "remote")
+	remote, err := git.PlainInit(remoteDir, false)
+	require.NoError(t, err)
+	commitFiles(t, remote, remoteDir, map[string]string{"MANIFEST.toml": "version = 1"})
+	first, err := remote.Head()
+	require.NoError(t, err)
+	_, err = remote.CreateTag("v1", first.Hash(), &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		Message: "v1",
+	})
+	require.NoError(t, err)
+	commitFiles(t, remote, remoteDir, map[string]string{"MANIFEST.toml": "version = 2"})
+	second, err := remote.Head()
+	require.NoError(t, err)
+
+	localDir := filepath.Join(dir, "local")
+	tests := []struct {
+		name     string
+		config   Config
+		expected string
+	}{
+		{"head", Config{}, second.Hash().String()},
+		{"branch", Config{Branch: "master"}, second.Hash().String()},
+		{"annotated tag", Config{Tag: "v1"}, first.Hash().String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.URL = remoteDir
+			tt.config.LocalRepository = localDir
+			g, err := NewGitSource(&tt.config)
+			require.NoError(t, err)
+			latest, err := g.LatestRevision(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, latest)
+		})
+	}
+
+	g, err := NewGitSource(&Config{URL: remoteDir, Branch: "missing", LocalRepository: localDir})
+	require.NoError(t, err)
+	_, err = g.LatestRevision(ctx)
+	assert.Error(t, err)
+
+	// a pinned revision is checked out even though the branch has moved on
+	g, err = NewGitSource(&Config{URL: remoteDir, Branch: "master", LocalRepository: localDir})
+	require.NoError(t, err)
+	report, err := g.Sync(ctx, source.SyncOpts{Revision: first.Hash().String()})
+	require.NoError(t, err)
+	assert.Equal(t, first.Hash().String(), report.NewRevision)
+	content, err := os.ReadFile(filepath.Join(localDir, "MANIFEST.toml"))
+	require.NoError(t, err)
+	assert.Equal(t, "version = 1", string(content))
+}
+
+func TestGitSource_Version(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	remoteDir := filepath.Join(dir, "remote")
+	remote, err := git.PlainInit(remoteDir, false)
+	require.NoError(t, err)
+	var commits []string
+	for _, tag := range []string{"v1.3.0", "v1.4.0", "v1.4.1", "v2.0.0"} {
+		commitFiles(t, remote, remoteDir, map[string]string{"MANIFEST.toml": tag})
+		head, err := remote.Head()
+		require.NoError(t, err)
+		_, err = remote.CreateTag(tag, head.Hash(), nil)
+		require.NoError(t, err)
+		commits = append(commits, head.Hash().String())
+	}
+
+	_, err = NewGitSource(&Config{URL: remoteDir, Tag: "v1.3.0", Version: "~1.4"})
+	assert.Error(t, err)
+	_, err = NewGitSource(&Config{URL: remoteDir, Version: "one"})
+	assert.Error(t, err)
+
+	localDir := filepath.Join(dir, "local")
+	g, err := NewGitSource(&Config{URL: remoteDir, Version: "~1.4", LocalRepository: localDir})
+	require.NoError(t, err)
+	latest, err := g.LatestRevision(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, commits[2], latest)
+
+	report, err := g.Sync(ctx, source.SyncOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, commits[2], report.NewRevision)
+	assert.Equal(t, "v1.4.1", report.Version)
+	assert.Equal(t, "v2.0.0", report.NewerVersion)
+	content, err := os.ReadFile(filepath.Join(localDir, "MANIFEST.toml"))
+	require.NoError(t, err)
+	assert.Equal(t, "v1.4.1", string(content))
+
+	g, err = NewGitSource(&Config{URL: remoteDir, Version: "^2", LocalRepository: localDir})
+	require.NoError(t, err)
+	report, err = g.Sync(ctx, source.SyncOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, commits[3], report.NewRevision)
+	assert.Empty(t, report.NewerVersion)
+}
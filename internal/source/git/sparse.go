@@ -0,0 +1,203 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+const componentsDir = "components"
+
+// SetComponents limits a sparse checkout to the given components. Everything outside the components directory is always checked out.
+// This only limits the worktree: go-git can't do partial fetches, so the objects of every component are still downloaded.
+func (g *GitSource) SetComponents(_ context.Context, components []string) error {
+	names := make([]string, 0, len(components))
+	for _, c := range components {
+		name, _, _ := strings.Cut(c, "@")
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	previous := g.components
+	g.components = names
+	if !g.sparse {
+		return nil
+	}
+	// planning sets the components every run, only reset the worktree when they change
+	if previous == nil {
+		var err error
+		if previous, err = g.checkedOutComponents(); err != nil {
+			return err
+		}
+	}
+	if slices.Equal(previous, names) {
+		return nil
+	}
+	r, err := git.PlainOpen(g.localRepository)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		return fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	return g.resetTo(r, head.Hash(), true)
+}
+
+// resetTo hard resets the worktree to hash, only checking out the sparse directories if requested
+func (g *GitSource) resetTo(r *git.Repository, hash plumbing.Hash, sparse bool) error {
+	w, err := r.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+	opts := &git.ResetOptions{
+		Commit: hash,
+		Mode:   git.HardReset,
+	}
+	if !sparse {
+		return w.Reset(opts)
+	}
+	dirs, err := g.sparseDirs(r, hash)
+	if err != nil {
+		return err
+	}
+	// ResetSparsely only ever adds skip flags, clear them so newly selected components get checked out
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+	for _, e := range idx.Entries {
+		e.SkipWorktree = false
+	}
+	if err := r.Storer.SetIndex(idx); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	if err := w.ResetSparsely(opts, dirs); err != nil {
+		return err
+	}
+	return g.removeSkipped(r)
+}
+
+// sparseDirs returns every top level entry of the tree at hash, with the components directory limited to the selected components
+func (g *GitSource) sparseDirs(r *git.Repository, hash plumbing.Hash) ([]string, error) {
+	commit, err := r.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load commit %v: %w", hash, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tree of %v: %w", hash, err)
+	}
+	var dirs []string
+	for _, e := range tree.Entries {
+		switch {
+		case e.Name == componentsDir:
+		case e.Mode.IsFile():
+			dirs = append(dirs, e.Name)
+		default:
+			dirs = append(dirs, e.Name+"/")
+		}
+	}
+	components := g.components
+	if components == nil {
+		// nothing assigned yet, keep whatever is already checked out
+		components, err = g.checkedOutComponents()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range components {
+		dirs = append(dirs, fmt.Sprintf("%v/%v/", componentsDir, c))
+	}
+	return dirs, nil
+}
+
+func (g *GitSource) checkedOutComponents() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(g.localRepository, componentsDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list components: %w", err)
+	}
+	components := []string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			components = append(components, e.Name())
+		}
+	}
+	return components, nil
+}
+
+// removeSkipped deletes files left over from earlier checkouts that are now outside the sparse checkout
+func (g *GitSource) removeSkipped(r *git.Repository) error {
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+	for _, e := range idx.Entries {
+		if !e.SkipWorktree {
+			continue
+		}
+		path := filepath.Join(g.localRepository, filepath.FromSlash(e.Name))
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove %v: %w", e.Name, err)
+		}
+		// clean up now empty parent directories
+		for dir := filepath.Dir(path); dir != g.localRepository && strings.HasPrefix(dir, g.localRepository); dir = filepath.Dir(dir) {
+			if err := os.Remove(dir); err != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// fetchBranch moves the local branch to the fetched remote branch without touching the worktree
+func (g *GitSource) fetchBranch(ctx context.Context, r *git.Repository, branch string) error {
+	refSpec := fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", branch, branch)
+	if err := g.fetchOrigin(ctx, r, refSpec); err != nil {
+		return err
+	}
+	remoteRef, err := r.Reference(plumbing.NewRemoteReferenceName("origin", branch), true)
+	if err != nil {
+		return fmt.Errorf("failed to find remote branch %v: %w", branch, err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		return fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	if head.Hash() == remoteRef.Hash() {
+		return nil
+	}
+	if !g.resetIfNeeded {
+		current, err := r.CommitObject(head.Hash())
+		if err != nil {
+			return err
+		}
+		next, err := r.CommitObject(remoteRef.Hash())
+		if err != nil {
+			return err
+		}
+		ok, err := current.IsAncestor(next)
+		if err != nil {
+			return fmt.Errorf("failed to check for fast-forward: %w", err)
+		}
+		if !ok {
+			return git.ErrFastForwardMergeNotPossible
+		}
+	}
+	return r.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName(branch), remoteRef.Hash()))
+}
@@ -0,0 +1,142 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"primamateria.systems/materia/pkg/source"
+)
+
+func commitFiles(t *testing.T, r *git.Repository, dir string, files map[string]string) {
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		_, err = w.Add(name)
+		require.NoError(t, err)
+	}
+	_, err = w.Commit("update", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return !errors.Is(err, os.ErrNotExist)
+}
+
+func TestGitSource_Sparse(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	remoteDir := filepath.Join(dir, "remote")
+	remote, err := git.PlainInit(remoteDir, false)
+	require.NoError(t, err)
+	commitFiles(t, remote, remoteDir, map[string]string{
+		"MANIFEST.toml":                     "",
+		"attributes/vault.toml":             "",
+		"components/a/container.container":  "",
+		"components/b/container.container":  "",
+		"components/ab/container.container": "",
+	})
+
+	localDir := filepath.Join(dir, "local")
+	g, err := NewGitSource(&Config{
+		URL:             remoteDir,
+		Branch:          "master",
+		LocalRepository: localDir,
+		SparseCheckout:  true,
+	})
+	require.NoError(t, err)
+
+	_, err = g.Sync(ctx, source.SyncOpts{})
+	require.NoError(t, err)
+	assert.True(t, exists(filepath.Join(localDir, "MANIFEST.toml")))
+	assert.True(t, exists(filepath.Join(localDir, "attributes", "vault.toml")))
+	assert.False(t, exists(filepath.Join(localDir, "components")))
+
+	require.NoError(t, g.SetComponents(ctx, []string{"a@one", "a@two"}))
+	assert.True(t, exists(filepath.Join(localDir, "components", "a", "container.container")))
+	assert.False(t, exists(filepath.Join(localDir, "components", "b")))
+	assert.False(t, exists(filepath.Join(localDir, "components", "ab")))
+
+	commitFiles(t, remote, remoteDir, map[string]string{
+		"components/a/new.container": "",
+		"components/b/new.container": "",
+	})
+	report, err := g.Sync(ctx, source.SyncOpts{})
+	require.NoError(t, err)
+	assert.NotEqual(t, report.OldRevision, report.NewRevision)
+	assert.True(t, exists(filepath.Join(localDir, "components", "a", "new.container")))
+	assert.False(t, exists(filepath.Join(localDir, "components", "b")))
+
+	require.NoError(t, g.SetComponents(ctx, []string{"b"}))
+	assert.False(t, exists(filepath.Join(localDir, "components", "a")))
+	assert.True(t, exists(filepath.Join(localDir, "components", "b", "new.container")))
+
+	// the same components again leave the worktree alone
+	marker := filepath.Join(localDir, "components", "b", "new.container")
+	require.NoError(t, os.WriteFile(marker, []byte("local"), 0o644))
+	require.NoError(t, g.SetComponents(ctx, []string{"b"}))
+	data, err := os.ReadFile(marker)
+	require.NoError(t, err)
+	assert.Equal(t, "local", string(data))
+	require.NoError(t, os.WriteFile(marker, nil, 0o644))
+
+	// a new process keeps the components already checked out
+	g, err = NewGitSource(&Config{
+		URL:             remoteDir,
+		Branch:          "master",
+		LocalRepository: localDir,
+		SparseCheckout:  true,
+	})
+	require.NoError(t, err)
+	_, err = g.Sync(ctx, source.SyncOpts{})
+	require.NoError(t, err)
+	assert.True(t, exists(filepath.Join(localDir, "components", "b", "new.container")))
+	assert.False(t, exists(filepath.Join(localDir, "components", "a")))
+}
+
+func TestGitSource_Depth(t *testing.T) {
+	dir := t.TempDir()
+	remoteDir := filepath.Join(dir, "remote")
+	remote, err := git.PlainInit(remoteDir, false)
+	require.NoError(t, err)
+	commitFiles(t, remote, remoteDir, map[string]string{"a": "1"})
+	commitFiles(t, remote, remoteDir, map[string]string{"a": "2"})
+
+	_, err = NewGitSource(&Config{URL: remoteDir, Depth: -1})
+	assert.Error(t, err)
+
+	localDir := filepath.Join(dir, "local")
+	g, err := NewGitSource(&Config{
+		URL:             "file://" + remoteDir,
+		Branch:          "master",
+		LocalRepository: localDir,
+		Depth:           1,
+	})
+	require.NoError(t, err)
+	_, err = g.Sync(context.Background(), source.SyncOpts{})
+	require.NoError(t, err)
+
+	local, err := git.PlainOpen(localDir)
+	require.NoError(t, err)
+	commits, err := local.Log(&git.LogOptions{})
+	require.NoError(t, err)
+	count := 0
+	_ = commits.ForEach(func(*object.Commit) error {
+		count++
+		return nil
+	})
+	assert.Equal(t, 1, count)
+}
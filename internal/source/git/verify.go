@@ -0,0 +1,102 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"primamateria.systems/materia/internal/sshsig"
+)
+
+// sshsigNamespace is the namespace git uses for ssh signatures
+const sshsigNamespace = "git"
+
+var ErrUnverifiedRevision = errors.New("revision failed signature verification")
+
+type signableObject interface {
+	EncodeWithoutSignature(o plumbing.EncodedObject) error
+}
+
+// signatureVerifier checks commit and tag signatures against a trusted OpenPGP keyring and/or SSH allowed signers
+type signatureVerifier struct {
+	keyring openpgp.EntityList
+	signers []sshsig.AllowedSigner
+}
+
+func newSignatureVerifier(keyringFile, allowedSignersFile string) (*signatureVerifier, error) {
+	if keyringFile == "" && allowedSignersFile == "" {
+		return nil, errors.New("signature verification needs a signing keyring or allowed signers file")
+	}
+	v := &signatureVerifier{}
+	if keyringFile != "" {
+		data, err := os.ReadFile(keyringFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read signing keyring: %w", err)
+		}
+		v.keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing keyring %v: %w", keyringFile, err)
+		}
+	}
+	if allowedSignersFile != "" {
+		data, err := os.ReadFile(allowedSignersFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read allowed signers: %w", err)
+		}
+		v.signers, err = sshsig.ParseAllowedSigners(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed signers %v: %w", allowedSignersFile, err)
+		}
+	}
+	return v, nil
+}
+
+func (v *signatureVerifier) verifyCommit(c *object.Commit) error {
+	return v.verify(c, c.PGPSignature, c.Committer.When)
+}
+
+func (v *signatureVerifier) verifyTag(t *object.Tag) error {
+	return v.verify(t, t.PGPSignature, t.Tagger.When)
+}
+
+// verify checks an object's signature, with ssh signer validity checked against when it was signed like git does
+func (v *signatureVerifier) verify(obj signableObject, signature string, signedAt time.Time) error {
+	signature = strings.TrimSpace(signature)
+	if signature == "" {
+		return errors.New("no signature")
+	}
+	encoded := &plumbing.MemoryObject{}
+	if err := obj.EncodeWithoutSignature(encoded); err != nil {
+		return err
+	}
+	r, err := encoded.Reader()
+	if err != nil {
+		return err
+	}
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(signature, "-----BEGIN SSH SIGNATURE-----") {
+		if len(v.signers) == 0 {
+			return errors.New("ssh signature found but no allowed signers configured")
+		}
+		_, err := sshsig.VerifyAt(v.signers, []byte(signature), payload, sshsigNamespace, signedAt)
+		return err
+	}
+	if len(v.keyring) == 0 {
+		return errors.New("openpgp signature found but no signing keyring configured")
+	}
+	if strings.Count(signature, "-----BEGIN PGP SIGNATURE-----") > 1 {
+		return object.ErrMultipleSignatures
+	}
+	_, err = openpgp.CheckArmoredDetachedSignature(v.keyring, bytes.NewReader(payload), strings.NewReader(signature), nil)
+	return err
+}
@@ -0,0 +1,217 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"primamateria.systems/materia/internal/sshsig"
+	"primamateria.systems/materia/pkg/source"
+)
+
+type testSSHSigner struct {
+	signer ssh.Signer
+}
+
+func (s *testSSHSigner) Sign(message io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(message)
+	if err != nil {
+		return nil, err
+	}
+	return sshsig.Sign(s.signer, sshsigNamespace, data)
+}
+
+func newSSHSigner(t *testing.T) *testSSHSigner {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	return &testSSHSigner{signer: signer}
+}
+
+func writeAllowedSigners(t *testing.T, dir string, signers ...*testSSHSigner) string {
+	var buf bytes.Buffer
+	for i, s := range signers {
+		fmt.Fprintf(&buf, "user%v@example.com namespaces=\"git\" %s", i, ssh.MarshalAuthorizedKey(s.signer.PublicKey()))
+	}
+	path := filepath.Join(dir, "allowed_signers")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+	return path
+}
+
+func writeKeyring(t *testing.T, dir string, entity *openpgp.Entity) string {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(w))
+	require.NoError(t, w.Close())
+	path := filepath.Join(dir, "keyring.asc")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+	return path
+}
+
+func commitFile(t *testing.T, r *git.Repository, dir, name string, opts *git.CommitOptions) *object.Commit {
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644))
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	_, err = w.Add(name)
+	require.NoError(t, err)
+	opts.Author = &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	hash, err := w.Commit("add "+name, opts)
+	require.NoError(t, err)
+	c, err := r.CommitObject(hash)
+	require.NoError(t, err)
+	return c
+}
+
+func TestSignatureVerifier_SSH(t *testing.T) {
+	dir := t.TempDir()
+	repoDir := filepath.Join(dir, "repo")
+	r, err := git.PlainInit(repoDir, false)
+	require.NoError(t, err)
+
+	trusted := newSSHSigner(t)
+	untrusted := newSSHSigner(t)
+	v, err := newSignatureVerifier("", writeAllowedSigners(t, dir, trusted))
+	require.NoError(t, err)
+
+	signed := commitFile(t, r, repoDir, "a", &git.CommitOptions{Signer: trusted})
+	assert.NoError(t, v.verifyCommit(signed))
+
+	other := commitFile(t, r, repoDir, "b", &git.CommitOptions{Signer: untrusted})
+	assert.Error(t, v.verifyCommit(other))
+
+	unsigned := commitFile(t, r, repoDir, "c", &git.CommitOptions{})
+	assert.Error(t, v.verifyCommit(unsigned))
+
+	tampered := *signed
+	tampered.Message = "something else"
+	assert.Error(t, v.verifyCommit(&tampered))
+}
+
+func TestSignatureVerifier_OpenPGP(t *testing.T) {
+	dir := t.TempDir()
+	repoDir := filepath.Join(dir, "repo")
+	r, err := git.PlainInit(repoDir, false)
+	require.NoError(t, err)
+
+	trusted, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	require.NoError(t, err)
+	untrusted, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	require.NoError(t, err)
+	v, err := newSignatureVerifier(writeKeyring(t, dir, trusted), "")
+	require.NoError(t, err)
+
+	signed := commitFile(t, r, repoDir, "a", &git.CommitOptions{SignKey: trusted})
+	assert.NoError(t, v.verifyCommit(signed))
+
+	other := commitFile(t, r, repoDir, "b", &git.CommitOptions{SignKey: untrusted})
+	assert.Error(t, v.verifyCommit(other))
+
+	sshSigned := commitFile(t, r, repoDir, "c", &git.CommitOptions{Signer: newSSHSigner(t)})
+	assert.Error(t, v.verifyCommit(sshSigned))
+}
+
+func TestGitSource_SyncVerification(t *testing.T) {
+	dir := t.TempDir()
+	remoteDir := filepath.Join(dir, "remote")
+	remote, err := git.PlainInit(remoteDir, false)
+	require.NoError(t, err)
+	signer := newSSHSigner(t)
+	first := commitFile(t, remote, remoteDir, "a", &git.CommitOptions{Signer: signer})
+
+	localDir := filepath.Join(dir, "local")
+	g, err := NewGitSource(&Config{
+		URL:             remoteDir,
+		Branch:          "master",
+		LocalRepository: localDir,
+		Verify:          true,
+		AllowedSigners:  writeAllowedSigners(t, dir, signer),
+	})
+	require.NoError(t, err)
+
+	report, err := g.Sync(context.Background(), source.SyncOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, first.Hash.String(), report.NewRevision)
+
+	commitFile(t, remote, remoteDir, "b", &git.CommitOptions{})
+	_, err = g.Sync(context.Background(), source.SyncOpts{})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrUnverifiedRevision))
+
+	local, err := git.PlainOpen(localDir)
+	require.NoError(t, err)
+	head, err := local.Head()
+	require.NoError(t, err)
+	assert.Equal(t, first.Hash, head.Hash())
+	_, err = os.Stat(filepath.Join(localDir, "b"))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestGitSource_SyncPinnedTag(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	remoteDir := filepath.Join(dir, "remote")
+	remote, err := git.PlainInit(remoteDir, false)
+	require.NoError(t, err)
+	trusted, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	require.NoError(t, err)
+	tagger := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+
+	signed := commitFile(t, remote, remoteDir, "a", &git.CommitOptions{})
+	_, err = remote.CreateTag("v1.0.0", signed.Hash, &git.CreateTagOptions{Tagger: tagger, Message: "v1.0.0", SignKey: trusted})
+	require.NoError(t, err)
+	unsigned := commitFile(t, remote, remoteDir, "b", &git.CommitOptions{})
+	_, err = remote.CreateTag("v1.1.0", unsigned.Hash, &git.CreateTagOptions{Tagger: tagger, Message: "v1.1.0"})
+	require.NoError(t, err)
+	untagged := commitFile(t, remote, remoteDir, "c", &git.CommitOptions{SignKey: trusted})
+	keyring := writeKeyring(t, dir, trusted)
+
+	tests := []struct {
+		name     string
+		config   Config
+		revision *object.Commit
+		ok       bool
+	}{
+		{"version pinned to a signed tag", Config{Version: "^1"}, signed, true},
+		{"version pinned to an unsigned tag", Config{Version: "^1"}, unsigned, false},
+		{"version pinned to an untagged commit", Config{Version: "^1"}, untagged, false},
+		{"version pinned outside the constraint", Config{Version: "~1.1"}, signed, false},
+		{"tag pinned to its commit", Config{Tag: "v1.0.0"}, signed, true},
+		{"tag pinned to another commit", Config{Tag: "v1.0.0"}, untagged, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.config
+			c.URL = remoteDir
+			c.LocalRepository = filepath.Join(t.TempDir(), "local")
+			c.Verify = true
+			c.SigningKeys = keyring
+			g, err := NewGitSource(&c)
+			require.NoError(t, err)
+			report, err := g.Sync(ctx, source.SyncOpts{Revision: tt.revision.Hash.String()})
+			if !tt.ok {
+				require.Error(t, err)
+				assert.True(t, errors.Is(err, ErrUnverifiedRevision))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.revision.Hash.String(), report.NewRevision)
+		})
+	}
+}
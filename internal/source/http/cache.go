@@ -0,0 +1,111 @@
+package http
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const archiveHistorySize = 5
+
+// CacheSuffix is appended to the local repository path to get the archive cache directory
+const CacheSuffix = ".archives"
+
+const stateFile = "state.json"
+
+// archiveCache keeps recently extracted archives by digest, along with the validators of the last download
+type archiveCache struct {
+	dir string
+}
+
+type cacheState struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	// History holds the extracted revisions, oldest first
+	History []string `json:"history"`
+}
+
+func newArchiveCache(localRepository string) archiveCache {
+	return archiveCache{dir: filepath.Clean(localRepository) + CacheSuffix}
+}
+
+// current returns the revision currently extracted, if any
+func (s *cacheState) current() string {
+	if len(s.History) == 0 {
+		return ""
+	}
+	return s.History[len(s.History)-1]
+}
+
+func (s *cacheState) record(revision string) {
+	s.History = slices.DeleteFunc(s.History, func(r string) bool { return r == revision })
+	s.History = append(s.History, revision)
+	if len(s.History) > archiveHistorySize {
+		s.History = s.History[len(s.History)-archiveHistorySize:]
+	}
+}
+
+func (c archiveCache) load() (*cacheState, error) {
+	state := &cacheState{}
+	data, err := os.ReadFile(filepath.Join(c.dir, stateFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read archive cache: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid archive cache state: %w", err)
+	}
+	return state, nil
+}
+
+// save writes the state and removes archives that dropped out of the history
+func (c archiveCache) save(state *cacheState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(c.dir, stateFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("unable to write archive cache state: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(c.dir, stateFile)); err != nil {
+		return fmt.Errorf("unable to write archive cache state: %w", err)
+	}
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() == stateFile || slices.Contains(state.History, "sha256:"+e.Name()) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(c.dir, e.Name())); err != nil {
+			return fmt.Errorf("unable to prune archive cache: %w", err)
+		}
+	}
+	return nil
+}
+
+// path returns where the archive for revision is cached
+func (c archiveCache) path(revision string) (string, error) {
+	digest, ok := strings.CutPrefix(revision, "sha256:")
+	if !ok {
+		digest = revision
+	}
+	if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != 32 {
+		return "", fmt.Errorf("invalid revision %q: expected a sha256 digest", revision)
+	}
+	return filepath.Join(c.dir, strings.ToLower(digest)), nil
+}
+
+func (c archiveCache) remove() error {
+	return os.RemoveAll(c.dir)
+}
@@ -0,0 +1,52 @@
+package http
+
+import (
+	"fmt"
+
+	"github.com/knadh/koanf/v2"
+)
+
+type Config struct {
+	URL             string `toml:"url" json:"url" yaml:"url"`
+	SHA256          string `koanf:"sha256" toml:"sha256" json:"sha256" yaml:"sha256"`
+	ChecksumURL     string `koanf:"checksum_url" toml:"checksum_url" json:"checksum_url" yaml:"checksum_url"`
+	MinisignKey     string `koanf:"minisign_key" toml:"minisign_key" json:"minisign_key" yaml:"minisign_key"`
+	AllowedSigners  string `koanf:"allowed_signers" toml:"allowed_signers" json:"allowed_signers" yaml:"allowed_signers"`
+	SignatureURL    string `koanf:"signature_url" toml:"signature_url" json:"signature_url" yaml:"signature_url"`
+	LocalRepository string `toml:"local_repository" json:"local_repository" yaml:"local_repository"`
+}
+
+func NewConfig(k *koanf.Koanf, localDir, remoteURL string) (*Config, error) {
+	var c Config
+
+	c.SHA256 = k.String("http.sha256")
+	c.ChecksumURL = k.String("http.checksum_url")
+	c.MinisignKey = k.String("http.minisign_key")
+	c.AllowedSigners = k.String("http.allowed_signers")
+	c.SignatureURL = k.String("http.signature_url")
+	c.LocalRepository = localDir
+	c.URL = remoteURL
+
+	return &c, nil
+}
+
+func (c *Config) String() string {
+	var result string
+	result += fmt.Sprintf("URL: %v\n", c.URL)
+	if c.SHA256 != "" {
+		result += fmt.Sprintf("SHA256: %v\n", c.SHA256)
+	}
+	if c.ChecksumURL != "" {
+		result += fmt.Sprintf("Checksum URL: %v\n", c.ChecksumURL)
+	}
+	if c.MinisignKey != "" {
+		result += fmt.Sprintf("Minisign key: %v\n", c.MinisignKey)
+	}
+	if c.AllowedSigners != "" {
+		result += fmt.Sprintf("Allowed signers: %v\n", c.AllowedSigners)
+	}
+	if c.SignatureURL != "" {
+		result += fmt.Sprintf("Signature URL: %v\n", c.SignatureURL)
+	}
+	return result
+}
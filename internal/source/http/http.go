@@ -0,0 +1,340 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	nethttp "net/http"
+	"os"
+	"path/filepath"
+
+	"charm.land/log/v2"
+	"github.com/klauspost/compress/zstd"
+	"primamateria.systems/materia/internal/archive"
+	"primamateria.systems/materia/pkg/source"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// HTTPSource downloads a repository packaged as a .tar.gz or .tar.zst archive. Revisions are the archive's sha256 digest.
+type HTTPSource struct {
+	url             string
+	localRepository string
+	verifier        *archiveVerifier
+	cache           archiveCache
+	client          *nethttp.Client
+}
+
+func NewHTTPSource(c *Config) (*HTTPSource, error) {
+	if c == nil {
+		return nil, errors.New("need http config")
+	}
+	if c.URL == "" {
+		return nil, errors.New("need http source url")
+	}
+	verifier, err := newArchiveVerifier(c)
+	if err != nil {
+		return nil, err
+	}
+	return &HTTPSource{
+		url:             c.URL,
+		localRepository: c.LocalRepository,
+		verifier:        verifier,
+		cache:           newArchiveCache(c.LocalRepository),
+		client:          nethttp.DefaultClient,
+	}, nil
+}
+
+func (h *HTTPSource) Sync(ctx context.Context, opts source.SyncOpts) (*source.SyncReport, error) {
+	if err := os.MkdirAll(h.cache.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create archive cache: %w", err)
+	}
+	state, err := h.cache.load()
+	if err != nil {
+		return nil, err
+	}
+	report := &source.SyncReport{
+		OldRevision: state.current(),
+	}
+	if opts.Revision != "" {
+		report.NewRevision, err = h.restore(ctx, state, opts.Revision)
+		if err != nil {
+			return nil, err
+		}
+		return report, nil
+	}
+
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, h.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if h.extracted(state.current()) {
+		if state.ETag != "" {
+			req.Header.Set("If-None-Match", state.ETag)
+		}
+		if state.LastModified != "" {
+			req.Header.Set("If-Modified-Since", state.LastModified)
+		}
+	}
+	log.Infof("Downloading %v", h.url)
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download archive: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	switch resp.StatusCode {
+	case nethttp.StatusNotModified:
+		log.Infof("Archive %v not modified", h.url)
+		report.NewRevision = report.OldRevision
+		return report, nil
+	case nethttp.StatusOK:
+	default:
+		return nil, fmt.Errorf("failed to download archive: unexpected status %v", resp.Status)
+	}
+
+	tmp, digest, err := h.download(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.Remove(tmp)
+	}()
+	revision := "sha256:" + digest
+	if err := h.verifier.verify(ctx, h.client, h.url, tmp, digest); err != nil {
+		return nil, fmt.Errorf("%w: %v: %w", ErrUnverifiedArchive, h.url, err)
+	}
+	log.Infof("Verified archive %v", revision)
+	cached, err := h.cache.path(revision)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, cached); err != nil {
+		return nil, fmt.Errorf("unable to cache archive: %w", err)
+	}
+	if revision != state.current() || !h.extracted(revision) {
+		if err := h.extract(cached); err != nil {
+			return nil, err
+		}
+	}
+	state.ETag = resp.Header.Get("ETag")
+	state.LastModified = resp.Header.Get("Last-Modified")
+	state.record(revision)
+	if err := h.cache.save(state); err != nil {
+		return nil, err
+	}
+	report.NewRevision = revision
+	return report, nil
+}
+
+// restore extracts a previously downloaded archive. If it isn't cached, the url is downloaded again and has to match revision.
+func (h *HTTPSource) restore(ctx context.Context, state *cacheState, revision string) (string, error) {
+	cached, err := h.cache.path(revision)
+	if err != nil {
+		return "", err
+	}
+	// already checked out, keep the validators so unlocked syncs can still skip unchanged downloads
+	if revision == state.current() && h.extracted(revision) {
+		return revision, nil
+	}
+	digest, err := fileDigest(cached)
+	if errors.Is(err, fs.ErrNotExist) {
+		if err := h.fetchRevision(ctx, cached); err != nil {
+			return "", fmt.Errorf("archive %v is not cached: %w", revision, err)
+		}
+		digest, err = fileDigest(cached)
+	}
+	if err != nil {
+		return "", err
+	}
+	if digest != filepath.Base(cached) {
+		return "", fmt.Errorf("cached archive %v is corrupted", revision)
+	}
+	revision = "sha256:" + digest
+	if err := h.extract(cached); err != nil {
+		return "", err
+	}
+	// the validators belong to the newest download, forget them so the next sync fetches it again
+	state.ETag, state.LastModified = "", ""
+	state.record(revision)
+	if err := h.cache.save(state); err != nil {
+		return "", err
+	}
+	log.Infof("Restored archive %v", revision)
+	return revision, nil
+}
+
+// fetchRevision downloads the archive into cached, failing if it no longer matches the cached name
+func (h *HTTPSource) fetchRevision(ctx context.Context, cached string) error {
+	tmp, digest, err := h.fetchVerified(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp)
+	}()
+	if digest != filepath.Base(cached) {
+		return fmt.Errorf("%v now serves sha256:%v", h.url, digest)
+	}
+	return os.Rename(tmp, cached)
+}
+
+// LatestRevision downloads and verifies the archive to find its digest, without extracting it
+func (h *HTTPSource) LatestRevision(ctx context.Context) (string, error) {
+	if err := os.MkdirAll(h.cache.dir, 0o755); err != nil {
+		return "", fmt.Errorf("unable to create archive cache: %w", err)
+	}
+	tmp, digest, err := h.fetchVerified(ctx)
+	if err != nil {
+		return "", err
+	}
+	_ = os.Remove(tmp)
+	return "sha256:" + digest, nil
+}
+
+// fetchVerified downloads the archive unconditionally to a temporary file and verifies it
+func (h *HTTPSource) fetchVerified(ctx context.Context) (string, string, error) {
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, h.url, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to download archive: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != nethttp.StatusOK {
+		return "", "", fmt.Errorf("failed to download archive: unexpected status %v", resp.Status)
+	}
+	tmp, digest, err := h.download(resp.Body)
+	if err != nil {
+		return "", "", err
+	}
+	if err := h.verifier.verify(ctx, h.client, h.url, tmp, digest); err != nil {
+		_ = os.Remove(tmp)
+		return "", "", fmt.Errorf("%w: %v: %w", ErrUnverifiedArchive, h.url, err)
+	}
+	return tmp, digest, nil
+}
+
+// extracted reports whether revision is what's currently in the local repository
+func (h *HTTPSource) extracted(revision string) bool {
+	if revision == "" {
+		return false
+	}
+	if _, err := os.Stat(h.localRepository); err != nil {
+		return false
+	}
+	cached, err := h.cache.path(revision)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(cached)
+	return err == nil
+}
+
+// download writes the archive to a temporary file in the cache, returning its path and sha256
+func (h *HTTPSource) download(body io.Reader) (string, string, error) {
+	f, err := os.CreateTemp(h.cache.dir, ".download-*")
+	if err != nil {
+		return "", "", fmt.Errorf("unable to create download file: %w", err)
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, hash), body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", "", fmt.Errorf("failed to download archive: %w", err)
+	}
+	return f.Name(), hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (h *HTTPSource) extract(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	r, err := decompress(f)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	if err := archive.UntarAtomic(r, h.localRepository); err != nil {
+		return fmt.Errorf("failed to extract archive: %w", err)
+	}
+	return nil
+}
+
+// decompress detects gzip and zstd compressed archives, anything else is read as a plain tar
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		d, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return io.NopCloser(br), nil
+	}
+}
+
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (h *HTTPSource) Close(_ context.Context) error {
+	return nil
+}
+
+func (h *HTTPSource) Clean() error {
+	if err := h.cache.remove(); err != nil {
+		return fmt.Errorf("unable to remove archive cache: %w", err)
+	}
+	return os.RemoveAll(h.localRepository)
+}
+
+func (h *HTTPSource) Inspect() source.SyncInspectReport {
+	return source.SyncInspectReport{
+		SupportsRollback: true,
+	}
+}
+
+func (h *HTTPSource) String() string {
+	return fmt.Sprintf("http:%v", h.url)
+}
@@ -0,0 +1,242 @@
+package http
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	nethttp "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"primamateria.systems/materia/pkg/source"
+)
+
+func makeTar(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func zstded(t *testing.T, data []byte) []byte {
+	enc, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	return enc.EncodeAll(data, nil)
+}
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// fileServer serves in-memory files with ETag and Last-Modified support
+type fileServer struct {
+	mu       sync.Mutex
+	files    map[string][]byte
+	modified time.Time
+	requests map[string][]int
+}
+
+func newFileServer(t *testing.T) (*fileServer, string) {
+	fs := &fileServer{files: map[string][]byte{}, requests: map[string][]int{}, modified: time.Now().Add(-time.Hour)}
+	server := httptest.NewServer(fs)
+	t.Cleanup(server.Close)
+	return fs, server.URL
+}
+
+func (f *fileServer) set(name string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[name] = data
+	f.modified = f.modified.Add(time.Minute)
+}
+
+func (f *fileServer) ServeHTTP(w nethttp.ResponseWriter, r *nethttp.Request) {
+	f.mu.Lock()
+	data, ok := f.files[r.URL.Path]
+	modified := f.modified
+	f.mu.Unlock()
+	if !ok {
+		nethttp.NotFound(w, r)
+		f.record(r.URL.Path, nethttp.StatusNotFound)
+		return
+	}
+	w.Header().Set("ETag", fmt.Sprintf("%q", digestOf(data)))
+	rec := &statusRecorder{ResponseWriter: w, status: nethttp.StatusOK}
+	nethttp.ServeContent(rec, r, r.URL.Path, modified, bytes.NewReader(data))
+	f.record(r.URL.Path, rec.status)
+}
+
+func (f *fileServer) record(path string, status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[path] = append(f.requests[path], status)
+}
+
+func (f *fileServer) statuses(path string) []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[path]
+}
+
+type statusRecorder struct {
+	nethttp.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestHTTPSource_Sync(t *testing.T) {
+	ctx := context.Background()
+	server, url := newFileServer(t)
+	first := gzipped(t, makeTar(t, map[string]string{"MANIFEST.toml": "first"}))
+	server.set("/repo.tar.gz", first)
+	server.set("/SHA256SUMS", fmt.Appendf(nil, "%v  repo.tar.gz\n%v  other.tar.gz\n", digestOf(first), digestOf([]byte("other"))))
+
+	localDir := filepath.Join(t.TempDir(), "source")
+	c := &Config{URL: url + "/repo.tar.gz", ChecksumURL: url + "/SHA256SUMS", LocalRepository: localDir}
+	h, err := NewHTTPSource(c)
+	require.NoError(t, err)
+	assert.True(t, h.Inspect().SupportsRollback)
+
+	report, err := h.Sync(ctx, source.SyncOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, "", report.OldRevision)
+	assert.Equal(t, "sha256:"+digestOf(first), report.NewRevision)
+	assert.Equal(t, "first", readFile(t, filepath.Join(localDir, "MANIFEST.toml")))
+
+	// unchanged archives aren't downloaded again, even after a restart
+	h, err = NewHTTPSource(c)
+	require.NoError(t, err)
+	report, err = h.Sync(ctx, source.SyncOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, report.OldRevision, report.NewRevision)
+	assert.Equal(t, []int{nethttp.StatusOK, nethttp.StatusNotModified}, server.statuses("/repo.tar.gz"))
+
+	second := zstded(t, makeTar(t, map[string]string{"MANIFEST.toml": "second"}))
+	server.set("/repo.tar.gz", second)
+	server.set("/SHA256SUMS", fmt.Appendf(nil, "%v  repo.tar.gz\n", digestOf(second)))
+	report, err = h.Sync(ctx, source.SyncOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:"+digestOf(first), report.OldRevision)
+	assert.Equal(t, "sha256:"+digestOf(second), report.NewRevision)
+	assert.Equal(t, "second", readFile(t, filepath.Join(localDir, "MANIFEST.toml")))
+
+	report, err = h.Sync(ctx, source.SyncOpts{Revision: "sha256:" + digestOf(first)})
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:"+digestOf(second), report.OldRevision)
+	assert.Equal(t, "sha256:"+digestOf(first), report.NewRevision)
+	assert.Equal(t, "first", readFile(t, filepath.Join(localDir, "MANIFEST.toml")))
+
+	_, err = h.Sync(ctx, source.SyncOpts{Revision: "sha256:" + digestOf([]byte("missing"))})
+	assert.Error(t, err)
+	_, err = h.Sync(ctx, source.SyncOpts{Revision: "../../etc/passwd"})
+	assert.Error(t, err)
+
+	// a tampered archive is rejected and the old tree is kept
+	server.set("/repo.tar.gz", gzipped(t, makeTar(t, map[string]string{"MANIFEST.toml": "evil"})))
+	_, err = h.Sync(ctx, source.SyncOpts{})
+	assert.ErrorIs(t, err, ErrUnverifiedArchive)
+	assert.Equal(t, "first", readFile(t, filepath.Join(localDir, "MANIFEST.toml")))
+
+	require.NoError(t, h.Clean())
+	assert.NoDirExists(t, localDir)
+	assert.NoDirExists(t, localDir+CacheSuffix)
+}
+
+func TestHTTPSource_History(t *testing.T) {
+	ctx := context.Background()
+	server, url := newFileServer(t)
+	localDir := filepath.Join(t.TempDir(), "source")
+	var revisions []string
+	for i := range archiveHistorySize + 2 {
+		data := gzipped(t, makeTar(t, map[string]string{"MANIFEST.toml": fmt.Sprint(i)}))
+		server.set("/repo.tar.gz", data)
+		h, err := NewHTTPSource(&Config{URL: url + "/repo.tar.gz", SHA256: digestOf(data), LocalRepository: localDir})
+		require.NoError(t, err)
+		report, err := h.Sync(ctx, source.SyncOpts{})
+		require.NoError(t, err)
+		revisions = append(revisions, report.NewRevision)
+	}
+	entries, err := os.ReadDir(localDir + CacheSuffix)
+	require.NoError(t, err)
+	assert.Len(t, entries, archiveHistorySize+1, "archives plus state")
+	state, err := newArchiveCache(localDir).load()
+	require.NoError(t, err)
+	assert.Equal(t, revisions[2:], state.History)
+}
+
+func TestHTTPSource_Revision(t *testing.T) {
+	ctx := context.Background()
+	server, url := newFileServer(t)
+	data := gzipped(t, makeTar(t, map[string]string{"MANIFEST.toml": "pinned"}))
+	server.set("/repo.tar.gz", data)
+	h, err := NewHTTPSource(&Config{URL: url + "/repo.tar.gz", SHA256: digestOf(data), LocalRepository: filepath.Join(t.TempDir(), "source")})
+	require.NoError(t, err)
+
+	latest, err := h.LatestRevision(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:"+digestOf(data), latest)
+
+	// an uncached revision is downloaded when the url still serves it
+	report, err := h.Sync(ctx, source.SyncOpts{Revision: latest})
+	require.NoError(t, err)
+	assert.Equal(t, latest, report.NewRevision)
+	assert.Equal(t, "pinned", readFile(t, filepath.Join(h.localRepository, "MANIFEST.toml")))
+
+	_, err = h.Sync(ctx, source.SyncOpts{Revision: "sha256:" + digestOf([]byte("other"))})
+	assert.Error(t, err)
+
+	// syncing to the revision already checked out doesn't extract it again or forget the validators
+	_, err = h.Sync(ctx, source.SyncOpts{})
+	require.NoError(t, err)
+	marker := filepath.Join(h.localRepository, "marker")
+	require.NoError(t, os.WriteFile(marker, nil, 0o644))
+	report, err = h.Sync(ctx, source.SyncOpts{Revision: latest})
+	require.NoError(t, err)
+	assert.Equal(t, latest, report.NewRevision)
+	assert.FileExists(t, marker)
+	_, err = h.Sync(ctx, source.SyncOpts{})
+	require.NoError(t, err)
+	statuses := server.statuses("/repo.tar.gz")
+	assert.Equal(t, nethttp.StatusNotModified, statuses[len(statuses)-1])
+}
+
+func TestNewHTTPSource_NeedsVerification(t *testing.T) {
+	_, err := NewHTTPSource(&Config{URL: "https://example.com/repo.tar.gz"})
+	assert.Error(t, err)
+}
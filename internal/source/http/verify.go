@@ -0,0 +1,273 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	nethttp "net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+	"primamateria.systems/materia/internal/sshsig"
+)
+
+var ErrUnverifiedArchive = errors.New("archive failed verification")
+
+const (
+	// sshsigNamespace is the namespace `ssh-keygen -Y sign -n file` uses
+	sshsigNamespace = "file"
+
+	minisignSuffix = ".minisig"
+	sshsigSuffix   = ".sig"
+
+	// maxVerificationFileSize bounds checksum and signature downloads
+	maxVerificationFileSize = 1 << 20
+)
+
+// archiveVerifier checks downloaded archives. Every configured check has to pass.
+type archiveVerifier struct {
+	sha256       string
+	checksumURL  string
+	minisignKey  *minisignPublicKey
+	signers      []sshsig.AllowedSigner
+	signatureURL string
+}
+
+func newArchiveVerifier(c *Config) (*archiveVerifier, error) {
+	v := &archiveVerifier{
+		sha256:       strings.ToLower(strings.TrimPrefix(c.SHA256, "sha256:")),
+		checksumURL:  c.ChecksumURL,
+		signatureURL: c.SignatureURL,
+	}
+	if c.MinisignKey != "" {
+		key, err := loadMinisignKey(c.MinisignKey)
+		if err != nil {
+			return nil, err
+		}
+		v.minisignKey = key
+	}
+	if c.AllowedSigners != "" {
+		data, err := os.ReadFile(c.AllowedSigners)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read allowed signers: %w", err)
+		}
+		v.signers, err = sshsig.ParseAllowedSigners(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed signers %v: %w", c.AllowedSigners, err)
+		}
+	}
+	if v.sha256 == "" && v.checksumURL == "" && v.minisignKey == nil && len(v.signers) == 0 {
+		return nil, errors.New("http source needs a sha256, checksum_url, minisign_key or allowed_signers to verify archives")
+	}
+	if v.minisignKey != nil && len(v.signers) > 0 && v.signatureURL != "" {
+		return nil, errors.New("signature_url is ambiguous when both minisign and ssh signatures are configured")
+	}
+	return v, nil
+}
+
+// verify checks the archive at path, downloaded from archiveURL with the given sha256
+func (v *archiveVerifier) verify(ctx context.Context, client *nethttp.Client, archiveURL, path, digest string) error {
+	if v.sha256 != "" && v.sha256 != digest {
+		return fmt.Errorf("sha256 %v does not match expected %v", digest, v.sha256)
+	}
+	if v.checksumURL != "" {
+		sums, err := fetch(ctx, client, v.checksumURL)
+		if err != nil {
+			return fmt.Errorf("unable to download checksums: %w", err)
+		}
+		expected, err := findChecksum(sums, archiveURL)
+		if err != nil {
+			return err
+		}
+		if expected != digest {
+			return fmt.Errorf("sha256 %v does not match published %v", digest, expected)
+		}
+	}
+	if v.minisignKey != nil {
+		sig, err := fetch(ctx, client, v.signatureLocation(archiveURL, minisignSuffix))
+		if err != nil {
+			return fmt.Errorf("unable to download minisign signature: %w", err)
+		}
+		if err := v.minisignKey.verify(sig, path); err != nil {
+			return fmt.Errorf("minisign: %w", err)
+		}
+	}
+	if len(v.signers) > 0 {
+		sig, err := fetch(ctx, client, v.signatureLocation(archiveURL, sshsigSuffix))
+		if err != nil {
+			return fmt.Errorf("unable to download ssh signature: %w", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if _, err := sshsig.Verify(v.signers, sig, data, sshsigNamespace); err != nil {
+			return fmt.Errorf("ssh: %w", err)
+		}
+	}
+	return nil
+}
+
+func (v *archiveVerifier) signatureLocation(archiveURL, suffix string) string {
+	if v.signatureURL != "" {
+		return v.signatureURL
+	}
+	return archiveURL + suffix
+}
+
+func fetch(ctx context.Context, client *nethttp.Client, location string) ([]byte, error) {
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != nethttp.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching %v: %v", location, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxVerificationFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxVerificationFileSize {
+		return nil, fmt.Errorf("%v is too large", location)
+	}
+	return data, nil
+}
+
+// findChecksum looks up the archive in sha256sum style output. A file with a single bare digest applies to any archive.
+func findChecksum(sums []byte, archiveURL string) (string, error) {
+	u, err := url.Parse(archiveURL)
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(u.Path)
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	var lines [][]string
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		lines = append(lines, fields)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if len(lines) == 1 && len(lines[0]) == 1 {
+		return strings.ToLower(lines[0][0]), nil
+	}
+	for _, fields := range lines {
+		if len(fields) == 2 && path.Base(strings.TrimPrefix(fields[1], "*")) == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no checksum published for %v", name)
+}
+
+// minisignPublicKey is a minisign ed25519 public key, see https://jedisct1.github.io/minisign/
+type minisignPublicKey struct {
+	keyID [8]byte
+	key   ed25519.PublicKey
+}
+
+// loadMinisignKey accepts either the path to a minisign .pub file or the encoded key itself
+func loadMinisignKey(value string) (*minisignPublicKey, error) {
+	data, err := os.ReadFile(value)
+	if errors.Is(err, fs.ErrNotExist) {
+		data = []byte(value)
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read minisign key: %w", err)
+	}
+	encoded := lastLine(data, "untrusted comment:")
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+		return nil, errors.New("invalid minisign public key")
+	}
+	k := &minisignPublicKey{key: ed25519.PublicKey(raw[10:])}
+	copy(k.keyID[:], raw[2:10])
+	return k, nil
+}
+
+// lastLine returns the last non-empty line that isn't a comment
+func lastLine(data []byte, commentPrefix string) string {
+	var last string
+	for line := range strings.Lines(string(data)) {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, commentPrefix) {
+			last = line
+		}
+	}
+	return last
+}
+
+// verify checks a minisign signature file for the file at path, including its trusted comment
+func (k *minisignPublicKey) verify(sigFile []byte, path string) error {
+	var lines []string
+	for line := range strings.Lines(string(sigFile)) {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 4 {
+		return errors.New("invalid signature file")
+	}
+	sig, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return errors.New("invalid signature")
+	}
+	if !bytes.Equal(sig[2:10], k.keyID[:]) {
+		return fmt.Errorf("signature key id %X does not match public key %X", sig[2:10], k.keyID)
+	}
+	var message []byte
+	switch string(sig[:2]) {
+	case "ED":
+		h, _ := blake2b.New512(nil)
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(h, f)
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+		message = h.Sum(nil)
+	case "Ed":
+		if message, err = os.ReadFile(path); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported signature algorithm %q", sig[:2])
+	}
+	if !ed25519.Verify(k.key, message, sig[10:]) {
+		return errors.New("bad signature")
+	}
+	trusted, ok := strings.CutPrefix(lines[2], "trusted comment: ")
+	if !ok {
+		return errors.New("invalid trusted comment")
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return errors.New("invalid trusted comment signature")
+	}
+	if !ed25519.Verify(k.key, slices.Concat(sig[10:], []byte(trusted)), globalSig) {
+		return errors.New("bad trusted comment signature")
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/ssh"
+	"primamateria.systems/materia/internal/sshsig"
+	"primamateria.systems/materia/pkg/source"
+)
+
+type testMinisignKey struct {
+	keyID [8]byte
+	priv  ed25519.PrivateKey
+}
+
+func newMinisignKey(t *testing.T) *testMinisignKey {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	k := &testMinisignKey{priv: priv}
+	_, err = rand.Read(k.keyID[:])
+	require.NoError(t, err)
+	return k
+}
+
+func (k *testMinisignKey) public() string {
+	raw := slices.Concat([]byte("Ed"), k.keyID[:], k.priv.Public().(ed25519.PublicKey))
+	return "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(raw) + "\n"
+}
+
+func (k *testMinisignKey) sign(data []byte, prehashed bool) []byte {
+	alg, message := "Ed", data
+	if prehashed {
+		sum := blake2b.Sum512(data)
+		alg, message = "ED", sum[:]
+	}
+	sig := ed25519.Sign(k.priv, message)
+	trusted := "timestamp:1700000000\tfile:repo.tar.gz"
+	global := ed25519.Sign(k.priv, slices.Concat(sig, []byte(trusted)))
+	return []byte("untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(slices.Concat([]byte(alg), k.keyID[:], sig)) + "\n" +
+		"trusted comment: " + trusted + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n")
+}
+
+func TestMinisign(t *testing.T) {
+	dir := t.TempDir()
+	key := newMinisignKey(t)
+	archive := filepath.Join(dir, "repo.tar.gz")
+	require.NoError(t, os.WriteFile(archive, []byte("archive"), 0o644))
+
+	pubFile := filepath.Join(dir, "minisign.pub")
+	require.NoError(t, os.WriteFile(pubFile, []byte(key.public()), 0o644))
+	fromFile, err := loadMinisignKey(pubFile)
+	require.NoError(t, err)
+	inline, err := loadMinisignKey(lastLine([]byte(key.public()), "untrusted comment:"))
+	require.NoError(t, err)
+	assert.Equal(t, fromFile, inline)
+
+	assert.NoError(t, fromFile.verify(key.sign([]byte("archive"), true), archive))
+	assert.NoError(t, fromFile.verify(key.sign([]byte("archive"), false), archive))
+	assert.Error(t, fromFile.verify(key.sign([]byte("other"), true), archive))
+	assert.Error(t, fromFile.verify(newMinisignKey(t).sign([]byte("archive"), true), archive))
+
+	tampered := bytes.Replace(key.sign([]byte("archive"), true), []byte("timestamp"), []byte("timestamq"), 1)
+	assert.Error(t, fromFile.verify(tampered, archive), "trusted comment is signed")
+
+	_, err = loadMinisignKey("not a key")
+	assert.Error(t, err)
+}
+
+func TestHTTPSource_Signatures(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	server, url := newFileServer(t)
+	data := gzipped(t, makeTar(t, map[string]string{"MANIFEST.toml": "signed"}))
+	server.set("/repo.tar.gz", data)
+
+	minisignKey := newMinisignKey(t)
+	server.set("/repo.tar.gz.minisig", minisignKey.sign(data, true))
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	sig, err := sshsig.Sign(signer, sshsigNamespace, data)
+	require.NoError(t, err)
+	server.set("/signatures/repo.sig", sig)
+	allowedSigners := filepath.Join(dir, "allowed_signers")
+	require.NoError(t, os.WriteFile(allowedSigners, append([]byte("release@example.com "), ssh.MarshalAuthorizedKey(signer.PublicKey())...), 0o644))
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"minisign", Config{MinisignKey: minisignKey.public()}, false},
+		{"wrong minisign key", Config{MinisignKey: newMinisignKey(t).public()}, true},
+		{"ssh", Config{AllowedSigners: allowedSigners, SignatureURL: url + "/signatures/repo.sig"}, false},
+		{"missing ssh signature", Config{AllowedSigners: allowedSigners}, true},
+		{"all", Config{SHA256: "sha256:" + digestOf(data), MinisignKey: minisignKey.public()}, false},
+		{"wrong sha256", Config{SHA256: digestOf([]byte("other")), MinisignKey: minisignKey.public()}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.config
+			c.URL = url + "/repo.tar.gz"
+			c.LocalRepository = filepath.Join(t.TempDir(), "source")
+			h, err := NewHTTPSource(&c)
+			require.NoError(t, err)
+			_, err = h.Sync(ctx, source.SyncOpts{})
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrUnverifiedArchive)
+				assert.NoDirExists(t, c.LocalRepository)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "signed", readFile(t, filepath.Join(c.LocalRepository, "MANIFEST.toml")))
+		})
+	}
+}
+
+func TestFindChecksum(t *testing.T) {
+	sums := []byte("# release\naaaa  repo.tar.gz\nbbbb *dist/other.tar.zst\n")
+	got, err := findChecksum(sums, "https://example.com/releases/repo.tar.gz?x=1")
+	require.NoError(t, err)
+	assert.Equal(t, "aaaa", got)
+	got, err = findChecksum(sums, "https://example.com/other.tar.zst")
+	require.NoError(t, err)
+	assert.Equal(t, "bbbb", got)
+	_, err = findChecksum(sums, "https://example.com/missing.tar.gz")
+	assert.Error(t, err)
+	got, err = findChecksum([]byte("CCCC\n"), "https://example.com/repo.tar.gz")
+	require.NoError(t, err)
+	assert.Equal(t, "cccc", got)
+}
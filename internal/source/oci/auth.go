@@ -0,0 +1,137 @@
+package oci
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// keychain resolves registry credentials the way podman does: explicit config, then per registry tokens,
+// then the first auth file with an entry for the repository or registry
+type keychain struct {
+	registry   string
+	basic      *authn.Basic
+	tokenFiles map[string]string
+	authFiles  []string
+}
+
+func newKeychain(c *Config) *keychain {
+	k := &keychain{
+		registry:   c.Registry,
+		tokenFiles: c.TokenFiles,
+		authFiles:  authFiles(c.AuthFile),
+	}
+	if c.Username != "" && c.Password != "" {
+		k.basic = &authn.Basic{
+			Username: c.Username,
+			Password: c.Password,
+		}
+	}
+	return k
+}
+
+// authFiles returns the credential files to search in order, see containers-auth.json(5)
+func authFiles(override string) []string {
+	if override != "" {
+		return []string{override}
+	}
+	var files []string
+	if f := os.Getenv("REGISTRY_AUTH_FILE"); f != "" {
+		files = append(files, f)
+	}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		files = append(files, filepath.Join(runtimeDir, "containers", "auth.json"))
+	} else {
+		files = append(files, fmt.Sprintf("/run/containers/%v/auth.json", os.Getuid()))
+	}
+	home, _ := os.UserHomeDir()
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" && home != "" {
+		configHome = filepath.Join(home, ".config")
+	}
+	if configHome != "" {
+		files = append(files, filepath.Join(configHome, "containers", "auth.json"))
+	}
+	if dockerConfig := os.Getenv("DOCKER_CONFIG"); dockerConfig != "" {
+		files = append(files, filepath.Join(dockerConfig, "config.json"))
+	} else if home != "" {
+		files = append(files, filepath.Join(home, ".docker", "config.json"))
+	}
+	return files
+}
+
+func (k *keychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	if k.basic != nil && target.RegistryStr() == k.registry {
+		return k.basic, nil
+	}
+	keys := lookupKeys(target)
+	for _, key := range keys {
+		if path, ok := k.tokenFiles[key]; ok {
+			token, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read registry token for %v: %w", key, err)
+			}
+			return authn.FromConfig(authn.AuthConfig{RegistryToken: strings.TrimSpace(string(token))}), nil
+		}
+	}
+	for _, file := range k.authFiles {
+		cfg, err := loadAuthFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if cfg == nil {
+			continue
+		}
+		for _, key := range keys {
+			auth, err := cfg.GetAuthConfig(key)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get credentials for %v from %v: %w", key, file, err)
+			}
+			auth.ServerAddress = ""
+			if auth != (types.AuthConfig{}) {
+				return authn.FromConfig(authn.AuthConfig{
+					Username:      auth.Username,
+					Password:      auth.Password,
+					Auth:          auth.Auth,
+					IdentityToken: auth.IdentityToken,
+					RegistryToken: auth.RegistryToken,
+				}), nil
+			}
+		}
+	}
+	return authn.Anonymous, nil
+}
+
+// lookupKeys returns the repository and each of its namespaces, most specific first, followed by the registry
+func lookupKeys(target authn.Resource) []string {
+	var keys []string
+	for key := target.String(); key != target.RegistryStr() && key != "."; key = filepath.Dir(key) {
+		keys = append(keys, key)
+	}
+	return append(keys, target.RegistryStr())
+}
+
+func loadAuthFile(path string) (*configfile.ConfigFile, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to open auth file: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	cfg := configfile.New(path)
+	if err := cfg.LoadFromReader(f); err != nil {
+		return nil, fmt.Errorf("invalid auth file %v: %w", path, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,66 @@
+package oci
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func resolveAuth(t *testing.T, k *keychain, repository string) *authn.AuthConfig {
+	repo, err := name.NewRepository(repository)
+	require.NoError(t, err)
+	auth, err := k.Resolve(repo)
+	require.NoError(t, err)
+	cfg, err := auth.Authorization()
+	require.NoError(t, err)
+	return cfg
+}
+
+func TestKeychain(t *testing.T) {
+	dir := t.TempDir()
+	basic := func(user, pass string) string {
+		return base64.StdEncoding.EncodeToString([]byte(user + ":" + pass))
+	}
+	authFile := filepath.Join(dir, "auth.json")
+	require.NoError(t, os.WriteFile(authFile, []byte(`{"auths": {
+		"registry.example.com": {"auth": "`+basic("registry", "pw")+`"},
+		"registry.example.com/team": {"auth": "`+basic("team", "pw")+`"}
+	}}`), 0o600))
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("secret-token\n"), 0o600))
+
+	k := newKeychain(&Config{
+		Registry:   "explicit.example.com",
+		Username:   "explicit",
+		Password:   "pw",
+		AuthFile:   authFile,
+		TokenFiles: map[string]string{"tokens.example.com": tokenFile},
+	})
+
+	assert.Equal(t, "explicit", resolveAuth(t, k, "explicit.example.com/repo").Username)
+	assert.Equal(t, "secret-token", resolveAuth(t, k, "tokens.example.com/repo").RegistryToken)
+	assert.Equal(t, "team", resolveAuth(t, k, "registry.example.com/team/repo").Username)
+	assert.Equal(t, "registry", resolveAuth(t, k, "registry.example.com/other/repo").Username)
+	assert.Equal(t, authn.AuthConfig{}, *resolveAuth(t, k, "unknown.example.com/repo"))
+}
+
+func TestKeychain_SearchOrder(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("REGISTRY_AUTH_FILE", filepath.Join(dir, "registry-auth.json"))
+	t.Setenv("XDG_RUNTIME_DIR", filepath.Join(dir, "run"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("DOCKER_CONFIG", filepath.Join(dir, "docker"))
+	assert.Equal(t, []string{
+		filepath.Join(dir, "registry-auth.json"),
+		filepath.Join(dir, "run", "containers", "auth.json"),
+		filepath.Join(dir, "config", "containers", "auth.json"),
+		filepath.Join(dir, "docker", "config.json"),
+	}, authFiles(""))
+	assert.Equal(t, []string{"override.json"}, authFiles("override.json"))
+}
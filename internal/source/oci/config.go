@@ -8,12 +8,19 @@ import (
 )
 
 type Config struct {
-	URL             string `toml:"url" json:"url" yaml:"url"`
-	Tag             string `toml:"tag" json:"tag" yaml:"tag"`
-	Username        string `toml:"username" json:"username" yaml:"username"`
-	Password        string `toml:"password" json:"password" yaml:"password"`
-	Insecure        bool   `toml:"insecure" json:"insecure" yaml:"insecure"`
-	LocalRepository string `toml:"local_repository" json:"local_repository" yaml:"local_repository"`
+	URL             string            `toml:"url" json:"url" yaml:"url"`
+	Tag             string            `toml:"tag" json:"tag" yaml:"tag"`
+	Version         string            `toml:"version" json:"version" yaml:"version"`
+	Username        string            `toml:"username" json:"username" yaml:"username"`
+	Password        string            `toml:"password" json:"password" yaml:"password"`
+	Insecure        bool              `toml:"insecure" json:"insecure" yaml:"insecure"`
+	LocalRepository string            `toml:"local_repository" json:"local_repository" yaml:"local_repository"`
+	Verify          bool              `koanf:"verify" toml:"verify" json:"verify" yaml:"verify"`
+	CosignKey       string            `koanf:"cosign_key" toml:"cosign_key" json:"cosign_key" yaml:"cosign_key"`
+	NotationCerts   string            `koanf:"notation_certs" toml:"notation_certs" json:"notation_certs" yaml:"notation_certs"`
+	AuthFile        string            `koanf:"auth_file" toml:"auth_file" json:"auth_file" yaml:"auth_file"`
+	TokenFiles      map[string]string `koanf:"token_files" toml:"token_files" json:"token_files" yaml:"token_files"`
+	RegistriesConf  string            `koanf:"registries_conf" toml:"registries_conf" json:"registries_conf" yaml:"registries_conf"`
 
 	// Parsed fields
 	Registry   string
@@ -27,12 +34,35 @@ func NewConfig(k *koanf.Koanf, localDir, remoteURL string) (*Config, error) {
 	c.Password = k.String("oci.password")
 	c.Insecure = k.Bool("oci.insecure")
 	c.Tag = k.String("oci.tag")
+	c.Version = k.String("oci.version")
+	c.Verify = k.Bool("oci.verify")
+	c.CosignKey = k.String("oci.cosign_key")
+	c.NotationCerts = k.String("oci.notation_certs")
+	c.AuthFile = k.String("oci.auth_file")
+	c.TokenFiles = k.StringMap("oci.token_files")
+	c.RegistriesConf = k.String("oci.registries_conf")
 	c.LocalRepository = localDir
 	c.URL = remoteURL
 
 	return &c, nil
 }
 
+// NewPublishConfig creates the config for publishing to remoteURL. Only the credential and registry settings are taken
+// from the host's oci config, the tag and version come from remoteURL and nothing is verified.
+func NewPublishConfig(k *koanf.Koanf, remoteURL string) (*Config, error) {
+	var c Config
+
+	c.Username = k.String("oci.username")
+	c.Password = k.String("oci.password")
+	c.Insecure = k.Bool("oci.insecure")
+	c.AuthFile = k.String("oci.auth_file")
+	c.TokenFiles = k.StringMap("oci.token_files")
+	c.RegistriesConf = k.String("oci.registries_conf")
+	c.URL = remoteURL
+
+	return &c, nil
+}
+
 func (c *Config) parseURL() error {
 	// Expected format: oci://registry.example.com/namespace/repository:tag
 	// or: oci://registry.example.com/namespace/repository@sha256:digest
@@ -77,9 +107,28 @@ func (c *Config) String() string {
 	result += fmt.Sprintf("Registry: %v\n", c.Registry)
 	result += fmt.Sprintf("Repository: %v\n", c.Repository)
 	result += fmt.Sprintf("Tag: %v\n", c.Tag)
+	if c.Version != "" {
+		result += fmt.Sprintf("Version: %v\n", c.Version)
+	}
 	result += fmt.Sprintf("Allow Insecure: %v\n", c.Insecure)
+	result += fmt.Sprintf("Verify signatures: %v\n", c.Verify)
+	if c.CosignKey != "" {
+		result += fmt.Sprintf("Cosign key: %v\n", c.CosignKey)
+	}
+	if c.NotationCerts != "" {
+		result += fmt.Sprintf("Notation certificates: %v\n", c.NotationCerts)
+	}
 	if c.Username != "" {
 		result += fmt.Sprintf("Username: %v\n", c.Username)
 	}
+	if c.AuthFile != "" {
+		result += fmt.Sprintf("Auth file: %v\n", c.AuthFile)
+	}
+	for registry, file := range c.TokenFiles {
+		result += fmt.Sprintf("Token file for %v: %v\n", registry, file)
+	}
+	if c.RegistriesConf != "" {
+		result += fmt.Sprintf("Registries config: %v\n", c.RegistriesConf)
+	}
 	return result
 }
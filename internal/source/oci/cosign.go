@@ -0,0 +1,208 @@
+package oci
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+)
+
+const (
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	cosignPayloadType         = "cosign container image signature"
+	cosignSignatureSuffix     = ".sig"
+	cosignPayloadMediaType    = "application/vnd.dev.cosign.simplesigning.v1+json"
+)
+
+// cosignPayload is the simple signing payload cosign signs, see https://github.com/containers/image/blob/main/docs/containers-signature.5.md
+type cosignPayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// cosignSignatureTag returns the tag cosign stores signatures for digest under
+func cosignSignatureTag(digest name.Digest) name.Tag {
+	return digest.Context().Tag(strings.Replace(digest.DigestStr(), ":", "-", 1) + cosignSignatureSuffix)
+}
+
+// verifyCosign checks the key based cosign signatures stored alongside the image. No transparency log is consulted.
+func (v *signatureVerifier) verifyCosign(digest name.Digest, opts []remote.Option) error {
+	sigImage, err := remote.Image(cosignSignatureTag(digest), opts...)
+	if err != nil {
+		return fmt.Errorf("no signatures found: %w", err)
+	}
+	manifest, err := sigImage.Manifest()
+	if err != nil {
+		return fmt.Errorf("invalid signature manifest: %w", err)
+	}
+	var errs []error
+	for _, desc := range manifest.Layers {
+		encoded, ok := desc.Annotations[cosignSignatureAnnotation]
+		if !ok {
+			continue
+		}
+		layer, err := sigImage.LayerByDigest(desc.Digest)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rc, err := layer.Compressed()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		payload, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := v.verifyCosignPayload(digest, payload, encoded); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return nil
+	}
+	if len(errs) == 0 {
+		return errors.New("no signatures found")
+	}
+	return errors.Join(errs...)
+}
+
+func (v *signatureVerifier) verifyCosignPayload(digest name.Digest, payload []byte, encodedSignature string) error {
+	signature, err := base64.StdEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	if err := verifyWithKey(v.cosignKey, payload, signature); err != nil {
+		return err
+	}
+	var p cosignPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("invalid signature payload: %w", err)
+	}
+	if p.Critical.Type != cosignPayloadType {
+		return fmt.Errorf("unexpected signature payload type %q", p.Critical.Type)
+	}
+	if p.Critical.Image.DockerManifestDigest != digest.DigestStr() {
+		return fmt.Errorf("signature is for %v, not %v", p.Critical.Image.DockerManifestDigest, digest.DigestStr())
+	}
+	return nil
+}
+
+func verifyWithKey(key crypto.PublicKey, payload, signature []byte) error {
+	hashed := sha256.Sum256(payload)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, hashed[:], signature) {
+			return errors.New("bad signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, hashed[:], signature); err != nil {
+			return fmt.Errorf("bad signature: %w", err)
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, payload, signature) {
+			return errors.New("bad signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+	return nil
+}
+
+// loadSigningKey reads an unencrypted PEM private key. Encrypted cosign keys need to be converted with `cosign import-key-pair` or openssl first.
+func loadSigningKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid signing key %v: expected a PEM encoded private key", path)
+	}
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("invalid signing key %v: unsupported PEM type %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key %v: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("invalid signing key %v: unsupported key type %T", path, key)
+	}
+	return signer, nil
+}
+
+func signWithKey(key crypto.Signer, payload []byte) ([]byte, error) {
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		return key.Sign(rand.Reader, payload, crypto.Hash(0))
+	}
+	hashed := sha256.Sum256(payload)
+	return key.Sign(rand.Reader, hashed[:], crypto.SHA256)
+}
+
+// signCosign adds a key based cosign signature for digest next to any existing signatures
+func signCosign(digest name.Digest, key crypto.Signer, opts []remote.Option) error {
+	var p cosignPayload
+	p.Critical.Identity.DockerReference = digest.Context().String()
+	p.Critical.Image.DockerManifestDigest = digest.DigestStr()
+	p.Critical.Type = cosignPayloadType
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	signature, err := signWithKey(key, payload)
+	if err != nil {
+		return fmt.Errorf("unable to sign image: %w", err)
+	}
+	tag := cosignSignatureTag(digest)
+	var base v1.Image = empty.Image
+	if existing, err := remote.Image(tag, opts...); err == nil {
+		base = existing
+	}
+	sigImage, err := mutate.Append(base, mutate.Addendum{
+		Layer:       static.NewLayer(payload, cosignPayloadMediaType),
+		Annotations: map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(signature)},
+	})
+	if err != nil {
+		return err
+	}
+	if err := remote.Write(tag, sigImage, opts...); err != nil {
+		return fmt.Errorf("unable to push signature: %w", err)
+	}
+	return nil
+}
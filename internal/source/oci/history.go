@@ -0,0 +1,73 @@
+package oci
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const digestHistorySize = 10
+
+// DigestHistorySuffix is appended to the local repository path to get the digest history file
+const DigestHistorySuffix = ".digests"
+
+// digestHistory records the digests extracted into a local repository, oldest first, so a previous image can be restored after the tag moved
+type digestHistory struct {
+	path string
+}
+
+func newDigestHistory(localRepository string) digestHistory {
+	return digestHistory{path: filepath.Clean(localRepository) + DigestHistorySuffix}
+}
+
+func (h digestHistory) list() ([]string, error) {
+	data, err := os.ReadFile(h.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read digest history: %w", err)
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// current returns the digest currently extracted, if any
+func (h digestHistory) current() (string, error) {
+	digests, err := h.list()
+	if err != nil || len(digests) == 0 {
+		return "", err
+	}
+	return digests[len(digests)-1], nil
+}
+
+func (h digestHistory) record(digest string) error {
+	digests, err := h.list()
+	if err != nil {
+		return err
+	}
+	if len(digests) > 0 && digests[len(digests)-1] == digest {
+		return nil
+	}
+	digests = append(digests, digest)
+	if len(digests) > digestHistorySize {
+		digests = digests[len(digests)-digestHistorySize:]
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(digests, "\n")+"\n"), 0o644); err != nil {
+		return fmt.Errorf("unable to write digest history: %w", err)
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		return fmt.Errorf("unable to write digest history: %w", err)
+	}
+	return nil
+}
+
+func (h digestHistory) remove() error {
+	if err := os.Remove(h.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
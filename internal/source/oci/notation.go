@@ -0,0 +1,238 @@
+package oci
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const (
+	notationArtifactType  = "application/vnd.cncf.notary.signature"
+	notationJWSMediaType  = "application/jose+json"
+	notationPayloadType   = "application/vnd.cncf.notary.payload.v1+json"
+	notationSigningScheme = "io.cncf.notary.signingScheme"
+	notationExpiry        = "io.cncf.notary.expiry"
+	notationSchemeX509    = "notary.x509"
+)
+
+// supported critical headers, anything else has to be rejected
+var notationCriticalHeaders = []string{notationSigningScheme, notationExpiry}
+
+type notationEnvelope struct {
+	Payload   string `json:"payload"`
+	Protected string `json:"protected"`
+	Header    struct {
+		CertChain [][]byte `json:"x5c"`
+	} `json:"header"`
+	Signature string `json:"signature"`
+}
+
+type notationProtectedHeader struct {
+	Algorithm     string    `json:"alg"`
+	ContentType   string    `json:"cty"`
+	Critical      []string  `json:"crit"`
+	SigningScheme string    `json:"io.cncf.notary.signingScheme"`
+	Expiry        time.Time `json:"io.cncf.notary.expiry"`
+}
+
+type notationPayload struct {
+	TargetArtifact v1.Descriptor `json:"targetArtifact"`
+}
+
+// verifyNotation checks notation JWS signatures attached to the image as referrers
+func (v *signatureVerifier) verifyNotation(digest name.Digest, opts []remote.Option) error {
+	referrers, err := remote.Referrers(digest, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to list signatures: %w", err)
+	}
+	index, err := referrers.IndexManifest()
+	if err != nil {
+		return fmt.Errorf("failed to list signatures: %w", err)
+	}
+	var errs []error
+	for _, desc := range index.Manifests {
+		if desc.ArtifactType != notationArtifactType {
+			continue
+		}
+		envelope, err := fetchNotationEnvelope(digest.Context().Digest(desc.Digest.String()), opts)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := v.verifyNotationEnvelope(digest, envelope); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return nil
+	}
+	if len(errs) == 0 {
+		return errors.New("no signatures found")
+	}
+	return errors.Join(errs...)
+}
+
+func fetchNotationEnvelope(ref name.Digest, opts []remote.Option) ([]byte, error) {
+	sigImage, err := remote.Image(ref, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signature %v: %w", ref.DigestStr(), err)
+	}
+	manifest, err := sigImage.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature manifest: %w", err)
+	}
+	if len(manifest.Layers) != 1 {
+		return nil, fmt.Errorf("signature %v should have exactly one envelope", ref.DigestStr())
+	}
+	if manifest.Layers[0].MediaType != notationJWSMediaType {
+		return nil, fmt.Errorf("unsupported signature envelope %v", manifest.Layers[0].MediaType)
+	}
+	layer, err := sigImage.LayerByDigest(manifest.Layers[0].Digest)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	return io.ReadAll(rc)
+}
+
+func (v *signatureVerifier) verifyNotationEnvelope(digest name.Digest, data []byte) error {
+	var envelope notationEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("invalid signature envelope: %w", err)
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(envelope.Protected)
+	if err != nil {
+		return fmt.Errorf("invalid protected header: %w", err)
+	}
+	var header notationProtectedHeader
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return fmt.Errorf("invalid protected header: %w", err)
+	}
+	if header.ContentType != notationPayloadType {
+		return fmt.Errorf("unexpected payload type %q", header.ContentType)
+	}
+	if header.SigningScheme != notationSchemeX509 {
+		return fmt.Errorf("unsupported signing scheme %q", header.SigningScheme)
+	}
+	for _, c := range header.Critical {
+		if !slices.Contains(notationCriticalHeaders, c) {
+			return fmt.Errorf("unsupported critical header %q", c)
+		}
+	}
+	if !header.Expiry.IsZero() && time.Now().After(header.Expiry) {
+		return fmt.Errorf("signature expired at %v", header.Expiry)
+	}
+
+	leaf, err := v.verifyNotationChain(envelope.Header.CertChain)
+	if err != nil {
+		return err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(envelope.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	signingInput := []byte(envelope.Protected + "." + envelope.Payload)
+	if err := verifyJWS(header.Algorithm, leaf.PublicKey, signingInput, signature); err != nil {
+		return err
+	}
+
+	rawPayload, err := base64.RawURLEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	var payload notationPayload
+	if err := json.Unmarshal(rawPayload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	if payload.TargetArtifact.Digest.String() != digest.DigestStr() {
+		return fmt.Errorf("signature is for %v, not %v", payload.TargetArtifact.Digest, digest.DigestStr())
+	}
+	return nil
+}
+
+// verifyNotationChain checks the signing certificate chains to a trusted certificate and returns the signing certificate
+func (v *signatureVerifier) verifyNotationChain(chain [][]byte) (*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("signature has no certificate chain")
+	}
+	certs := make([]*x509.Certificate, 0, len(chain))
+	for _, der := range chain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate in chain: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         v.notationRoots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return nil, fmt.Errorf("untrusted signing certificate: %w", err)
+	}
+	return certs[0], nil
+}
+
+func verifyJWS(alg string, key crypto.PublicKey, signingInput, signature []byte) error {
+	var h crypto.Hash
+	switch alg {
+	case "PS256", "ES256":
+		h = crypto.SHA256
+	case "PS384", "ES384":
+		h = crypto.SHA384
+	case "PS512", "ES512":
+		h = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signature algorithm %q", alg)
+	}
+	hasher := h.New()
+	hasher.Write(signingInput)
+	hashed := hasher.Sum(nil)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'P' {
+			return fmt.Errorf("algorithm %v does not match RSA key", alg)
+		}
+		if err := rsa.VerifyPSS(k, h, hashed, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}); err != nil {
+			return fmt.Errorf("bad signature: %w", err)
+		}
+	case *ecdsa.PublicKey:
+		if alg[0] != 'E' {
+			return fmt.Errorf("algorithm %v does not match ECDSA key", alg)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("bad signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, hashed, r, s) {
+			return errors.New("bad signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+	return nil
+}
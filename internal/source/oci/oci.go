@@ -1,19 +1,21 @@
 package oci
 
 import (
-	"archive/tar"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"io"
+	"net/http"
 	"os"
-	"path/filepath"
+	"strings"
 
 	"charm.land/log/v2"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"primamateria.systems/materia/internal/archive"
+	"primamateria.systems/materia/internal/source/version"
 	"primamateria.systems/materia/pkg/source"
 )
 
@@ -21,33 +23,59 @@ type OCISource struct {
 	registry        string
 	repository      string
 	tag             string
+	version         *version.Constraint
 	localRepository string
-	auth            authn.Authenticator
+	keychain        authn.Keychain
+	registries      *registriesConf
 	insecure        bool
+	verifier        *signatureVerifier
+	history         digestHistory
 }
 
 func NewOCISource(c *Config) (*OCISource, error) {
 	if c == nil {
 		return nil, errors.New("need OCI config")
 	}
+	explicitTag := c.Tag != ""
 	if err := c.parseURL(); err != nil {
 		return nil, fmt.Errorf("unable to parse OCI url: %w", err)
 	}
+	var constraint *version.Constraint
+	if c.Version != "" {
+		if explicitTag || c.Tag != "latest" {
+			return nil, errors.New("OCI version can't be used with a tag or digest")
+		}
+		var err error
+		if constraint, err = version.ParseConstraint(c.Version); err != nil {
+			return nil, err
+		}
+	}
 	o := &OCISource{
+		version:         constraint,
 		registry:        c.Registry,
 		repository:      c.Repository,
 		tag:             c.Tag,
 		localRepository: c.LocalRepository,
 		insecure:        c.Insecure,
+		history:         newDigestHistory(c.LocalRepository),
+	}
+
+	o.keychain = newKeychain(c)
+	confPath, dropInDir := defaultRegistriesConf()
+	if c.RegistriesConf != "" {
+		confPath, dropInDir = c.RegistriesConf, ""
+	}
+	var err error
+	o.registries, err = loadRegistriesConf(confPath, dropInDir)
+	if err != nil {
+		return nil, err
 	}
 
-	if c.Username != "" && c.Password != "" {
-		o.auth = &authn.Basic{
-			Username: c.Username,
-			Password: c.Password,
+	if c.Verify {
+		o.verifier, err = newSignatureVerifier(c.CosignKey, c.NotationCerts)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		o.auth = authn.Anonymous
 	}
 
 	return o, nil
@@ -55,28 +83,47 @@ func NewOCISource(c *Config) (*OCISource, error) {
 
 func (o *OCISource) Sync(ctx context.Context, opts source.SyncOpts) (*source.SyncReport, error) {
 	revision := o.tag
+	var resolution version.Resolution
 	if opts.Revision != "" {
 		// Debatable whether OCI should support a seperate revision here
 		revision = opts.Revision
+	} else if o.version != nil {
+		var err error
+		if resolution, err = o.resolveVersion(ctx); err != nil {
+			return nil, err
+		}
+		revision = resolution.Tag
 	}
-	imageRef := fmt.Sprintf("%s/%s:%s", o.registry, o.repository, revision)
-	log.Infof("Pulling OCI image %s", imageRef)
-
-	ref, err := name.ParseReference(imageRef)
+	// resolve the tag once so the verified digest is exactly what gets extracted
+	digest, remoteOpts, err := o.resolveDigest(ctx, revision)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse image reference: %w", err)
+		return nil, err
 	}
-
-	remoteOpts := []remote.Option{
-		remote.WithAuth(o.auth),
-		remote.WithContext(ctx),
+	oldDigest, err := o.history.current()
+	if err != nil {
+		return nil, err
+	}
+	report := &source.SyncReport{
+		OldRevision:  oldDigest,
+		NewRevision:  digest.DigestStr(),
+		Version:      resolution.Tag,
+		NewerVersion: resolution.Newer,
+	}
+	if o.verifier != nil {
+		if err := o.verifier.verify(ctx, digest, remoteOpts); err != nil {
+			return nil, fmt.Errorf("%w: %v: %w", ErrUnverifiedImage, digest, err)
+		}
+		log.Infof("Verified signature of OCI image %s", digest)
 	}
 
-	if o.insecure {
-		remoteOpts = append(remoteOpts, remote.WithTransport(remote.DefaultTransport))
+	if digest.DigestStr() == oldDigest {
+		if _, err := os.Stat(o.localRepository); err == nil {
+			log.Infof("OCI image %s already extracted", digest.DigestStr())
+			return report, nil
+		}
 	}
 
-	img, err := remote.Image(ref, remoteOpts...)
+	img, err := remote.Image(digest, remoteOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to pull image: %w", err)
 	}
@@ -88,56 +135,19 @@ func (o *OCISource) Sync(ctx context.Context, opts source.SyncOpts) (*source.Syn
 
 	log.Debugf("Found %d layers in image", len(layers))
 
-	if err := os.MkdirAll(o.localRepository, 0o755); err != nil {
-		return nil, fmt.Errorf("failed to create local repository: %w", err)
-	}
-
 	contentsTar := mutate.Extract(img)
 	defer func() {
 		_ = contentsTar.Close()
 	}()
-
-	tr := tar.NewReader(contentsTar)
-
-	for {
-		header, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, fmt.Errorf("failed to read tar header: %w", err)
-		}
-
-		target := filepath.Join(o.localRepository, header.Name)
-
-		switch header.Typeflag {
-		case tar.TypeDir:
-			if err := os.MkdirAll(target, os.FileMode(header.Mode)); err != nil {
-				return nil, fmt.Errorf("failed to create directory %s: %w", target, err)
-			}
-
-		case tar.TypeReg:
-			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
-				return nil, fmt.Errorf("failed to create parent directory for %s: %w", target, err)
-			}
-
-			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
-			if err != nil {
-				return nil, fmt.Errorf("failed to create file %s: %w", target, err)
-			}
-
-			_, err = io.Copy(f, tr)
-			_ = f.Close()
-			if err != nil {
-				return nil, fmt.Errorf("failed to write file %s: %w", target, err)
-			}
-		default:
-			log.Debugf("Skipping unsupported file type %c for %s", header.Typeflag, header.Name)
-		}
+	if err := archive.UntarAtomic(contentsTar, o.localRepository); err != nil {
+		return nil, fmt.Errorf("failed to extract image: %w", err)
 	}
 
-	log.Infof("Successfully extracted OCI image to %s", o.localRepository)
-	return &source.SyncReport{}, nil
+	if err := o.history.record(digest.DigestStr()); err != nil {
+		return nil, err
+	}
+	log.Infof("Successfully extracted OCI image %s to %s", digest.DigestStr(), o.localRepository)
+	return report, nil
 }
 
 func (o *OCISource) Close(ctx context.Context) error {
@@ -146,16 +156,141 @@ func (o *OCISource) Close(ctx context.Context) error {
 }
 
 func (o *OCISource) Clean() error {
+	if err := o.history.remove(); err != nil {
+		return fmt.Errorf("unable to remove digest history: %w", err)
+	}
 	return os.RemoveAll(o.localRepository)
 }
 
 func (o *OCISource) Inspect() source.SyncInspectReport {
 	return source.SyncInspectReport{
-		SupportsRollback: false, // TODO support rollback
+		SupportsRollback: true,
+	}
+}
+
+// LatestRevision returns the digest the configured tag or version currently points to
+func (o *OCISource) LatestRevision(ctx context.Context) (string, error) {
+	tag := o.tag
+	if o.version != nil {
+		resolution, err := o.resolveVersion(ctx)
+		if err != nil {
+			return "", err
+		}
+		tag = resolution.Tag
+	}
+	digest, remoteOpts, err := o.resolveDigest(ctx, tag)
+	if err != nil {
+		return "", err
+	}
+	if o.verifier != nil {
+		if err := o.verifier.verify(ctx, digest, remoteOpts); err != nil {
+			return "", fmt.Errorf("%w: %v: %w", ErrUnverifiedImage, digest, err)
+		}
 	}
+	return digest.DigestStr(), nil
+}
+
+// resolveVersion picks the repository tag matching the version constraint
+func (o *OCISource) resolveVersion(ctx context.Context) (version.Resolution, error) {
+	tags, err := o.listTags(ctx)
+	if err != nil {
+		return version.Resolution{}, err
+	}
+	resolution, err := o.version.Resolve(tags)
+	if err != nil {
+		return version.Resolution{}, err
+	}
+	if resolution.Newer != "" {
+		log.Infof("%v resolved to %v, %v is available outside the version constraint", o.version, resolution.Tag, resolution.Newer)
+	}
+	return resolution, nil
+}
+
+// listTags lists the repository's tags from the first mirror or registry that answers
+func (o *OCISource) listTags(ctx context.Context) ([]string, error) {
+	sources, err := o.registries.pullSources(fmt.Sprintf("%s/%s", o.registry, o.repository), false, o.insecure)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, src := range sources {
+		nameOpts, remoteOpts := remoteOptions(ctx, o.keychain, src.insecure)
+		repo, err := name.NewRepository(src.repository, nameOpts...)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		tags, err := remote.List(repo, remoteOpts...)
+		if err == nil {
+			return tags, nil
+		}
+		log.Warn("unable to list OCI tags", "repository", src.repository, "error", err)
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("failed to list tags: %w", errors.Join(errs...))
+}
+
+// resolveDigest tries each mirror and the registry in turn until one resolves revision
+func (o *OCISource) resolveDigest(ctx context.Context, revision string) (name.Digest, []remote.Option, error) {
+	sources, err := o.registries.pullSources(fmt.Sprintf("%s/%s", o.registry, o.repository), isDigest(revision), o.insecure)
+	if err != nil {
+		return name.Digest{}, nil, err
+	}
+	var errs []error
+	for _, src := range sources {
+		digest, remoteOpts, err := o.resolve(ctx, src, revision)
+		if err == nil {
+			return digest, remoteOpts, nil
+		}
+		log.Warn("unable to resolve OCI image", "repository", src.repository, "error", err)
+		errs = append(errs, err)
+	}
+	return name.Digest{}, nil, fmt.Errorf("failed to resolve image: %w", errors.Join(errs...))
+}
+
+// resolve looks up the digest of revision in the pull source, returning the options to keep using that source
+func (o *OCISource) resolve(ctx context.Context, src pullSource, revision string) (name.Digest, []remote.Option, error) {
+	nameOpts, remoteOpts := remoteOptions(ctx, o.keychain, src.insecure)
+	imageRef := reference(src.repository, revision)
+	log.Infof("Pulling OCI image %s", imageRef)
+	ref, err := name.ParseReference(imageRef, nameOpts...)
+	if err != nil {
+		return name.Digest{}, nil, fmt.Errorf("failed to parse image reference: %w", err)
+	}
+	desc, err := remote.Head(ref, remoteOpts...)
+	if err != nil {
+		return name.Digest{}, nil, err
+	}
+	return ref.Context().Digest(desc.Digest.String()), remoteOpts, nil
+}
+
+func isDigest(revision string) bool {
+	return strings.Contains(revision, ":")
+}
+
+// reference builds the image reference for a tag or digest
+func reference(repository, revision string) string {
+	if isDigest(revision) {
+		return fmt.Sprintf("%s@%s", repository, revision)
+	}
+	return fmt.Sprintf("%s:%s", repository, revision)
 }
 
 func (o *OCISource) String() string {
-	imageRef := fmt.Sprintf("%s/%s:%s", o.registry, o.repository, o.tag)
-	return fmt.Sprintf("oci:%v", imageRef)
+	return fmt.Sprintf("oci:%v", reference(fmt.Sprintf("%s/%s", o.registry, o.repository), o.tag))
+}
+
+func remoteOptions(ctx context.Context, keychain authn.Keychain, insecure bool) ([]name.Option, []remote.Option) {
+	var nameOpts []name.Option
+	remoteOpts := []remote.Option{
+		remote.WithAuthFromKeychain(keychain),
+		remote.WithContext(ctx),
+	}
+	if insecure {
+		nameOpts = append(nameOpts, name.Insecure)
+		transport := remote.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // #nosec G402 explicitly configured as insecure
+		remoteOpts = append(remoteOpts, remote.WithTransport(transport))
+	}
+	return nameOpts, remoteOpts
 }
@@ -0,0 +1,171 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"primamateria.systems/materia/pkg/source"
+)
+
+func newTestRegistry(t *testing.T) string {
+	server := httptest.NewServer(registry.New())
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// pushFiles pushes a single layer image containing files to ref and returns its digest
+func pushFiles(t *testing.T, ref string, files map[string]string) string {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	img, err := mutate.AppendLayers(empty.Image, static.NewLayer(buf.Bytes(), types.OCIUncompressedLayer))
+	require.NoError(t, err)
+	r, err := name.ParseReference(ref)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(r, img))
+	d, err := img.Digest()
+	require.NoError(t, err)
+	return d.String()
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestOCISource_Rollback(t *testing.T) {
+	ctx := context.Background()
+	host := newTestRegistry(t)
+	ref := host + "/repo:latest"
+	localDir := filepath.Join(t.TempDir(), "source")
+	c := &Config{URL: "oci://" + ref, LocalRepository: localDir}
+
+	first := pushFiles(t, ref, map[string]string{"MANIFEST.toml": "first"})
+	o, err := NewOCISource(c)
+	require.NoError(t, err)
+	assert.True(t, o.Inspect().SupportsRollback)
+	report, err := o.Sync(ctx, source.SyncOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, "", report.OldRevision)
+	assert.Equal(t, first, report.NewRevision)
+
+	second := pushFiles(t, ref, map[string]string{"MANIFEST.toml": "second"})
+	// history survives restarts
+	o, err = NewOCISource(c)
+	require.NoError(t, err)
+	report, err = o.Sync(ctx, source.SyncOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, first, report.OldRevision)
+	assert.Equal(t, second, report.NewRevision)
+	assert.Equal(t, "second", readFile(t, filepath.Join(localDir, "MANIFEST.toml")))
+
+	// the tag now points at second, rolling back uses the digest
+	report, err = o.Sync(ctx, source.SyncOpts{Revision: report.OldRevision})
+	require.NoError(t, err)
+	assert.Equal(t, second, report.OldRevision)
+	assert.Equal(t, first, report.NewRevision)
+	assert.Equal(t, "first", readFile(t, filepath.Join(localDir, "MANIFEST.toml")))
+
+	require.NoError(t, o.Clean())
+	current, err := o.history.current()
+	require.NoError(t, err)
+	assert.Equal(t, "", current)
+}
+
+func TestOCISource_Version(t *testing.T) {
+	ctx := context.Background()
+	host := newTestRegistry(t)
+	digests := map[string]string{}
+	for _, tag := range []string{"1.3.0", "1.4.0", "1.4.2", "2.0.0", "latest"} {
+		digests[tag] = pushFiles(t, host+"/repo:"+tag, map[string]string{"MANIFEST.toml": tag})
+	}
+
+	_, err := NewOCISource(&Config{URL: "oci://" + host + "/repo:1.4.0", Version: "~1.4"})
+	assert.Error(t, err)
+
+	localDir := filepath.Join(t.TempDir(), "source")
+	o, err := NewOCISource(&Config{URL: "oci://" + host + "/repo", Version: "~1.4", LocalRepository: localDir})
+	require.NoError(t, err)
+	latest, err := o.LatestRevision(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, digests["1.4.2"], latest)
+	report, err := o.Sync(ctx, source.SyncOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, digests["1.4.2"], report.NewRevision)
+	assert.Equal(t, "1.4.2", report.Version)
+	assert.Equal(t, "2.0.0", report.NewerVersion)
+	assert.Equal(t, "1.4.2", readFile(t, filepath.Join(localDir, "MANIFEST.toml")))
+
+	o, err = NewOCISource(&Config{URL: "oci://" + host + "/repo", Version: "~3", LocalRepository: localDir})
+	require.NoError(t, err)
+	_, err = o.Sync(ctx, source.SyncOpts{})
+	assert.Error(t, err)
+}
+
+func TestDigestHistory(t *testing.T) {
+	h := newDigestHistory(filepath.Join(t.TempDir(), "source"))
+	for i := range digestHistorySize + 5 {
+		require.NoError(t, h.record(fmt.Sprintf("sha256:%v", i)))
+	}
+	require.NoError(t, h.record(fmt.Sprintf("sha256:%v", digestHistorySize+4)))
+	digests, err := h.list()
+	require.NoError(t, err)
+	assert.Len(t, digests, digestHistorySize)
+	assert.Equal(t, "sha256:5", digests[0])
+	current, err := h.current()
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("sha256:%v", digestHistorySize+4), current)
+}
+
+func TestOCISource_Mirror(t *testing.T) {
+	ctx := context.Background()
+	mirror := newTestRegistry(t)
+	down := httptest.NewServer(registry.New())
+	primary := strings.TrimPrefix(down.URL, "http://")
+	down.Close()
+
+	digest := pushFiles(t, mirror+"/mirrored/repo:latest", map[string]string{"MANIFEST.toml": "mirrored"})
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "registries.conf")
+	require.NoError(t, os.WriteFile(conf, fmt.Appendf(nil, `
+[[registry]]
+prefix = "%v/repo"
+
+[[registry.mirror]]
+location = "%v/mirrored/repo"
+`, primary, mirror), 0o644))
+
+	localDir := filepath.Join(dir, "source")
+	o, err := NewOCISource(&Config{
+		URL:             "oci://" + primary + "/repo:latest",
+		LocalRepository: localDir,
+		RegistriesConf:  conf,
+	})
+	require.NoError(t, err)
+	report, err := o.Sync(ctx, source.SyncOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, digest, report.NewRevision)
+	assert.Equal(t, "mirrored", readFile(t, filepath.Join(localDir, "MANIFEST.toml")))
+}
@@ -0,0 +1,234 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"charm.land/log/v2"
+	"github.com/go-git/go-git/v5"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	// ArtifactType is the config media type used when publishing a repository as an OCI artifact
+	ArtifactType = "application/vnd.primamateria.materia.repository.v1+json"
+
+	annotationRevision = "org.opencontainers.image.revision"
+	annotationCreated  = "org.opencontainers.image.created"
+)
+
+type PublishOpts struct {
+	// Artifact publishes an OCI artifact with the materia media type instead of an image
+	Artifact bool
+	// Revision overrides the git revision annotation, by default it's read from the repository
+	Revision string
+	// Created is the build time annotation, defaults to $SOURCE_DATE_EPOCH or the current time
+	Created time.Time
+	// SigningKey is a PEM private key used to add a cosign signature
+	SigningKey string
+	// Architecture labels the image config. Repositories don't contain binaries so it's unset by default.
+	Architecture string
+}
+
+// Publish packages the repository in dir as a single layer image and pushes it to the config's URL.
+// The layer is reproducible: the same tree always gives the same layer digest. Callers are expected to validate the repository first.
+func Publish(ctx context.Context, c *Config, dir string, opts PublishOpts) (name.Digest, error) {
+	if c == nil {
+		return name.Digest{}, errors.New("need OCI config")
+	}
+	if err := c.parseURL(); err != nil {
+		return name.Digest{}, fmt.Errorf("unable to parse OCI url: %w", err)
+	}
+	var signer crypto.Signer
+	if opts.SigningKey != "" {
+		var err error
+		if signer, err = loadSigningKey(opts.SigningKey); err != nil {
+			return name.Digest{}, err
+		}
+	}
+
+	if opts.Revision == "" {
+		opts.Revision = gitRevision(dir)
+	}
+	if opts.Created.IsZero() {
+		opts.Created = buildTime()
+	}
+	img, err := buildImage(dir, opts)
+	if err != nil {
+		return name.Digest{}, err
+	}
+
+	nameOpts, remoteOpts := remoteOptions(ctx, newKeychain(c), c.Insecure)
+	ref, err := name.ParseReference(reference(fmt.Sprintf("%s/%s", c.Registry, c.Repository), c.Tag), nameOpts...)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("failed to parse image reference: %w", err)
+	}
+	if _, ok := ref.(name.Digest); ok {
+		return name.Digest{}, errors.New("can't publish to a digest, use a tag")
+	}
+	log.Infof("Publishing %v to %v", dir, ref)
+	if err := remote.Write(ref, img, remoteOpts...); err != nil {
+		return name.Digest{}, fmt.Errorf("failed to push image: %w", err)
+	}
+	d, err := img.Digest()
+	if err != nil {
+		return name.Digest{}, err
+	}
+	digest := ref.Context().Digest(d.String())
+
+	if signer != nil {
+		if err := signCosign(digest, signer, remoteOpts); err != nil {
+			return name.Digest{}, err
+		}
+		log.Infof("Signed %v", digest)
+	}
+	return digest, nil
+}
+
+func buildImage(dir string, opts PublishOpts) (v1.Image, error) {
+	contents, err := reproducibleTar(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to archive repository: %w", err)
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(contents)), nil
+	}, tarball.WithMediaType(types.OCILayer))
+	if err != nil {
+		return nil, err
+	}
+	img, err := mutate.AppendLayers(mutate.MediaType(empty.Image, types.OCIManifestSchema1), layer)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Artifact {
+		img = mutate.ConfigMediaType(img, ArtifactType)
+	} else {
+		img = mutate.ConfigMediaType(img, types.OCIConfigJSON)
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			return nil, err
+		}
+		cfg = cfg.DeepCopy()
+		cfg.Created = v1.Time{Time: opts.Created.UTC()}
+		cfg.OS = "linux"
+		cfg.Architecture = opts.Architecture
+		if img, err = mutate.ConfigFile(img, cfg); err != nil {
+			return nil, err
+		}
+	}
+	annotations := map[string]string{
+		annotationCreated: opts.Created.UTC().Format(time.RFC3339),
+	}
+	if opts.Revision != "" {
+		annotations[annotationRevision] = opts.Revision
+	}
+	return mutate.Annotations(img, annotations).(v1.Image), nil
+}
+
+// reproducibleTar archives dir in lexical order with normalized ownership and timestamps, skipping the .git directory
+func reproducibleTar(dir string) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{
+			Name:    filepath.ToSlash(rel),
+			Mode:    int64(info.Mode().Perm()),
+			ModTime: time.Unix(0, 0),
+			Format:  tar.FormatPAX,
+		}
+		switch {
+		case d.IsDir():
+			hdr.Typeflag = tar.TypeDir
+			hdr.Name += "/"
+		case info.Mode().IsRegular():
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = info.Size()
+		case info.Mode()&fs.ModeSymlink != 0:
+			hdr.Typeflag = tar.TypeSymlink
+			if hdr.Linkname, err = os.Readlink(path); err != nil {
+				return err
+			}
+		default:
+			log.Warnf("skipping %v: unsupported file type", rel)
+			return nil
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gitRevision returns the HEAD commit of the git repository containing dir, or "" if it isn't in one
+func gitRevision(dir string) string {
+	r, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return ""
+	}
+	head, err := r.Head()
+	if err != nil {
+		return ""
+	}
+	return head.Hash().String()
+}
+
+func buildTime() time.Time {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		if seconds, err := strconv.ParseInt(epoch, 10, 64); err == nil {
+			return time.Unix(seconds, 0)
+		}
+		log.Warnf("ignoring invalid SOURCE_DATE_EPOCH %q", epoch)
+	}
+	return time.Now()
+}
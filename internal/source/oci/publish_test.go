@@ -0,0 +1,147 @@
+package oci
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"primamateria.systems/materia/pkg/source"
+)
+
+func writeTestRepository(t *testing.T) string {
+	dir := t.TempDir()
+	files := map[string]string{
+		"MANIFEST.toml":                           "[Hosts.localhost]\nComponents = [\"hello\"]\n",
+		"components/hello/MANIFEST.toml":          "",
+		"components/hello/hello.container.gotmpl": "[Container]\nImage=hello\n",
+		".git/HEAD": "ref: refs/heads/main\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	require.NoError(t, os.Symlink("hello.container.gotmpl", filepath.Join(dir, "components", "hello", "link.gotmpl")))
+	return dir
+}
+
+func TestPublish(t *testing.T) {
+	ctx := context.Background()
+	host := newTestRegistry(t)
+	repo := writeTestRepository(t)
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	opts := PublishOpts{Revision: "abc123", Created: created}
+
+	digest, err := Publish(ctx, &Config{URL: "oci://" + host + "/materia/repo:v1"}, repo, opts)
+	require.NoError(t, err)
+	again, err := Publish(ctx, &Config{URL: "oci://" + host + "/materia/repo:v2"}, repo, opts)
+	require.NoError(t, err)
+	assert.Equal(t, digest, again, "publishing is reproducible")
+
+	img, err := remote.Image(digest)
+	require.NoError(t, err)
+	manifest, err := img.Manifest()
+	require.NoError(t, err)
+	assert.Equal(t, types.OCIManifestSchema1, manifest.MediaType)
+	assert.Equal(t, types.OCIConfigJSON, manifest.Config.MediaType)
+	assert.Len(t, manifest.Layers, 1)
+	assert.Equal(t, "abc123", manifest.Annotations[annotationRevision])
+	assert.Equal(t, "2026-01-02T03:04:05Z", manifest.Annotations[annotationCreated])
+	cfg, err := img.ConfigFile()
+	require.NoError(t, err)
+	assert.Equal(t, "linux", cfg.OS)
+	assert.Empty(t, cfg.Architecture, "repositories aren't tied to an architecture")
+
+	localDir := filepath.Join(t.TempDir(), "source")
+	o, err := NewOCISource(&Config{URL: "oci://" + host + "/materia/repo:v1", LocalRepository: localDir})
+	require.NoError(t, err)
+	report, err := o.Sync(ctx, source.SyncOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, digest.DigestStr(), report.NewRevision)
+	assert.Equal(t, "[Container]\nImage=hello\n", readFile(t, filepath.Join(localDir, "components", "hello", "link.gotmpl")))
+	assert.NoDirExists(t, filepath.Join(localDir, ".git"))
+
+	artifact, err := Publish(ctx, &Config{URL: "oci://" + host + "/materia/repo:artifact"}, repo, PublishOpts{Artifact: true, Created: created})
+	require.NoError(t, err)
+	img, err = remote.Image(artifact)
+	require.NoError(t, err)
+	manifest, err = img.Manifest()
+	require.NoError(t, err)
+	assert.Equal(t, types.MediaType(ArtifactType), manifest.Config.MediaType)
+
+	localDir = filepath.Join(t.TempDir(), "artifact")
+	o, err = NewOCISource(&Config{URL: "oci://" + host + "/materia/repo:artifact", LocalRepository: localDir})
+	require.NoError(t, err)
+	_, err = o.Sync(ctx, source.SyncOpts{})
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(localDir, "MANIFEST.toml"))
+}
+
+func TestPublish_Sign(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	host := newTestRegistry(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	privateDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	privateKey := writePEM(t, dir, "cosign.key", "PRIVATE KEY", privateDER)
+	publicKey := writePEM(t, dir, "cosign.pub", "PUBLIC KEY", publicDER)
+
+	url := "oci://" + host + "/materia/repo:signed"
+	_, err = Publish(ctx, &Config{URL: url}, writeTestRepository(t), PublishOpts{SigningKey: privateKey})
+	require.NoError(t, err)
+
+	o, err := NewOCISource(&Config{URL: url, LocalRepository: filepath.Join(dir, "source"), Verify: true, CosignKey: publicKey})
+	require.NoError(t, err)
+	_, err = o.Sync(ctx, source.SyncOpts{})
+	require.NoError(t, err)
+}
+
+func TestPublish_URLTag(t *testing.T) {
+	ctx := context.Background()
+	host := newTestRegistry(t)
+	repo := writeTestRepository(t)
+	k := koanf.New(".")
+	require.NoError(t, k.Load(confmap.Provider(map[string]any{
+		"oci.tag":        "stable",
+		"oci.version":    "~1.4",
+		"oci.verify":     true,
+		"oci.cosign_key": "/etc/materia/cosign.pub",
+		"oci.insecure":   true,
+	}, "."), nil))
+
+	c, err := NewPublishConfig(k, "oci://"+host+"/materia/repo:v2")
+	require.NoError(t, err)
+	assert.Empty(t, c.Version)
+	assert.False(t, c.Verify)
+	assert.Empty(t, c.CosignKey)
+	assert.True(t, c.Insecure)
+	digest, err := Publish(ctx, c, repo, PublishOpts{})
+	require.NoError(t, err)
+
+	ref, err := name.ParseReference(host + "/materia/repo:v2")
+	require.NoError(t, err)
+	tagged, err := remote.Head(ref)
+	require.NoError(t, err)
+	assert.Equal(t, digest.DigestStr(), tagged.Digest.String())
+	ref, err = name.ParseReference(host + "/materia/repo:stable")
+	require.NoError(t, err)
+	_, err = remote.Head(ref)
+	assert.Error(t, err)
+}
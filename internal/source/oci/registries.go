@@ -0,0 +1,192 @@
+package oci
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	pullFromMirrorAll        = "all"
+	pullFromMirrorDigestOnly = "digest-only"
+	pullFromMirrorTagOnly    = "tag-only"
+)
+
+// registryMirror and registryEntry follow the [[registry]] tables of containers-registries.conf(5)
+type registryMirror struct {
+	Location       string `toml:"location"`
+	Insecure       bool   `toml:"insecure"`
+	PullFromMirror string `toml:"pull-from-mirror"`
+}
+
+type registryEntry struct {
+	Prefix   string           `toml:"prefix"`
+	Location string           `toml:"location"`
+	Insecure bool             `toml:"insecure"`
+	Blocked  bool             `toml:"blocked"`
+	Mirrors  []registryMirror `toml:"mirror"`
+}
+
+type registriesConf struct {
+	Registries []registryEntry `toml:"registry"`
+}
+
+// pullSource is a repository to try pulling from, in order
+type pullSource struct {
+	repository string
+	insecure   bool
+}
+
+// defaultRegistriesConf returns the registries.conf podman would use and its drop-in directory
+func defaultRegistriesConf() (string, string) {
+	if path := os.Getenv("CONTAINERS_REGISTRIES_CONF"); path != "" {
+		return path, ""
+	}
+	if os.Getuid() != 0 {
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			if home, err := os.UserHomeDir(); err == nil {
+				configHome = filepath.Join(home, ".config")
+			}
+		}
+		if configHome != "" {
+			path := filepath.Join(configHome, "containers", "registries.conf")
+			if _, err := os.Stat(path); err == nil {
+				return path, filepath.Join(configHome, "containers", "registries.conf.d")
+			}
+		}
+	}
+	return "/etc/containers/registries.conf", "/etc/containers/registries.conf.d"
+}
+
+// loadRegistriesConf reads a registries.conf and any *.conf drop-ins. Drop-in entries replace earlier entries with the same prefix.
+func loadRegistriesConf(path, dropInDir string) (*registriesConf, error) {
+	files := []string{path}
+	if dropInDir != "" {
+		dropIns, err := filepath.Glob(filepath.Join(dropInDir, "*.conf"))
+		if err != nil {
+			return nil, err
+		}
+		slices.Sort(dropIns)
+		files = append(files, dropIns...)
+	}
+	conf := &registriesConf{}
+	for _, f := range files {
+		var c registriesConf
+		if _, err := toml.DecodeFile(f, &c); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("invalid registries config %v: %w", f, err)
+		}
+		for _, r := range c.Registries {
+			if err := r.normalize(); err != nil {
+				return nil, fmt.Errorf("invalid registries config %v: %w", f, err)
+			}
+			conf.Registries = slices.DeleteFunc(conf.Registries, func(e registryEntry) bool { return e.Prefix == r.Prefix })
+			conf.Registries = append(conf.Registries, r)
+		}
+	}
+	return conf, nil
+}
+
+func (r *registryEntry) normalize() error {
+	if r.Prefix == "" {
+		r.Prefix = r.Location
+	}
+	if r.Prefix == "" {
+		return errors.New("registry needs a prefix or location")
+	}
+	if !strings.HasPrefix(r.Prefix, "*.") && r.Location == "" {
+		r.Location = r.Prefix
+	}
+	if strings.HasPrefix(r.Prefix, "*.") {
+		if r.Location != "" {
+			return fmt.Errorf("registry %v: wildcard prefixes can't set a location", r.Prefix)
+		}
+		if strings.Contains(r.Prefix, "/") {
+			return fmt.Errorf("registry %v: wildcard prefixes can only match hosts", r.Prefix)
+		}
+	}
+	for _, m := range r.Mirrors {
+		switch m.PullFromMirror {
+		case "", pullFromMirrorAll, pullFromMirrorDigestOnly, pullFromMirrorTagOnly:
+		default:
+			return fmt.Errorf("registry %v: invalid pull-from-mirror %q", r.Prefix, m.PullFromMirror)
+		}
+	}
+	return nil
+}
+
+// match returns the part of repository after the prefix if the entry applies to it
+func (r registryEntry) match(repository string) (string, bool) {
+	if wildcard, ok := strings.CutPrefix(r.Prefix, "*"); ok {
+		host, rest, _ := strings.Cut(repository, "/")
+		if !strings.HasSuffix(host, wildcard) {
+			return "", false
+		}
+		return "/" + rest, true
+	}
+	if repository == r.Prefix {
+		return "", true
+	}
+	if rest, ok := strings.CutPrefix(repository, r.Prefix); ok && strings.HasPrefix(rest, "/") {
+		return rest, true
+	}
+	return "", false
+}
+
+func (c *registriesConf) find(repository string) (*registryEntry, string) {
+	var best *registryEntry
+	var bestRest string
+	for i, r := range c.Registries {
+		rest, ok := r.match(repository)
+		if !ok {
+			continue
+		}
+		// exact prefixes win over wildcards, then the longest prefix wins
+		if best == nil || betterMatch(r, *best) {
+			best = &c.Registries[i]
+			bestRest = rest
+		}
+	}
+	return best, bestRest
+}
+
+func betterMatch(a, b registryEntry) bool {
+	aWild, bWild := strings.HasPrefix(a.Prefix, "*"), strings.HasPrefix(b.Prefix, "*")
+	if aWild != bWild {
+		return !aWild
+	}
+	return len(a.Prefix) > len(b.Prefix)
+}
+
+// pullSources returns the repositories to try for repository: any applicable mirrors followed by the (possibly rewritten) location
+func (c *registriesConf) pullSources(repository string, byDigest bool, insecure bool) ([]pullSource, error) {
+	entry, rest := c.find(repository)
+	if entry == nil {
+		return []pullSource{{repository: repository, insecure: insecure}}, nil
+	}
+	if entry.Blocked {
+		return nil, fmt.Errorf("registry %v is blocked in registries config", entry.Prefix)
+	}
+	var sources []pullSource
+	for _, m := range entry.Mirrors {
+		if m.PullFromMirror == pullFromMirrorDigestOnly && !byDigest || m.PullFromMirror == pullFromMirrorTagOnly && byDigest {
+			continue
+		}
+		sources = append(sources, pullSource{repository: m.Location + rest, insecure: m.Insecure})
+	}
+	location := entry.Location
+	if strings.HasPrefix(entry.Prefix, "*") {
+		// wildcards don't rewrite
+		location, _, _ = strings.Cut(repository, "/")
+	}
+	return append(sources, pullSource{repository: location + rest, insecure: entry.Insecure || insecure}), nil
+}
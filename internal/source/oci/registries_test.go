@@ -0,0 +1,107 @@
+package oci
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRegistriesConf = `
+unqualified-search-registries = ["docker.io"]
+
+[[registry]]
+prefix = "example.com/foo"
+location = "internal.example.com/bar"
+
+[[registry.mirror]]
+location = "mirror.example.com/foo"
+
+[[registry.mirror]]
+location = "digests.example.com/foo"
+pull-from-mirror = "digest-only"
+
+[[registry]]
+location = "example.com"
+insecure = true
+
+[[registry]]
+prefix = "*.blocked.example.com"
+blocked = true
+
+[[registry]]
+prefix = "*.example.org"
+
+[[registry.mirror]]
+location = "mirror.example.org"
+`
+
+func TestRegistriesConf(t *testing.T) {
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, "registries.conf")
+	require.NoError(t, os.WriteFile(confPath, []byte(testRegistriesConf), 0o644))
+	dropIns := filepath.Join(dir, "registries.conf.d")
+	require.NoError(t, os.Mkdir(dropIns, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dropIns, "10-override.conf"), []byte(`
+[[registry]]
+location = "example.com"
+insecure = false
+`), 0o644))
+	conf, err := loadRegistriesConf(confPath, dropIns)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		repository string
+		byDigest   bool
+		want       []pullSource
+		wantErr    bool
+	}{
+		{"unconfigured", "other.example.com/repo", false, []pullSource{{repository: "other.example.com/repo"}}, false},
+		{"rewrite with mirrors", "example.com/foo/repo", false, []pullSource{
+			{repository: "mirror.example.com/foo/repo"},
+			{repository: "internal.example.com/bar/repo"},
+		}, false},
+		{"digest only mirror", "example.com/foo/repo", true, []pullSource{
+			{repository: "mirror.example.com/foo/repo"},
+			{repository: "digests.example.com/foo/repo"},
+			{repository: "internal.example.com/bar/repo"},
+		}, false},
+		{"prefix on path boundary", "example.com/foobar", false, []pullSource{{repository: "example.com/foobar"}}, false},
+		{"drop-in overrides", "example.com/baz", false, []pullSource{{repository: "example.com/baz"}}, false},
+		{"blocked wildcard", "registry.blocked.example.com/repo", false, nil, true},
+		{"wildcard mirror", "registry.example.org/repo", false, []pullSource{
+			{repository: "mirror.example.org/repo"},
+			{repository: "registry.example.org/repo"},
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := conf.pullSources(tt.repository, tt.byDigest, false)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRegistriesConf_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, "registries.conf")
+	require.NoError(t, os.WriteFile(confPath, []byte(`
+[[registry]]
+prefix = "*.example.com"
+location = "somewhere.example.com"
+`), 0o644))
+	_, err := loadRegistriesConf(confPath, "")
+	assert.Error(t, err)
+
+	conf, err := loadRegistriesConf(filepath.Join(dir, "missing.conf"), "")
+	require.NoError(t, err)
+	assert.Empty(t, conf.Registries)
+}
@@ -0,0 +1,76 @@
+package oci
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+var ErrUnverifiedImage = errors.New("image failed signature verification")
+
+// signatureVerifier checks cosign signatures against a public key and/or notation signatures against trusted certificates
+type signatureVerifier struct {
+	cosignKey     crypto.PublicKey
+	notationRoots *x509.CertPool
+}
+
+func newSignatureVerifier(cosignKeyFile, notationCertsFile string) (*signatureVerifier, error) {
+	if cosignKeyFile == "" && notationCertsFile == "" {
+		return nil, errors.New("signature verification needs a cosign key or notation certificates")
+	}
+	v := &signatureVerifier{}
+	if cosignKeyFile != "" {
+		data, err := os.ReadFile(cosignKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read cosign key: %w", err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "PUBLIC KEY" {
+			return nil, fmt.Errorf("invalid cosign key %v: expected a PEM encoded public key", cosignKeyFile)
+		}
+		v.cosignKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cosign key %v: %w", cosignKeyFile, err)
+		}
+	}
+	if notationCertsFile != "" {
+		data, err := os.ReadFile(notationCertsFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read notation certificates: %w", err)
+		}
+		v.notationRoots = x509.NewCertPool()
+		if !v.notationRoots.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("invalid notation certificates %v: no PEM certificates found", notationCertsFile)
+		}
+	}
+	return v, nil
+}
+
+// verify succeeds if any configured signature scheme has a valid signature for the digest
+func (v *signatureVerifier) verify(ctx context.Context, digest name.Digest, opts []remote.Option) error {
+	opts = append(slices.Clip(opts), remote.WithContext(ctx))
+	var errs []error
+	if v.cosignKey != nil {
+		err := v.verifyCosign(digest, opts)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("cosign: %w", err))
+	}
+	if v.notationRoots != nil {
+		err := v.verifyNotation(digest, opts)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("notation: %w", err))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,212 @@
+package oci
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"primamateria.systems/materia/pkg/source"
+)
+
+func pushTestImage(t *testing.T) (string, name.Digest) {
+	server := httptest.NewServer(registry.New(registry.WithReferrersSupport(true)))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+	ref, err := name.ParseReference(host + "/repo:latest")
+	require.NoError(t, err)
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+	d, err := img.Digest()
+	require.NoError(t, err)
+	return host, ref.Context().Digest(d.String())
+}
+
+func writePEM(t *testing.T, dir, file, kind string, der []byte) string {
+	path := filepath.Join(dir, file)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0o600))
+	return path
+}
+
+func pushCosignSignature(t *testing.T, key *ecdsa.PrivateKey, digest name.Digest) {
+	payload := fmt.Appendf(nil, `{"critical":{"identity":{"docker-reference":%q},"image":{"docker-manifest-digest":%q},"type":%q},"optional":null}`,
+		digest.Context().String(), digest.DigestStr(), cosignPayloadType)
+	hashed := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, hashed[:])
+	require.NoError(t, err)
+	sigImage, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer(payload, cosignPayloadMediaType),
+		Annotations: map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig)},
+	})
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(cosignSignatureTag(digest), sigImage))
+}
+
+func newCodeSigningCert(t *testing.T) (*ecdsa.PrivateKey, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "materia test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return key, cert
+}
+
+func pushNotationSignature(t *testing.T, key *ecdsa.PrivateKey, cert *x509.Certificate, digest name.Digest) {
+	header, err := json.Marshal(map[string]any{
+		"alg":                        "ES256",
+		"cty":                        notationPayloadType,
+		"crit":                       []string{notationSigningScheme},
+		notationSigningScheme:        notationSchemeX509,
+		"io.cncf.notary.signingTime": time.Now().Format(time.RFC3339),
+	})
+	require.NoError(t, err)
+	payload, err := json.Marshal(notationPayload{TargetArtifact: v1.Descriptor{
+		MediaType: types.OCIManifestSchema1,
+		Digest:    v1.Hash{Algorithm: "sha256", Hex: strings.TrimPrefix(digest.DigestStr(), "sha256:")},
+	}})
+	require.NoError(t, err)
+	protected := base64.RawURLEncoding.EncodeToString(header)
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	hashed := crypto.SHA256.New()
+	hashed.Write([]byte(protected + "." + encodedPayload))
+	r, s, err := ecdsa.Sign(rand.Reader, key, hashed.Sum(nil))
+	require.NoError(t, err)
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	envelope, err := json.Marshal(map[string]any{
+		"payload":   encodedPayload,
+		"protected": protected,
+		"header":    map[string]any{"x5c": [][]byte{cert.Raw}},
+		"signature": base64.RawURLEncoding.EncodeToString(sig),
+	})
+	require.NoError(t, err)
+
+	target, err := remote.Get(digest)
+	require.NoError(t, err)
+	sigImage, err := mutate.Append(empty.Image, mutate.Addendum{Layer: static.NewLayer(envelope, notationJWSMediaType)})
+	require.NoError(t, err)
+	sigImage = mutate.MediaType(sigImage, types.OCIManifestSchema1)
+	sigImage = mutate.ConfigMediaType(sigImage, notationArtifactType)
+	sigImage = mutate.Subject(sigImage, target.Descriptor).(v1.Image)
+	sigDigest, err := sigImage.Digest()
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(digest.Context().Digest(sigDigest.String()), sigImage))
+}
+
+func TestSignatureVerifier_Cosign(t *testing.T) {
+	dir := t.TempDir()
+	_, digest := pushTestImage(t)
+	trusted, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	untrusted, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	pub, err := x509.MarshalPKIXPublicKey(&trusted.PublicKey)
+	require.NoError(t, err)
+	v, err := newSignatureVerifier(writePEM(t, dir, "cosign.pub", "PUBLIC KEY", pub), "")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	assert.Error(t, v.verify(ctx, digest, nil))
+
+	pushCosignSignature(t, untrusted, digest)
+	assert.Error(t, v.verify(ctx, digest, nil))
+
+	pushCosignSignature(t, trusted, digest)
+	assert.NoError(t, v.verify(ctx, digest, nil))
+
+	// a valid signature for another digest doesn't count
+	other := digest.Context().Digest("sha256:" + strings.Repeat("0", 64))
+	assert.Error(t, v.verifyCosignPayload(other, []byte("{}"), ""))
+}
+
+func TestSignatureVerifier_Notation(t *testing.T) {
+	dir := t.TempDir()
+	_, digest := pushTestImage(t)
+	key, cert := newCodeSigningCert(t)
+	otherKey, otherCert := newCodeSigningCert(t)
+	v, err := newSignatureVerifier("", writePEM(t, dir, "certs.pem", "CERTIFICATE", cert.Raw))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	assert.Error(t, v.verify(ctx, digest, nil))
+
+	pushNotationSignature(t, otherKey, otherCert, digest)
+	assert.Error(t, v.verify(ctx, digest, nil))
+
+	pushNotationSignature(t, key, cert, digest)
+	assert.NoError(t, v.verify(ctx, digest, nil))
+}
+
+func TestOCISource_SyncVerification(t *testing.T) {
+	dir := t.TempDir()
+	host, digest := pushTestImage(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	localDir := filepath.Join(dir, "local")
+	o, err := NewOCISource(&Config{
+		URL:             "oci://" + host + "/repo:latest",
+		LocalRepository: localDir,
+		Verify:          true,
+		CosignKey:       writePEM(t, dir, "cosign.pub", "PUBLIC KEY", pub),
+	})
+	require.NoError(t, err)
+
+	_, err = o.Sync(context.Background(), source.SyncOpts{})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrUnverifiedImage))
+	_, err = os.Stat(localDir)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	pushCosignSignature(t, key, digest)
+	_, err = o.Sync(context.Background(), source.SyncOpts{})
+	require.NoError(t, err)
+	entries, err := os.ReadDir(localDir)
+	require.NoError(t, err)
+	assert.NotEmpty(t, entries)
+
+	_, err = NewOCISource(&Config{URL: "oci://" + host + "/repo", Verify: true})
+	assert.Error(t, err)
+}
@@ -0,0 +1,237 @@
+// Package version resolves semver constraints against the tags of a remote
+package version
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/blang/semver/v4"
+)
+
+var termPattern = regexp.MustCompile(`^(>=|<=|>|<|=|~|\^)?v?(\d+|[xX*])(?:\.(\d+|[xX*]))?(?:\.(\d+|[xX*]))?(-[0-9A-Za-z.-]+)?$`)
+
+// Constraint is a set of version ranges, e.g. "~1.4", "^2", ">=1.2, <1.5" or "1.x || 2.x".
+// Pre-release versions only match if the constraint mentions one.
+type Constraint struct {
+	raw        string
+	clauses    [][]semver.Range
+	prerelease bool
+}
+
+// Resolution is the outcome of matching a constraint against a list of tags
+type Resolution struct {
+	// Tag is the highest tag satisfying the constraint
+	Tag string
+	// Newer is the highest tag overall, if it is newer than Tag
+	Newer string
+}
+
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{raw: strings.TrimSpace(s)}
+	if c.raw == "" {
+		return nil, fmt.Errorf("empty version constraint")
+	}
+	for clause := range strings.SplitSeq(c.raw, "||") {
+		terms, err := parseClause(clause)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q: %w", s, err)
+		}
+		c.clauses = append(c.clauses, terms)
+	}
+	c.prerelease = strings.Contains(c.raw, "-")
+	return c, nil
+}
+
+func parseClause(clause string) ([]semver.Range, error) {
+	var tokens []string
+	pending := ""
+	for field := range strings.FieldsSeq(strings.ReplaceAll(clause, ",", " ")) {
+		if strings.Trim(field, "<>=~^") == "" {
+			pending += field
+			continue
+		}
+		tokens = append(tokens, pending+field)
+		pending = ""
+	}
+	if pending != "" {
+		return nil, fmt.Errorf("operator %q without a version", pending)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty range")
+	}
+	terms := make([]semver.Range, 0, len(tokens))
+	for _, token := range tokens {
+		term, err := parseTerm(token)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+	return terms, nil
+}
+
+// parseTerm turns a single comparison into a range. Missing or wildcard parts widen the range, so "1.4" is any 1.4.x.
+func parseTerm(token string) (semver.Range, error) {
+	m := termPattern.FindStringSubmatch(token)
+	if m == nil {
+		return nil, fmt.Errorf("invalid version %q", token)
+	}
+	op := m[1]
+	var parts []uint64
+	for _, p := range m[2:5] {
+		if p == "" || strings.ContainsAny(p, "xX*") {
+			break
+		}
+		n, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q: %w", token, err)
+		}
+		parts = append(parts, n)
+	}
+	if len(parts) == 0 {
+		if op == "" || op == "=" || op == ">=" {
+			return func(semver.Version) bool { return true }, nil
+		}
+		return nil, fmt.Errorf("invalid version %q: %v needs a major version", token, op)
+	}
+	lower := semver.Version{Major: parts[0]}
+	if len(parts) > 1 {
+		lower.Minor = parts[1]
+	}
+	if len(parts) > 2 {
+		lower.Patch = parts[2]
+		if m[5] != "" {
+			pre, err := semver.Parse(fmt.Sprintf("%d.%d.%d%s", lower.Major, lower.Minor, lower.Patch, m[5]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid version %q: %w", token, err)
+			}
+			lower = pre
+		}
+	} else if m[5] != "" {
+		return nil, fmt.Errorf("invalid version %q: pre-release needs a full version", token)
+	}
+	full := len(parts) == 3
+
+	switch op {
+	case "", "=":
+		if full {
+			return between(lower, lower, true), nil
+		}
+		return between(lower, bump(lower, len(parts)-1), false), nil
+	case "~":
+		if full {
+			return between(lower, bump(lower, 1), false), nil
+		}
+		return between(lower, bump(lower, len(parts)-1), false), nil
+	case "^":
+		// bump the first non-zero part, or the last given part if they're all zero
+		index := len(parts) - 1
+		for i, p := range parts {
+			if p != 0 {
+				index = i
+				break
+			}
+		}
+		return between(lower, bump(lower, index), false), nil
+	case ">":
+		if full {
+			return func(v semver.Version) bool { return v.GT(lower) }, nil
+		}
+		upper := bump(lower, len(parts)-1)
+		return func(v semver.Version) bool { return v.GTE(upper) }, nil
+	case ">=":
+		return func(v semver.Version) bool { return v.GTE(lower) }, nil
+	case "<":
+		return func(v semver.Version) bool { return v.LT(lower) }, nil
+	case "<=":
+		if full {
+			return func(v semver.Version) bool { return v.LTE(lower) }, nil
+		}
+		upper := bump(lower, len(parts)-1)
+		return func(v semver.Version) bool { return v.LT(upper) }, nil
+	}
+	return nil, fmt.Errorf("invalid version %q", token)
+}
+
+// bump increments part (0 major, 1 minor, 2 patch) and zeroes the rest
+func bump(v semver.Version, part int) semver.Version {
+	switch part {
+	case 0:
+		return semver.Version{Major: v.Major + 1}
+	case 1:
+		return semver.Version{Major: v.Major, Minor: v.Minor + 1}
+	default:
+		return semver.Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+	}
+}
+
+// between matches lower <= v < upper, or exactly lower if exact is set
+func between(lower, upper semver.Version, exact bool) semver.Range {
+	if exact {
+		return func(v semver.Version) bool { return v.EQ(lower) }
+	}
+	return func(v semver.Version) bool { return v.GTE(lower) && v.LT(upper) }
+}
+
+// Check reports whether v satisfies the constraint
+func (c *Constraint) Check(v semver.Version) bool {
+	if len(v.Pre) > 0 && !c.prerelease {
+		return false
+	}
+	for _, clause := range c.clauses {
+		matched := true
+		for _, term := range clause {
+			if !term(v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve picks the highest tag satisfying the constraint. Tags that aren't semver versions, with or without a "v" prefix, are ignored.
+func (c *Constraint) Resolve(tags []string) (Resolution, error) {
+	var best, newest string
+	var bestVersion, newestVersion semver.Version
+	for _, tag := range tags {
+		v, err := ParseTag(tag)
+		if err != nil {
+			continue
+		}
+		if len(v.Pre) > 0 && !c.prerelease {
+			continue
+		}
+		if newest == "" || v.GT(newestVersion) || (v.EQ(newestVersion) && tag < newest) {
+			newest, newestVersion = tag, v
+		}
+		if !c.Check(v) {
+			continue
+		}
+		if best == "" || v.GT(bestVersion) || (v.EQ(bestVersion) && tag < best) {
+			best, bestVersion = tag, v
+		}
+	}
+	if best == "" {
+		return Resolution{}, fmt.Errorf("no tag matches version %v", c.raw)
+	}
+	r := Resolution{Tag: best}
+	if newestVersion.GT(bestVersion) {
+		r.Newer = newest
+	}
+	return r, nil
+}
+
+// ParseTag parses a tag like "v1.4.2" or "1.4.2" as a semver version
+func ParseTag(tag string) (semver.Version, error) {
+	return semver.Parse(strings.TrimPrefix(tag, "v"))
+}
+
+func (c *Constraint) String() string {
+	return c.raw
+}
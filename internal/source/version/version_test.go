@@ -0,0 +1,76 @@
+package version
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConstraint_Check(t *testing.T) {
+	tests := []struct {
+		constraint string
+		matches    []string
+		rejects    []string
+	}{
+		{"~1.4", []string{"1.4.0", "1.4.9"}, []string{"1.3.9", "1.5.0", "1.4.1-rc.1"}},
+		{"~1.4.2", []string{"1.4.2", "1.4.8"}, []string{"1.4.1", "1.5.0"}},
+		{"~1", []string{"1.0.0", "1.9.3"}, []string{"2.0.0"}},
+		{"^1.4", []string{"1.4.0", "1.9.0"}, []string{"1.3.0", "2.0.0"}},
+		{"^0.4.2", []string{"0.4.2", "0.4.9"}, []string{"0.5.0", "0.4.1"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+		{"1.4", []string{"1.4.0", "1.4.5"}, []string{"1.5.0"}},
+		{"1.x", []string{"1.0.0", "1.8.0"}, []string{"2.0.0", "0.9.0"}},
+		{"=1.4.2", []string{"1.4.2"}, []string{"1.4.3"}},
+		{">=1.2, <1.5", []string{"1.2.0", "1.4.9"}, []string{"1.1.9", "1.5.0"}},
+		{">= 1.2 < 1.5", []string{"1.3.0"}, []string{"1.5.0"}},
+		{">1.4", []string{"1.5.0"}, []string{"1.4.9"}},
+		{"<=1.4", []string{"1.4.9", "0.1.0"}, []string{"1.5.0"}},
+		{"1.x || ^3", []string{"1.2.0", "3.1.0"}, []string{"2.0.0", "4.0.0"}},
+		{"*", []string{"0.0.1", "9.9.9"}, []string{"1.0.0-beta"}},
+		{">=2.0.0-rc.1", []string{"2.0.0-rc.2", "2.0.0"}, []string{"2.0.0-beta"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			c, err := ParseConstraint(tt.constraint)
+			require.NoError(t, err)
+			for _, v := range tt.matches {
+				version, err := ParseTag(v)
+				require.NoError(t, err)
+				assert.True(t, c.Check(version), "%v should match %v", tt.constraint, v)
+			}
+			for _, v := range tt.rejects {
+				version, err := ParseTag(v)
+				require.NoError(t, err)
+				assert.False(t, c.Check(version), "%v should not match %v", tt.constraint, v)
+			}
+		})
+	}
+}
+
+func TestParseConstraint_Invalid(t *testing.T) {
+	for _, s := range []string{"", "~", "abc", "1.2.3.4", ">=", "1.4-rc.1", "~x"} {
+		_, err := ParseConstraint(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestConstraint_Resolve(t *testing.T) {
+	tags := []string{"v1.3.0", "v1.4.0", "v1.4.3", "1.4.3", "v1.5.0-rc.1", "v2.0.0", "latest", "release-1"}
+	c, err := ParseConstraint("~1.4")
+	require.NoError(t, err)
+	r, err := c.Resolve(tags)
+	require.NoError(t, err)
+	assert.Equal(t, Resolution{Tag: "1.4.3", Newer: "v2.0.0"}, r)
+
+	c, err = ParseConstraint("^2")
+	require.NoError(t, err)
+	r, err = c.Resolve(tags)
+	require.NoError(t, err)
+	assert.Equal(t, Resolution{Tag: "v2.0.0"}, r)
+
+	c, err = ParseConstraint("~3")
+	require.NoError(t, err)
+	_, err = c.Resolve(tags)
+	assert.Error(t, err)
+}
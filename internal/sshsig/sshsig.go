@@ -0,0 +1,284 @@
+// Package sshsig verifies detached SSH signatures as made by ssh-keygen -Y sign, see PROTOCOL.sshsig in openssh
+package sshsig
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sshsigMagic   = "SSHSIG"
+	sshsigVersion = 1
+	sshsigPEMType = "SSH SIGNATURE"
+)
+
+// AllowedSigner is a single entry of an ssh allowed_signers file, see ssh-keygen(1)
+type AllowedSigner struct {
+	Principals []string
+	Namespaces []string
+	Key        ssh.PublicKey
+	// ValidAfter and ValidBefore limit when the key is trusted, zero means no limit
+	ValidAfter  time.Time
+	ValidBefore time.Time
+}
+
+func (s AllowedSigner) AllowsNamespace(namespace string) bool {
+	return len(s.Namespaces) == 0 || slices.Contains(s.Namespaces, namespace)
+}
+
+// ValidAt reports whether the key is trusted at t
+func (s AllowedSigner) ValidAt(t time.Time) bool {
+	if !s.ValidAfter.IsZero() && t.Before(s.ValidAfter) {
+		return false
+	}
+	if !s.ValidBefore.IsZero() && !t.Before(s.ValidBefore) {
+		return false
+	}
+	return true
+}
+
+func ParseAllowedSigners(data []byte) ([]AllowedSigner, error) {
+	var signers []AllowedSigner
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := splitQuoted(line, func(r rune) bool { return r == ' ' || r == '\t' })
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("allowed signers line %v: expected principals and key", lineNum)
+		}
+		signer := AllowedSigner{
+			Principals: strings.Split(fields[0], ","),
+		}
+		rest := fields[1:]
+		if !isSSHKeyType(rest[0]) {
+			for _, opt := range splitQuoted(rest[0], func(r rune) bool { return r == ',' }) {
+				name, value, _ := strings.Cut(opt, "=")
+				switch strings.ToLower(name) {
+				case "namespaces":
+					signer.Namespaces = strings.Split(strings.Trim(value, `"`), ",")
+				case "valid-after", "valid-before":
+					t, err := parseTimestamp(strings.Trim(value, `"`))
+					if err != nil {
+						return nil, fmt.Errorf("allowed signers line %v: invalid %v: %w", lineNum, name, err)
+					}
+					if strings.EqualFold(name, "valid-after") {
+						signer.ValidAfter = t
+					} else {
+						signer.ValidBefore = t
+					}
+				case "cert-authority":
+					return nil, fmt.Errorf("allowed signers line %v: cert-authority entries are not supported", lineNum)
+				}
+			}
+			rest = rest[1:]
+		}
+		if len(rest) < 2 {
+			return nil, fmt.Errorf("allowed signers line %v: missing key", lineNum)
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.Join(rest, " ")))
+		if err != nil {
+			return nil, fmt.Errorf("allowed signers line %v: %w", lineNum, err)
+		}
+		signer.Key = key
+		signers = append(signers, signer)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return signers, nil
+}
+
+// parseTimestamp parses an allowed_signers time, YYYYMMDD[HHMM[SS]] in local time or UTC with a Z suffix
+func parseTimestamp(value string) (time.Time, error) {
+	loc := time.Local
+	if v, ok := strings.CutSuffix(value, "Z"); ok {
+		value, loc = v, time.UTC
+	}
+	var layout string
+	switch len(value) {
+	case 8:
+		layout = "20060102"
+	case 12:
+		layout = "200601021504"
+	case 14:
+		layout = "20060102150405"
+	default:
+		return time.Time{}, fmt.Errorf("unsupported timestamp %q", value)
+	}
+	return time.ParseInLocation(layout, value, loc)
+}
+
+// splitQuoted splits on separators, keeping double quoted sections together
+func splitQuoted(line string, isSep func(rune) bool) []string {
+	var fields []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case isSep(r) && !quoted:
+			if current.Len() > 0 {
+				fields = append(fields, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		fields = append(fields, current.String())
+	}
+	return fields
+}
+
+func isSSHKeyType(field string) bool {
+	return strings.HasPrefix(field, "ssh-") || strings.HasPrefix(field, "ecdsa-") || strings.HasPrefix(field, "sk-")
+}
+
+type sshsigBlob struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+type sshsigSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+func sshsigHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported ssh signature hash algorithm %q", algorithm)
+	}
+}
+
+// sshsigPayload builds the data an SSHSIG signature is made over
+func sshsigPayload(namespace, algorithm string, message []byte) ([]byte, error) {
+	h, err := sshsigHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(message)
+	signed := ssh.Marshal(sshsigSignedData{
+		Namespace:     namespace,
+		HashAlgorithm: algorithm,
+		Hash:          h.Sum(nil),
+	})
+	return append([]byte(sshsigMagic), signed...), nil
+}
+
+// Verify checks an armored SSHSIG signature of message against the allowed signers, returning the matching signer
+func Verify(signers []AllowedSigner, armored, message []byte, namespace string) (*AllowedSigner, error) {
+	return VerifyAt(signers, armored, message, namespace, time.Now())
+}
+
+// VerifyAt is Verify for a signature made at signedAt, which must be within the signer's validity window
+func VerifyAt(signers []AllowedSigner, armored, message []byte, namespace string, signedAt time.Time) (*AllowedSigner, error) {
+	block, rest := pem.Decode(armored)
+	if block == nil || block.Type != sshsigPEMType {
+		return nil, errors.New("invalid ssh signature armor")
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return nil, errors.New("multiple ssh signatures are not supported")
+	}
+	if !bytes.HasPrefix(block.Bytes, []byte(sshsigMagic)) {
+		return nil, errors.New("invalid ssh signature preamble")
+	}
+	var blob sshsigBlob
+	if err := ssh.Unmarshal(block.Bytes[len(sshsigMagic):], &blob); err != nil {
+		return nil, fmt.Errorf("invalid ssh signature: %w", err)
+	}
+	if blob.Version != sshsigVersion {
+		return nil, fmt.Errorf("unsupported ssh signature version %v", blob.Version)
+	}
+	if blob.Namespace != namespace {
+		return nil, fmt.Errorf("ssh signature namespace %q does not match %q", blob.Namespace, namespace)
+	}
+	pub, err := ssh.ParsePublicKey(blob.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh signature key: %w", err)
+	}
+	var signer *AllowedSigner
+	for i, s := range signers {
+		if bytes.Equal(s.Key.Marshal(), pub.Marshal()) && s.AllowsNamespace(namespace) {
+			signer = &signers[i]
+			break
+		}
+	}
+	if signer == nil {
+		return nil, fmt.Errorf("ssh signing key %v is not an allowed signer", ssh.FingerprintSHA256(pub))
+	}
+	if !signer.ValidAt(signedAt) {
+		return nil, fmt.Errorf("ssh signing key %v is not valid at %v", ssh.FingerprintSHA256(pub), signedAt.Format(time.RFC3339))
+	}
+	var sig ssh.Signature
+	if err := ssh.Unmarshal(blob.Signature, &sig); err != nil {
+		return nil, fmt.Errorf("invalid ssh signature: %w", err)
+	}
+	// ssh-rsa signatures use SHA-1, which ssh-keygen no longer accepts either
+	if sig.Format == ssh.KeyAlgoRSA {
+		return nil, errors.New("ssh-rsa (SHA-1) signatures are not supported")
+	}
+	payload, err := sshsigPayload(namespace, blob.HashAlgorithm, message)
+	if err != nil {
+		return nil, err
+	}
+	if err := pub.Verify(payload, &sig); err != nil {
+		return nil, fmt.Errorf("bad ssh signature: %w", err)
+	}
+	return signer, nil
+}
+
+// Sign makes an armored SSHSIG signature of message using sha512, like ssh-keygen -Y sign
+func Sign(signer ssh.Signer, namespace string, message []byte) ([]byte, error) {
+	payload, err := sshsigPayload(namespace, "sha512", message)
+	if err != nil {
+		return nil, err
+	}
+	var sig *ssh.Signature
+	if as, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		sig, err = as.SignWithAlgorithm(rand.Reader, payload, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = signer.Sign(rand.Reader, payload)
+	}
+	if err != nil {
+		return nil, err
+	}
+	blob := ssh.Marshal(sshsigBlob{
+		Version:       sshsigVersion,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     namespace,
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(sig),
+	})
+	return pem.EncodeToMemory(&pem.Block{Type: sshsigPEMType, Bytes: append([]byte(sshsigMagic), blob...)}), nil
+}
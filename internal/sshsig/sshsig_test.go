@@ -0,0 +1,116 @@
+package sshsig
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func newSigner(t *testing.T) ssh.Signer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	return signer
+}
+
+func TestParseAllowedSigners(t *testing.T) {
+	signer := newSigner(t)
+	key := string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	data := "# comment\n\n" +
+		"alice@example.com,bob@example.com " + key + " comment\n" +
+		`carol@example.com namespaces="git,file" ` + key + "\n"
+	signers, err := ParseAllowedSigners([]byte(data))
+	require.NoError(t, err)
+	require.Len(t, signers, 2)
+	assert.Equal(t, []string{"alice@example.com", "bob@example.com"}, signers[0].Principals)
+	assert.True(t, signers[0].AllowsNamespace("git"))
+	assert.Equal(t, []string{"git", "file"}, signers[1].Namespaces)
+	assert.False(t, signers[1].AllowsNamespace("email"))
+
+	_, err = ParseAllowedSigners([]byte("*@example.com cert-authority " + key))
+	assert.Error(t, err)
+	_, err = ParseAllowedSigners([]byte("alice@example.com"))
+	assert.Error(t, err)
+}
+
+func TestSignVerify(t *testing.T) {
+	signer := newSigner(t)
+	other := newSigner(t)
+	signers := []AllowedSigner{{Principals: []string{"alice"}, Namespaces: []string{"file"}, Key: signer.PublicKey()}}
+	message := []byte("hello")
+
+	sig, err := Sign(signer, "file", message)
+	require.NoError(t, err)
+	matched, err := Verify(signers, sig, message, "file")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, matched.Principals)
+
+	_, err = Verify(signers, sig, []byte("tampered"), "file")
+	assert.Error(t, err)
+	_, err = Verify(signers, sig, message, "git")
+	assert.Error(t, err, "namespace mismatch")
+	otherSig, err := Sign(other, "file", message)
+	require.NoError(t, err)
+	_, err = Verify(signers, otherSig, message, "file")
+	assert.Error(t, err, "unknown signer")
+}
+
+func TestVerifyValidity(t *testing.T) {
+	signer := newSigner(t)
+	key := string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	signers, err := ParseAllowedSigners([]byte(`alice valid-after="20240101Z",valid-before="20250101000000Z" ` + key))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), signers[0].ValidAfter)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), signers[0].ValidBefore)
+
+	sig, err := Sign(signer, "git", []byte("hello"))
+	require.NoError(t, err)
+	_, err = VerifyAt(signers, sig, []byte("hello"), "git", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	_, err = VerifyAt(signers, sig, []byte("hello"), "git", time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC))
+	assert.ErrorContains(t, err, "not valid at")
+	_, err = VerifyAt(signers, sig, []byte("hello"), "git", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.ErrorContains(t, err, "not valid at")
+
+	_, err = ParseAllowedSigners([]byte(`alice valid-after="2024" ` + key))
+	assert.Error(t, err)
+}
+
+func TestVerifyRSA(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	signers := []AllowedSigner{{Principals: []string{"alice"}, Key: signer.PublicKey()}}
+	message := []byte("hello")
+
+	sig, err := Sign(signer, "git", message)
+	require.NoError(t, err)
+	_, err = Verify(signers, sig, message, "git")
+	require.NoError(t, err, "rsa keys sign with rsa-sha2-512")
+
+	// re-sign the same payload with SHA-1
+	payload, err := sshsigPayload("git", "sha512", message)
+	require.NoError(t, err)
+	sha1Sig, err := signer.(ssh.AlgorithmSigner).SignWithAlgorithm(rand.Reader, payload, ssh.KeyAlgoRSA)
+	require.NoError(t, err)
+	blob := ssh.Marshal(sshsigBlob{
+		Version:       sshsigVersion,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     "git",
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(sha1Sig),
+	})
+	armored := pem.EncodeToMemory(&pem.Block{Type: sshsigPEMType, Bytes: append([]byte(sshsigMagic), blob...)})
+	_, err = Verify(signers, armored, message, "git")
+	assert.ErrorContains(t, err, "SHA-1")
+}
@@ -31,6 +31,8 @@ type Component struct {
 	Resources      *ResourceSet
 	State          ComponentLifecycle
 	Defaults       map[string]any
+	Publish        []string
+	Snippets       []manifests.SnippetConfig
 	ServiceConfigs *ServiceConfigSet
 	Version        int
 }
@@ -137,6 +139,13 @@ func (c *Component) GetManifest() (*manifests.ComponentManifest, error) {
 func (c *Component) ApplyManifest(man *manifests.ComponentManifest) error {
 	maps.Copy(c.Defaults, man.Defaults)
 	c.Settings = man.Settings
+	c.Publish = man.Publish
+	for _, s := range man.Snippets {
+		if s.Source == "" {
+			s.Source = filepath.Join("components", c.Name, manifests.ComponentManifestFile)
+		}
+		c.Snippets = append(c.Snippets, s)
+	}
 	slices.Sort(man.Secrets)
 	var secretResources []Resource
 	for _, s := range man.Secrets {
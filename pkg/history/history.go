@@ -0,0 +1,274 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"primamateria.systems/materia/pkg/plan"
+	"primamateria.systems/materia/pkg/source"
+)
+
+const (
+	TriggerCLI     = "cli"
+	TriggerTimer   = "timer"
+	TriggerWebhook = "webhook"
+	TriggerVarlink = "varlink"
+)
+
+const (
+	RollbackNone      = ""
+	RollbackSucceeded = "succeeded"
+	RollbackFailed    = "failed"
+)
+
+var ErrRecordNotFound = errors.New("run record not found")
+
+const recordSuffix = ".toml"
+
+type SourceRevision struct {
+	Source string `toml:"source" json:"source"`
+	Before string `toml:"before" json:"before"`
+	After  string `toml:"after" json:"after"`
+}
+
+type Record struct {
+	ID             string           `toml:"id" json:"id"`
+	Timestamp      time.Time        `toml:"timestamp" json:"timestamp"`
+	Trigger        string           `toml:"trigger" json:"trigger"`
+	Revisions      []SourceRevision `toml:"revisions" json:"revisions"`
+	Plan           []string         `toml:"plan" json:"plan"`
+	TotalSteps     int              `toml:"total_steps" json:"total_steps"`
+	StepsCompleted int              `toml:"steps_completed" json:"steps_completed"`
+	Errors         []string         `toml:"errors" json:"errors"`
+	Rollback       string           `toml:"rollback" json:"rollback"`
+}
+
+func NewRecord(trigger string) *Record {
+	return &Record{
+		Timestamp: time.Now(),
+		Trigger:   trigger,
+	}
+}
+
+// SetRevisions records the revisions each source moved between on its last sync
+func (r *Record) SetRevisions(reports map[string]*source.SyncReport) {
+	r.Revisions = nil
+	for _, name := range slices.Sorted(maps.Keys(reports)) {
+		r.Revisions = append(r.Revisions, SourceRevision{
+			Source: name,
+			Before: reports[name].OldRevision,
+			After:  reports[name].NewRevision,
+		})
+	}
+}
+
+func (r *Record) SetPlan(p *plan.Plan) {
+	if p == nil {
+		return
+	}
+	r.TotalSteps = p.Size()
+	if !p.Empty() {
+		r.Plan = p.PrettyLines()
+	}
+}
+
+func (r *Record) AddError(err error) {
+	if err == nil {
+		return
+	}
+	r.Errors = append(r.Errors, err.Error())
+}
+
+func (r *Record) Failed() bool {
+	return len(r.Errors) > 0
+}
+
+func (r *Record) Status() string {
+	switch {
+	case r.Rollback == RollbackSucceeded:
+		return "rolled back"
+	case r.Rollback == RollbackFailed:
+		return "rollback failed"
+	case r.Failed():
+		return "failed"
+	default:
+		return "ok"
+	}
+}
+
+func (r *Record) String() string {
+	return fmt.Sprintf("%v  %v  %-8v %-16v %v/%v steps", r.ID, r.Timestamp.Format(time.RFC3339), r.Trigger, r.Status(), r.StepsCompleted, r.TotalSteps)
+}
+
+func (r *Record) Pretty() string {
+	var result strings.Builder
+	fmt.Fprintf(&result, "Run %v\n", r.ID)
+	fmt.Fprintf(&result, "Time: %v\n", r.Timestamp.Format(time.RFC3339))
+	fmt.Fprintf(&result, "Trigger: %v\n", r.Trigger)
+	fmt.Fprintf(&result, "Status: %v\n", r.Status())
+	fmt.Fprintf(&result, "Steps completed: %v/%v\n", r.StepsCompleted, r.TotalSteps)
+	if len(r.Revisions) > 0 {
+		result.WriteString("Sources:\n")
+		for _, v := range r.Revisions {
+			before := v.Before
+			if before == "" {
+				before = "<none>"
+			}
+			fmt.Fprintf(&result, "  %v: %v -> %v\n", v.Source, before, v.After)
+		}
+	}
+	if len(r.Errors) > 0 {
+		result.WriteString("Errors:\n")
+		for _, v := range r.Errors {
+			fmt.Fprintf(&result, "  %v\n", v)
+		}
+	}
+	if len(r.Plan) > 0 {
+		result.WriteString("Plan:\n")
+		for _, v := range r.Plan {
+			fmt.Fprintf(&result, "  %v\n", v)
+		}
+	}
+	return result.String()
+}
+
+// History is a rotating on-disk store of run records, one TOML file per run
+type History struct {
+	dir       string
+	retention int
+}
+
+func NewHistory(dir string, retention int) (*History, error) {
+	if dir == "" {
+		return nil, errors.New("need history directory")
+	}
+	if retention < 0 {
+		return nil, fmt.Errorf("invalid history retention: %v", retention)
+	}
+	return &History{
+		dir:       dir,
+		retention: retention,
+	}, nil
+}
+
+func (h *History) Enabled() bool {
+	return h.retention > 0
+}
+
+func (h *History) Save(r *Record) error {
+	if !h.Enabled() {
+		return nil
+	}
+	if r == nil {
+		return errors.New("need run record to save")
+	}
+	if err := os.MkdirAll(h.dir, 0o755); err != nil {
+		return fmt.Errorf("unable to create history directory: %w", err)
+	}
+	if r.ID == "" {
+		r.ID = h.newID(r.Timestamp)
+	}
+	path := filepath.Join(h.dir, r.ID+recordSuffix)
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create run record %v: %w", path, err)
+	}
+	err = toml.NewEncoder(file).Encode(r)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode run record: %w", err)
+	}
+	return h.prune()
+}
+
+// List returns all saved run records, newest first
+func (h *History) List() ([]*Record, error) {
+	ids, err := h.ids()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*Record, 0, len(ids))
+	for _, id := range slices.Backward(ids) {
+		r, err := h.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+func (h *History) Get(id string) (*Record, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid run id %q", id)
+	}
+	var r Record
+	_, err := toml.DecodeFile(filepath.Join(h.dir, id+recordSuffix), &r)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, fmt.Errorf("unable to load run record %v: %w", id, err)
+	}
+	return &r, nil
+}
+
+// ids returns the IDs of all saved records, oldest first
+func (h *History) ids() ([]string, error) {
+	entries, err := os.ReadDir(h.dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != recordSuffix {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(e.Name(), recordSuffix))
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (h *History) prune() error {
+	ids, err := h.ids()
+	if err != nil {
+		return err
+	}
+	if len(ids) <= h.retention {
+		return nil
+	}
+	for _, id := range ids[:len(ids)-h.retention] {
+		if err := os.Remove(filepath.Join(h.dir, id+recordSuffix)); err != nil {
+			return fmt.Errorf("unable to remove old run record %v: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (h *History) newID(ts time.Time) string {
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	base := ts.UTC().Format("20060102T150405Z")
+	id := base
+	for i := 1; ; i++ {
+		if _, err := os.Stat(filepath.Join(h.dir, id+recordSuffix)); errors.Is(err, fs.ErrNotExist) {
+			return id
+		}
+		id = fmt.Sprintf("%v-%02d", base, i)
+	}
+}
@@ -0,0 +1,37 @@
+package history
+
+import (
+	"fmt"
+
+	"github.com/knadh/koanf/v2"
+)
+
+type HistoryConfig struct {
+	Retention int `toml:"retention" koanf:"retention"`
+}
+
+func NewHistoryConfig(k *koanf.Koanf) (*HistoryConfig, error) {
+	c := DefaultHistoryConfig()
+	err := k.UnmarshalWithConf("history", c, koanf.UnmarshalConf{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create history config: %w", err)
+	}
+	return c, nil
+}
+
+func DefaultHistoryConfig() *HistoryConfig {
+	return &HistoryConfig{
+		Retention: 20,
+	}
+}
+
+func (c *HistoryConfig) String() string {
+	return fmt.Sprintf("Retention: %v\n", c.Retention)
+}
+
+func (c *HistoryConfig) Validate() error {
+	if c.Retention < 0 {
+		return fmt.Errorf("invalid history retention: %v", c.Retention)
+	}
+	return nil
+}
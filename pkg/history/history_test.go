@@ -0,0 +1,97 @@
+package history
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"primamateria.systems/materia/pkg/source"
+)
+
+func TestHistory_SaveAndGet(t *testing.T) {
+	h, err := NewHistory(t.TempDir(), 5)
+	require.NoError(t, err)
+
+	r := NewRecord(TriggerCLI)
+	r.Revisions = []SourceRevision{{Source: "git:example", Before: "abc", After: "def"}}
+	r.Plan = []string{"1. (hello) Install Container hello.container"}
+	r.TotalSteps = 1
+	r.StepsCompleted = 1
+	require.NoError(t, h.Save(r))
+	require.NotEmpty(t, r.ID)
+
+	got, err := h.Get(r.ID)
+	require.NoError(t, err)
+	assert.Equal(t, TriggerCLI, got.Trigger)
+	assert.Equal(t, r.Revisions, got.Revisions)
+	assert.Equal(t, r.Plan, got.Plan)
+	assert.Equal(t, "ok", got.Status())
+
+	_, err = h.Get("missing")
+	assert.True(t, errors.Is(err, ErrRecordNotFound))
+	_, err = h.Get("../missing")
+	assert.Error(t, err)
+}
+
+func TestHistory_Retention(t *testing.T) {
+	h, err := NewHistory(t.TempDir(), 3)
+	require.NoError(t, err)
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		r := NewRecord(TriggerTimer)
+		r.Timestamp = start.Add(time.Duration(i) * time.Minute)
+		if i == 4 {
+			r.AddError(errors.New("boom"))
+		}
+		require.NoError(t, h.Save(r))
+	}
+	records, err := h.List()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "20260101T000400Z", records[0].ID)
+	assert.Equal(t, "failed", records[0].Status())
+	assert.Equal(t, "20260101T000200Z", records[2].ID)
+}
+
+func TestHistory_IDCollision(t *testing.T) {
+	h, err := NewHistory(t.TempDir(), 10)
+	require.NoError(t, err)
+
+	ts := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := NewRecord(TriggerCLI)
+	first.Timestamp = ts
+	second := NewRecord(TriggerCLI)
+	second.Timestamp = ts
+	require.NoError(t, h.Save(first))
+	require.NoError(t, h.Save(second))
+	assert.NotEqual(t, first.ID, second.ID)
+
+	records, err := h.List()
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+}
+
+func TestHistory_Disabled(t *testing.T) {
+	dir := t.TempDir()
+	h, err := NewHistory(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, h.Save(NewRecord(TriggerCLI)))
+	records, err := h.List()
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestRecord_SetRevisions(t *testing.T) {
+	r := NewRecord(TriggerTimer)
+	r.SetRevisions(map[string]*source.SyncReport{
+		"git:repo":  {OldRevision: "abc", NewRevision: "def"},
+		"file:/srv": {NewRevision: "123"},
+	})
+	assert.Equal(t, []SourceRevision{
+		{Source: "file:/srv", After: "123"},
+		{Source: "git:repo", Before: "abc", After: "def"},
+	}, r.Revisions)
+}
@@ -3,6 +3,7 @@ package loader
 import (
 	"context"
 
+	"primamateria.systems/materia/internal/attributes"
 	"primamateria.systems/materia/internal/macros"
 	"primamateria.systems/materia/pkg/components"
 	"primamateria.systems/materia/pkg/manifests"
@@ -35,7 +36,7 @@ func NewHostComponentPipeline(mgr components.ComponentReader, cont SecretsManage
 	}
 }
 
-func NewSourceComponentPipeline(mgr components.ComponentReader, macros macros.MacroMap, attrs map[string]any, overrides, extensions []*manifests.ComponentManifest) *ComponentLoadPipeline {
+func NewSourceComponentPipeline(mgr components.ComponentReader, macros macros.MacroMap, attrs map[string]any, merge attributes.MergeStrategy, overrides, extensions []*manifests.ComponentManifest) *ComponentLoadPipeline {
 	return &ComponentLoadPipeline{
 		stages: []ComponentLoadStage{
 			&ComponentInitStage{manager: mgr},
@@ -43,9 +44,10 @@ func NewSourceComponentPipeline(mgr components.ComponentReader, macros macros.Ma
 				manager:    mgr,
 				overrides:  overrides,
 				extensions: extensions,
+				merge:      merge,
 			},
 			&ResourceDiscoveryStage{manager: mgr},
-			&TemplateProcessorStage{macros: macros, attrs: attrs},
+			&TemplateProcessorStage{macros: macros, attrs: attrs, merge: merge},
 			&ComponentInstanceStage{},
 			&SecretInjectorStage{attrs: attrs},
 			&QuadletExpanderStage{},
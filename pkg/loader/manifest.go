@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"charm.land/log/v2"
+	"primamateria.systems/materia/internal/attributes"
 	"primamateria.systems/materia/pkg/components"
 	"primamateria.systems/materia/pkg/manifests"
 )
@@ -13,6 +14,7 @@ type ManifestLoadStage struct {
 	manager    components.ComponentReader
 	overrides  []*manifests.ComponentManifest
 	extensions []*manifests.ComponentManifest
+	merge      attributes.MergeStrategy
 }
 
 func (s *ManifestLoadStage) Process(ctx context.Context, comp *components.Component) error {
@@ -36,7 +38,7 @@ func (s *ManifestLoadStage) Process(ctx context.Context, comp *components.Compon
 	}
 	if len(s.extensions) > 0 {
 		for _, extension := range s.extensions {
-			manifest, err = manifests.ExtendComponentManifests(manifest, extension)
+			manifest, err = manifests.ExtendComponentManifests(manifest, extension, s.merge)
 			if err != nil {
 				return fmt.Errorf("can't load source component %v's overrides: %w", comp.Name, err)
 			}
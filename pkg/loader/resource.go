@@ -24,6 +24,7 @@ func (s *ComponentInitStage) Process(ctx context.Context, comp *components.Compo
 	}
 	comp.Resources = newcomp.Resources
 	comp.Version = newcomp.Version
+	comp.Snippets = newcomp.Snippets
 	return nil
 }
 
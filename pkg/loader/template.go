@@ -3,6 +3,7 @@ package loader
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"text/template"
 
 	"primamateria.systems/materia/internal/attributes"
@@ -13,15 +14,26 @@ import (
 type TemplateProcessorStage struct {
 	macros macros.MacroMap
 	attrs  map[string]any
+	merge  attributes.MergeStrategy
 }
 
 func (s *TemplateProcessorStage) Process(ctx context.Context, comp *components.Component) error {
-	vars := attributes.MergeAttributes(s.attrs, comp.Defaults)
+	vars := s.merge.Merge(s.attrs, comp.Defaults)
+	funcs := s.macros(vars)
+	if len(comp.Snippets) > 0 {
+		// a component's own snippets take precedence over the repository's
+		snippets, err := macros.LoadSnippets(comp.Snippets)
+		if err != nil {
+			return fmt.Errorf("can't load snippets for component %v: %w", comp.Name, err)
+		}
+		parent, _ := funcs["snippet"].(macros.SnippetFunc)
+		funcs["snippet"] = macros.NewSnippetFunc(snippets, parent)
+	}
 	for _, r := range comp.Resources.List() {
 		if r.Template {
 			bodyTemplate := r.Content
 			result := bytes.NewBuffer([]byte{})
-			tmpl, err := template.New("resource").Option("missingkey=error").Funcs(s.macros(vars)).Parse(bodyTemplate)
+			tmpl, err := template.New(r.Filepath()).Option("missingkey=error").Funcs(funcs).Parse(bodyTemplate)
 			if err != nil {
 				return err
 			}
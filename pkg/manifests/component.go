@@ -6,6 +6,7 @@ import (
 	"slices"
 
 	"github.com/BurntSushi/toml"
+	"primamateria.systems/materia/internal/attributes"
 )
 
 var ComponentManifestFile = "MANIFEST.toml"
@@ -43,6 +44,14 @@ func (src ServiceResourceConfig) Validate() error {
 	return nil
 }
 
+// RemoteExports is what a remote component shares with the repositories that use it
+type RemoteExports struct {
+	// Snippets are added to the repository's snippets, which take precedence over them
+	Snippets []SnippetConfig `toml:"Snippets"`
+	// Attributes are defaults available to every component under the remote's name
+	Attributes map[string]any `toml:"Attributes"`
+}
+
 type ComponentManifest struct {
 	Defaults map[string]any          `toml:"Defaults"`
 	Settings Settings                `toml:"Settings"`
@@ -50,6 +59,10 @@ type ComponentManifest struct {
 	Services []ServiceResourceConfig `toml:"Services"`
 	Scripts  []string                `toml:"Scripts"`
 	Secrets  []string                `toml:"Secrets"`
+	// Publish lists the attributes other components on the host can reference with m_attr
+	Publish []string `toml:"Publish"`
+	// Exports is only read when the component is used as a remote
+	Exports *RemoteExports `toml:"Exports"`
 }
 
 func LoadComponentManifestFromContent(buffer []byte) (*ComponentManifest, error) {
@@ -108,11 +121,17 @@ func MergeComponentManifests(original, override *ComponentManifest) (*ComponentM
 	} else {
 		copy(result.Secrets, original.Secrets)
 	}
+	if len(override.Publish) > 0 {
+		result.Publish = slices.Clone(override.Publish)
+	} else {
+		result.Publish = slices.Clone(original.Publish)
+	}
 
 	return &result, nil
 }
 
-func ExtendComponentManifests(original, extension *ComponentManifest) (*ComponentManifest, error) {
+// ExtendComponentManifests adds an extension to a manifest. The extension's defaults are layered over the original's with merge.
+func ExtendComponentManifests(original, extension *ComponentManifest, merge attributes.MergeStrategy) (*ComponentManifest, error) {
 	if original == nil {
 		return nil, errors.New("need non nil original manifest for merge")
 	}
@@ -123,7 +142,7 @@ func ExtendComponentManifests(original, extension *ComponentManifest) (*Componen
 	result := ComponentManifest{}
 	result.Defaults = maps.Clone(original.Defaults)
 	if len(extension.Defaults) > 0 {
-		maps.Copy(result.Defaults, extension.Defaults)
+		result.Defaults = merge.Merge(maps.Clone(extension.Defaults), original.Defaults)
 	}
 	result.Settings = original.Settings
 	result.Settings.Merge(extension.Settings)
@@ -142,6 +161,7 @@ func ExtendComponentManifests(original, extension *ComponentManifest) (*Componen
 	result.Snippets = append(original.Snippets, extension.Snippets...)
 	result.Scripts = append(original.Scripts, extension.Scripts...)
 	result.Secrets = append(original.Secrets, extension.Secrets...)
+	result.Publish = append(original.Publish, extension.Publish...)
 
 	return &result, nil
 }
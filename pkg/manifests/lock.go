@@ -0,0 +1,128 @@
+package manifests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+var RemotesLockFile = "MANIFEST.lock"
+
+// LockedRemote pins a remote component to the revision it resolved to when it was locked.
+// Source identifies where the remote came from so an edited remote isn't held to a stale revision.
+type LockedRemote struct {
+	Source   string `toml:"source"`
+	Revision string `toml:"revision"`
+}
+
+type RemotesLock struct {
+	Remotes map[string]LockedRemote `toml:"Remotes"`
+}
+
+// RemoteDrift describes a remote whose source has moved past its locked revision
+type RemoteDrift struct {
+	Name   string
+	Locked string
+	Latest string
+}
+
+// RemoteVersion is the version a remote's version constraint resolved to
+type RemoteVersion struct {
+	Name       string
+	Constraint string
+	Version    string
+	// Newer is the newest available version when it falls outside the constraint
+	Newer string
+}
+
+// SourceURL identifies where a remote is fetched from, including the branch, tag or version constraint it follows.
+// File remotes return an empty string since they can't be pinned.
+func (r RemoteComponentConfig) SourceURL() string {
+	var url, ref string
+	switch {
+	case r.GitSource != nil:
+		url, ref = "git:"+r.GitSource.URL, r.GitSource.Branch
+		if r.GitSource.Tag != "" {
+			ref = r.GitSource.Tag
+		}
+	case r.OciSource != nil:
+		url, ref = "oci:"+r.OciSource.URL, r.OciSource.Tag
+	case r.HTTPSource != nil:
+		return "http:" + r.HTTPSource.URL
+	default:
+		return ""
+	}
+	if v := r.VersionConstraint(); v != "" {
+		ref = "version=" + v
+	}
+	if ref != "" {
+		return fmt.Sprintf("%v#%v", url, ref)
+	}
+	return url
+}
+
+// VersionConstraint returns the remote's semver constraint, set either on the remote or its source
+func (r RemoteComponentConfig) VersionConstraint() string {
+	switch {
+	case r.Version != "":
+		return r.Version
+	case r.GitSource != nil:
+		return r.GitSource.Version
+	case r.OciSource != nil:
+		return r.OciSource.Version
+	}
+	return ""
+}
+
+// LoadRemotesLock reads a lockfile, a missing lockfile is an empty lock
+func LoadRemotesLock(path string) (*RemotesLock, error) {
+	l := &RemotesLock{}
+	if _, err := toml.DecodeFile(path, l); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if l.Remotes == nil {
+		l.Remotes = make(map[string]LockedRemote)
+	}
+	return l, nil
+}
+
+// Lookup returns the locked revision for a remote, if it's locked to the same source
+func (l *RemotesLock) Lookup(name string, r RemoteComponentConfig) (string, bool) {
+	locked, ok := l.Remotes[name]
+	if !ok || locked.Revision == "" || r.SourceURL() == "" || locked.Source != r.SourceURL() {
+		return "", false
+	}
+	return locked.Revision, true
+}
+
+func (l *RemotesLock) Write(path string) error {
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by materia remotes lock, do not edit\n")
+	if err := toml.NewEncoder(&buf).Encode(l); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".lock-*")
+	if err != nil {
+		return fmt.Errorf("unable to write lockfile: %w", err)
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("unable to write lockfile: %w", err)
+	}
+	return nil
+}
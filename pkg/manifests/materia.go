@@ -7,6 +7,7 @@ import (
 	"github.com/BurntSushi/toml"
 	filesource "primamateria.systems/materia/internal/source/file"
 	"primamateria.systems/materia/internal/source/git"
+	httpsource "primamateria.systems/materia/internal/source/http"
 	"primamateria.systems/materia/internal/source/oci"
 )
 
@@ -16,17 +17,24 @@ var (
 	ErrComponentNotAssignedToHost = errors.New("component not assigned to host")
 )
 
-type SnippetConfig struct {
-	Name       string   `toml:"Name"`
-	Body       string   `toml:"Body"`
-	Parameters []string `toml:"Parameters"`
+// RemoteCredentials configures authentication for a remote component.
+// Secrets are referenced by attribute name so they don't need to be stored in the manifest.
+type RemoteCredentials struct {
+	PrivateKey          string `toml:"private_key"`
+	PassphraseFile      string `toml:"passphrase_file"`
+	PassphraseAttribute string `toml:"passphrase_attribute"`
+	Username            string `toml:"username"`
+	PasswordAttribute   string `toml:"password_attribute"`
 }
 
 type RemoteComponentConfig struct {
-	GitSource  *git.Config        `toml:"git,omitempty"`
-	OciSource  *oci.Config        `toml:"oci,omitempty"`
-	FileSource *filesource.Config `toml:"file,omitempty"`
-	Subpath    string             `toml:"subpath"`
+	GitSource   *git.Config        `toml:"git,omitempty"`
+	OciSource   *oci.Config        `toml:"oci,omitempty"`
+	FileSource  *filesource.Config `toml:"file,omitempty"`
+	HTTPSource  *httpsource.Config `toml:"http,omitempty"`
+	Subpath     string             `toml:"subpath"`
+	Version     string             `toml:"version"`
+	Credentials *RemoteCredentials `toml:"credentials,omitempty"`
 }
 
 type MateriaManifest struct {
@@ -0,0 +1,142 @@
+package manifests
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// SnippetDir is the directory snippet files are loaded from, in a repository or a component
+const SnippetDir = "snippets"
+
+type SnippetConfig struct {
+	Name        string             `toml:"Name" json:"name"`
+	Description string             `toml:"Description" json:"description,omitempty"`
+	Body        string             `toml:"Body" json:"body,omitempty"`
+	Parameters  []SnippetParameter `toml:"Parameters" json:"parameters,omitempty"`
+	// Source is where the snippet was defined, for error messages and listing snippets
+	Source string `toml:"-" json:"source"`
+}
+
+// SnippetParameter is a positional snippet argument. In TOML it is either just a name, which is required, or a
+// table with a Default or Optional set.
+type SnippetParameter struct {
+	Name     string `toml:"Name" json:"name"`
+	Default  any    `toml:"Default" json:"default,omitempty"`
+	Optional bool   `toml:"Optional" json:"optional,omitempty"`
+}
+
+func (p *SnippetParameter) UnmarshalTOML(data any) error {
+	switch v := data.(type) {
+	case string:
+		p.Name = v
+	case map[string]any:
+		for k, val := range v {
+			var ok bool
+			switch k {
+			case "Name":
+				p.Name, ok = val.(string)
+			case "Default":
+				p.Default, ok = val, true
+			case "Optional":
+				p.Optional, ok = val.(bool)
+			default:
+				return fmt.Errorf("unknown snippet parameter option %v", k)
+			}
+			if !ok {
+				return fmt.Errorf("invalid snippet parameter option %v: %v", k, val)
+			}
+		}
+	default:
+		return fmt.Errorf("snippet parameter must be a name or table, got %T", data)
+	}
+	return nil
+}
+
+func (p SnippetParameter) Required() bool {
+	return !p.Optional && p.Default == nil
+}
+
+func (p SnippetParameter) String() string {
+	switch {
+	case p.Default != nil:
+		return fmt.Sprintf("[%v=%v]", p.Name, p.Default)
+	case p.Optional:
+		return fmt.Sprintf("[%v]", p.Name)
+	}
+	return p.Name
+}
+
+func (s SnippetConfig) Validate() error {
+	if s.Name == "" {
+		return errors.New("snippet without a name")
+	}
+	var seen []string
+	optional := false
+	for _, p := range s.Parameters {
+		if p.Name == "" {
+			return fmt.Errorf("snippet %v has a parameter without a name", s.Name)
+		}
+		if slices.Contains(seen, p.Name) {
+			return fmt.Errorf("snippet %v has parameter %v more than once", s.Name, p.Name)
+		}
+		seen = append(seen, p.Name)
+		if !p.Required() {
+			optional = true
+		} else if optional {
+			return fmt.Errorf("snippet %v has required parameter %v after an optional one", s.Name, p.Name)
+		}
+	}
+	return nil
+}
+
+// Usage shows how a snippet is called, e.g. `proxy host [port=80]`
+func (s SnippetConfig) Usage() string {
+	parts := []string{s.Name}
+	for _, p := range s.Parameters {
+		parts = append(parts, p.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// LoadSnippetDir loads every <name>.gotmpl file in dir as a snippet. Parameters and a description can be declared in
+// a <name>.toml file next to it. A missing directory has no snippets.
+func LoadSnippetDir(dir, source string) ([]SnippetConfig, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var snippets []SnippetConfig
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".gotmpl")
+		if e.IsDir() || !ok {
+			continue
+		}
+		var snippet SnippetConfig
+		meta := filepath.Join(dir, name+".toml")
+		if _, err := toml.DecodeFile(meta, &snippet); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("invalid snippet parameters %v: %w", meta, err)
+		}
+		body, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		snippet.Name = name
+		snippet.Body = strings.TrimSuffix(string(body), "\n")
+		snippet.Source = filepath.Join(source, e.Name())
+		if err := snippet.Validate(); err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, snippet)
+	}
+	return snippets, nil
+}
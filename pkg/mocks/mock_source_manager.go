@@ -213,6 +213,61 @@ func (_c *MockSourceManager_ComponentExists_Call) RunAndReturn(run func(s string
 	return _c
 }
 
+// ExportedAttributes provides a mock function for the type MockSourceManager
+func (_mock *MockSourceManager) ExportedAttributes() (map[string]map[string]any, error) {
+	ret := _mock.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for ExportedAttributes")
+	}
+
+	var r0 map[string]map[string]any
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func() (map[string]map[string]any, error)); ok {
+		return returnFunc()
+	}
+	if returnFunc, ok := ret.Get(0).(func() map[string]map[string]any); ok {
+		r0 = returnFunc()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]map[string]any)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func() error); ok {
+		r1 = returnFunc()
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockSourceManager_ExportedAttributes_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ExportedAttributes'
+type MockSourceManager_ExportedAttributes_Call struct {
+	*mock.Call
+}
+
+// ExportedAttributes is a helper method to define mock.On call
+func (_e *MockSourceManager_Expecter) ExportedAttributes() *MockSourceManager_ExportedAttributes_Call {
+	return &MockSourceManager_ExportedAttributes_Call{Call: _e.mock.On("ExportedAttributes")}
+}
+
+func (_c *MockSourceManager_ExportedAttributes_Call) Run(run func()) *MockSourceManager_ExportedAttributes_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockSourceManager_ExportedAttributes_Call) Return(stringToStringToV map[string]map[string]any, err error) *MockSourceManager_ExportedAttributes_Call {
+	_c.Call.Return(stringToStringToV, err)
+	return _c
+}
+
+func (_c *MockSourceManager_ExportedAttributes_Call) RunAndReturn(run func() (map[string]map[string]any, error)) *MockSourceManager_ExportedAttributes_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // GetComponent provides a mock function for the type MockSourceManager
 func (_mock *MockSourceManager) GetComponent(s string) (*components.Component, error) {
 	ret := _mock.Called(s)
@@ -642,6 +697,98 @@ func (_c *MockSourceManager_ReadResource_Call) RunAndReturn(run func(resource co
 	return _c
 }
 
+// RemoteDrift provides a mock function for the type MockSourceManager
+func (_mock *MockSourceManager) RemoteDrift() []manifests.RemoteDrift {
+	ret := _mock.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for RemoteDrift")
+	}
+
+	var r0 []manifests.RemoteDrift
+	if returnFunc, ok := ret.Get(0).(func() []manifests.RemoteDrift); ok {
+		r0 = returnFunc()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]manifests.RemoteDrift)
+		}
+	}
+	return r0
+}
+
+// MockSourceManager_RemoteDrift_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'RemoteDrift'
+type MockSourceManager_RemoteDrift_Call struct {
+	*mock.Call
+}
+
+// RemoteDrift is a helper method to define mock.On call
+func (_e *MockSourceManager_Expecter) RemoteDrift() *MockSourceManager_RemoteDrift_Call {
+	return &MockSourceManager_RemoteDrift_Call{Call: _e.mock.On("RemoteDrift")}
+}
+
+func (_c *MockSourceManager_RemoteDrift_Call) Run(run func()) *MockSourceManager_RemoteDrift_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockSourceManager_RemoteDrift_Call) Return(remoteDrifts []manifests.RemoteDrift) *MockSourceManager_RemoteDrift_Call {
+	_c.Call.Return(remoteDrifts)
+	return _c
+}
+
+func (_c *MockSourceManager_RemoteDrift_Call) RunAndReturn(run func() []manifests.RemoteDrift) *MockSourceManager_RemoteDrift_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// RemoteVersions provides a mock function for the type MockSourceManager
+func (_mock *MockSourceManager) RemoteVersions() []manifests.RemoteVersion {
+	ret := _mock.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for RemoteVersions")
+	}
+
+	var r0 []manifests.RemoteVersion
+	if returnFunc, ok := ret.Get(0).(func() []manifests.RemoteVersion); ok {
+		r0 = returnFunc()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]manifests.RemoteVersion)
+		}
+	}
+	return r0
+}
+
+// MockSourceManager_RemoteVersions_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'RemoteVersions'
+type MockSourceManager_RemoteVersions_Call struct {
+	*mock.Call
+}
+
+// RemoteVersions is a helper method to define mock.On call
+func (_e *MockSourceManager_Expecter) RemoteVersions() *MockSourceManager_RemoteVersions_Call {
+	return &MockSourceManager_RemoteVersions_Call{Call: _e.mock.On("RemoteVersions")}
+}
+
+func (_c *MockSourceManager_RemoteVersions_Call) Run(run func()) *MockSourceManager_RemoteVersions_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockSourceManager_RemoteVersions_Call) Return(remoteVersions []manifests.RemoteVersion) *MockSourceManager_RemoteVersions_Call {
+	_c.Call.Return(remoteVersions)
+	return _c
+}
+
+func (_c *MockSourceManager_RemoteVersions_Call) RunAndReturn(run func() []manifests.RemoteVersion) *MockSourceManager_RemoteVersions_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Rollback provides a mock function for the type MockSourceManager
 func (_mock *MockSourceManager) Rollback(context1 context.Context) error {
 	ret := _mock.Called(context1)
@@ -693,6 +840,63 @@ func (_c *MockSourceManager_Rollback_Call) RunAndReturn(run func(context1 contex
 	return _c
 }
 
+// SetComponents provides a mock function for the type MockSourceManager
+func (_mock *MockSourceManager) SetComponents(context1 context.Context, strings []string) error {
+	ret := _mock.Called(context1, strings)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetComponents")
+	}
+
+	var r0 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, []string) error); ok {
+		r0 = returnFunc(context1, strings)
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
+// MockSourceManager_SetComponents_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'SetComponents'
+type MockSourceManager_SetComponents_Call struct {
+	*mock.Call
+}
+
+// SetComponents is a helper method to define mock.On call
+//   - context1 context.Context
+//   - strings []string
+func (_e *MockSourceManager_Expecter) SetComponents(context1 interface{}, strings interface{}) *MockSourceManager_SetComponents_Call {
+	return &MockSourceManager_SetComponents_Call{Call: _e.mock.On("SetComponents", context1, strings)}
+}
+
+func (_c *MockSourceManager_SetComponents_Call) Run(run func(context1 context.Context, strings []string)) *MockSourceManager_SetComponents_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 []string
+		if args[1] != nil {
+			arg1 = args[1].([]string)
+		}
+		run(
+			arg0,
+			arg1,
+		)
+	})
+	return _c
+}
+
+func (_c *MockSourceManager_SetComponents_Call) Return(err error) *MockSourceManager_SetComponents_Call {
+	_c.Call.Return(err)
+	return _c
+}
+
+func (_c *MockSourceManager_SetComponents_Call) RunAndReturn(run func(context1 context.Context, strings []string) error) *MockSourceManager_SetComponents_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Sync provides a mock function for the type MockSourceManager
 func (_mock *MockSourceManager) Sync(context1 context.Context, syncOpts *source.SyncOpts) error {
 	ret := _mock.Called(context1, syncOpts)
@@ -749,3 +953,49 @@ func (_c *MockSourceManager_Sync_Call) RunAndReturn(run func(context1 context.Co
 	_c.Call.Return(run)
 	return _c
 }
+
+// SyncReports provides a mock function for the type MockSourceManager
+func (_mock *MockSourceManager) SyncReports() map[string]*source.SyncReport {
+	ret := _mock.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for SyncReports")
+	}
+
+	var r0 map[string]*source.SyncReport
+	if returnFunc, ok := ret.Get(0).(func() map[string]*source.SyncReport); ok {
+		r0 = returnFunc()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]*source.SyncReport)
+		}
+	}
+	return r0
+}
+
+// MockSourceManager_SyncReports_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'SyncReports'
+type MockSourceManager_SyncReports_Call struct {
+	*mock.Call
+}
+
+// SyncReports is a helper method to define mock.On call
+func (_e *MockSourceManager_Expecter) SyncReports() *MockSourceManager_SyncReports_Call {
+	return &MockSourceManager_SyncReports_Call{Call: _e.mock.On("SyncReports")}
+}
+
+func (_c *MockSourceManager_SyncReports_Call) Run(run func()) *MockSourceManager_SyncReports_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockSourceManager_SyncReports_Call) Return(stringToSyncReport map[string]*source.SyncReport) *MockSourceManager_SyncReports_Call {
+	_c.Call.Return(stringToSyncReport)
+	return _c
+}
+
+func (_c *MockSourceManager_SyncReports_Call) RunAndReturn(run func() map[string]*source.SyncReport) *MockSourceManager_SyncReports_Call {
+	_c.Call.Return(run)
+	return _c
+}
@@ -43,6 +43,8 @@ type Plan struct {
 	size       int
 	changesMap maps.Map
 	needReload bool
+	warnings   []string
+	notes      []string
 }
 
 func (p *Plan) addResourceChange(a actions.Action) {
@@ -227,11 +229,36 @@ func coalesceServices(changes []actions.Action) []actions.Action {
 	return results
 }
 
+// AddWarning records something the user should know about that doesn't change the plan's steps
+func (p *Plan) AddWarning(warning string) {
+	p.warnings = append(p.warnings, warning)
+}
+
+func (p *Plan) Warnings() []string {
+	return p.warnings
+}
+
+// AddNote records context for the plan, such as which version a remote resolved to
+func (p *Plan) AddNote(note string) {
+	p.notes = append(p.notes, note)
+}
+
+func (p *Plan) Notes() []string {
+	return p.notes
+}
+
 func (p *Plan) Pretty() string {
+	var result strings.Builder
+	for _, n := range p.notes {
+		fmt.Fprintf(&result, "Note: %v\n", n)
+	}
+	for _, w := range p.warnings {
+		fmt.Fprintf(&result, "Warning: %v\n", w)
+	}
 	if p.Empty() {
-		return "Nothing to do"
+		result.WriteString("Nothing to do")
+		return result.String()
 	}
-	var result strings.Builder
 	steps := p.Steps()
 	result.WriteString("Plan: \n")
 	for i, a := range steps {
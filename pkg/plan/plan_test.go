@@ -257,3 +257,19 @@ func Test_Plan(t *testing.T) {
 		})
 	}
 }
+
+func TestPlan_Warnings(t *testing.T) {
+	clearRegistry()
+	p := NewPlan()
+	p.AddWarning("remote hello is locked to abc but its source is at def")
+	assert.True(t, p.Empty())
+	assert.Equal(t, "Warning: remote hello is locked to abc but its source is at def\nNothing to do", p.Pretty())
+	assert.Nil(t, p.Add(act("hello", actions.ActionInstall, "hello.container", 0)))
+	assert.Contains(t, p.Pretty(), "Warning: remote hello")
+	assert.Contains(t, p.Pretty(), "Plan: \n1. ")
+	assert.Equal(t, []string{"remote hello is locked to abc but its source is at def"}, p.Warnings())
+
+	p.AddNote("remote hello resolved to v1.4.2 (~1.4)")
+	assert.Contains(t, p.Pretty(), "Note: remote hello resolved to v1.4.2 (~1.4)\nWarning: remote hello")
+	assert.Equal(t, []string{"remote hello resolved to v1.4.2 (~1.4)"}, p.Notes())
+}
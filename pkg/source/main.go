@@ -13,6 +13,16 @@ type Source interface {
 	Clean() error
 }
 
+// SparseSource is implemented by sources that can limit the checked out components
+type SparseSource interface {
+	SetComponents(ctx context.Context, components []string) error
+}
+
+// RevisionResolver is implemented by sources that can look up the revision a sync would move to without changing the local copy
+type RevisionResolver interface {
+	LatestRevision(ctx context.Context) (string, error)
+}
+
 type SourceConfig struct {
 	URL  string `toml:"url" json:"url" yaml:"url"`
 	Kind string `toml:"kind" json:"kind" yaml:"kind"`
@@ -24,6 +34,8 @@ type SyncOpts struct {
 
 type SyncReport struct {
 	OldRevision, NewRevision string
+	// Version is the tag a version constraint resolved to, NewerVersion the newest tag if it falls outside the constraint
+	Version, NewerVersion string
 }
 
 func (r SyncReport) CanRollback() bool {
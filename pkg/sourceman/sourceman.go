@@ -4,19 +4,26 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"charm.land/log/v2"
 	"primamateria.systems/materia/internal/repository"
 	"primamateria.systems/materia/internal/source/file"
 	"primamateria.systems/materia/internal/source/git"
+	httpsource "primamateria.systems/materia/internal/source/http"
 	"primamateria.systems/materia/internal/source/oci"
 	"primamateria.systems/materia/pkg/components"
 	"primamateria.systems/materia/pkg/manifests"
 	"primamateria.systems/materia/pkg/source"
 )
 
+// AttributeLookup resolves a string attribute for a remote component, used for remote credentials
+type AttributeLookup func(ctx context.Context, remote, name string) (string, error)
+
 type SourceManConfig struct {
 	SourceDir, RemoteDir string
 }
@@ -28,11 +35,25 @@ type sourcePlan struct {
 	Report  *source.SyncReport
 }
 
+// loadedRemote is a remote component added by LoadRemotes
+type loadedRemote struct {
+	name   string
+	source source.Source
+	// locked is the revision pinned by the repository lockfile, if any
+	locked string
+	// latest is what a locked remote's source resolved to on the last sync
+	latest string
+	// version is the remote's version constraint, if any
+	version string
+}
+
 type SourceManager struct {
 	components.ComponentReader
-	sourceDir string
-	remoteDir string
-	sources   []sourcePlan
+	sourceDir  string
+	remoteDir  string
+	sources    []sourcePlan
+	remotes    []loadedRemote
+	attributes AttributeLookup
 }
 
 func NewSourceManager(c *SourceManConfig) (*SourceManager, error) {
@@ -63,6 +84,7 @@ func (s *SourceManager) Sync(ctx context.Context, opts *source.SyncOpts) error {
 		src.Report = report
 		s.sources[i] = src
 	}
+	s.checkLockedRemotes(ctx)
 	return nil
 }
 
@@ -109,55 +131,301 @@ func (s *SourceManager) AddSource(newSource source.Source, opts *source.SyncOpts
 	return nil
 }
 
+// SyncReports returns the last sync report of each source, keyed by source name
+func (s *SourceManager) SyncReports() map[string]*source.SyncReport {
+	reports := make(map[string]*source.SyncReport, len(s.sources))
+	for _, src := range s.sources {
+		if src.Report != nil {
+			reports[src.String()] = src.Report
+		}
+	}
+	return reports
+}
+
+// SetComponents limits sparse primary sources to the given components
+func (s *SourceManager) SetComponents(ctx context.Context, names []string) error {
+	for _, src := range s.sources {
+		if !src.Primary {
+			continue
+		}
+		sparse, ok := src.Source.(source.SparseSource)
+		if !ok {
+			continue
+		}
+		if err := sparse.SetComponents(ctx, names); err != nil {
+			return fmt.Errorf("unable to set components for %v: %w", src.Source, err)
+		}
+	}
+	return nil
+}
+
+// SetAttributeLookup sets how attribute based remote credentials are resolved
+func (s *SourceManager) SetAttributeLookup(l AttributeLookup) {
+	s.attributes = l
+}
+
+func (s *SourceManager) lookupAttribute(ctx context.Context, remote, name string) (string, error) {
+	if s.attributes == nil {
+		return "", fmt.Errorf("attribute %v requested but no attributes engine available", name)
+	}
+	return s.attributes(ctx, remote, name)
+}
+
+func (s *SourceManager) applyCredentials(ctx context.Context, remote string, c *git.Config, creds *manifests.RemoteCredentials) error {
+	if creds == nil {
+		return nil
+	}
+	if creds.PrivateKey != "" {
+		c.PrivateKey = creds.PrivateKey
+	}
+	if creds.PassphraseFile != "" {
+		c.PassphraseFile = creds.PassphraseFile
+	}
+	if creds.PassphraseAttribute != "" {
+		passphrase, err := s.lookupAttribute(ctx, remote, creds.PassphraseAttribute)
+		if err != nil {
+			return err
+		}
+		c.Passphrase = passphrase
+	}
+	if creds.Username != "" {
+		c.Username = creds.Username
+	}
+	if creds.PasswordAttribute != "" {
+		password, err := s.lookupAttribute(ctx, remote, creds.PasswordAttribute)
+		if err != nil {
+			return err
+		}
+		c.Password = password
+	}
+	return nil
+}
+
+// LoadManifest loads the repository manifest, including the snippets in its snippets directory and those exported
+// by its remotes
 func (s *SourceManager) LoadManifest(filename string) (*manifests.MateriaManifest, error) {
 	manifestLocation := filepath.Join(s.sourceDir, manifests.MateriaManifestFile)
 	man, err := manifests.LoadMateriaManifest(manifestLocation)
 	if err != nil {
 		return nil, fmt.Errorf("error loading manifest: %w", err)
 	}
+	man.Snippets, err = repositorySnippets(s.sourceDir, man)
+	if err != nil {
+		return nil, err
+	}
+	exports, err := s.remoteExports(man)
+	if err != nil {
+		return nil, err
+	}
+	var snippets []manifests.SnippetConfig
+	exportedBy := make(map[string]string)
+	for _, name := range slices.Sorted(maps.Keys(exports)) {
+		for _, snippet := range exports[name].Snippets {
+			if other, ok := exportedBy[snippet.Name]; ok {
+				return nil, fmt.Errorf("snippet %v is exported by both remote %v and %v", snippet.Name, other, name)
+			}
+			exportedBy[snippet.Name] = name
+			if slices.ContainsFunc(man.Snippets, func(own manifests.SnippetConfig) bool { return own.Name == snippet.Name }) {
+				log.Debugf("snippet %v from remote %v is overridden by the repository", snippet.Name, name)
+				continue
+			}
+			snippet.Source = fmt.Sprintf("remote %v", name)
+			snippets = append(snippets, snippet)
+		}
+	}
+	man.Snippets = append(snippets, man.Snippets...)
 	return man, nil
 }
 
+// repositorySnippets returns the snippets defined in a repository's manifest and snippets directory
+func repositorySnippets(dir string, man *manifests.MateriaManifest) ([]manifests.SnippetConfig, error) {
+	snippets := make([]manifests.SnippetConfig, 0, len(man.Snippets))
+	for _, snippet := range man.Snippets {
+		snippet.Source = manifests.MateriaManifestFile
+		snippets = append(snippets, snippet)
+	}
+	files, err := manifests.LoadSnippetDir(filepath.Join(dir, manifests.SnippetDir), manifests.SnippetDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load repository snippets: %w", err)
+	}
+	for _, snippet := range files {
+		if i := slices.IndexFunc(snippets, func(own manifests.SnippetConfig) bool { return own.Name == snippet.Name }); i != -1 {
+			return nil, fmt.Errorf("snippet %v is defined in both %v and %v", snippet.Name, snippets[i].Source, snippet.Source)
+		}
+		snippets = append(snippets, snippet)
+	}
+	for _, snippet := range snippets {
+		if err := snippet.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return snippets, nil
+}
+
+// ExportedAttributes returns the attribute defaults exported by each remote, keyed by remote name
+func (s *SourceManager) ExportedAttributes() (map[string]map[string]any, error) {
+	man, err := manifests.LoadMateriaManifest(filepath.Join(s.sourceDir, manifests.MateriaManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("error loading manifest: %w", err)
+	}
+	exports, err := s.remoteExports(man)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]map[string]any)
+	for name, e := range exports {
+		if len(e.Attributes) > 0 {
+			result[name] = e.Attributes
+		}
+	}
+	return result, nil
+}
+
+// remoteExports reads the exports of the remotes that have been synced
+func (s *SourceManager) remoteExports(man *manifests.MateriaManifest) (map[string]*manifests.RemoteExports, error) {
+	exports := make(map[string]*manifests.RemoteExports)
+	for name, r := range man.Remotes {
+		manifestPath := filepath.Join(s.remoteDir, "components", name, r.Subpath, manifests.ComponentManifestFile)
+		if _, err := os.Stat(manifestPath); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		cm, err := manifests.LoadComponentManifestFromFile(manifestPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid manifest for remote %v: %w", name, err)
+		}
+		if cm.Exports != nil {
+			exports[name] = cm.Exports
+		}
+	}
+	return exports, nil
+}
+
+// ValidateRepository checks dir is a usable materia repository: a valid MANIFEST.toml and a components directory whose component manifests parse
+func ValidateRepository(dir string) error {
+	man, err := manifests.LoadMateriaManifest(filepath.Join(dir, manifests.MateriaManifestFile))
+	if err != nil {
+		return fmt.Errorf("invalid repository manifest: %w", err)
+	}
+	if err := man.Validate(); err != nil {
+		return fmt.Errorf("invalid repository manifest: %w", err)
+	}
+	if _, err := repositorySnippets(dir, man); err != nil {
+		return fmt.Errorf("invalid repository snippets: %w", err)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "components"))
+	if err != nil {
+		return fmt.Errorf("unable to read repository components: %w", err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		manifestPath := filepath.Join(dir, "components", e.Name(), manifests.ComponentManifestFile)
+		if _, err := os.Stat(manifestPath); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if _, err := manifests.LoadComponentManifestFromFile(manifestPath); err != nil {
+			return fmt.Errorf("invalid manifest for component %v: %w", e.Name(), err)
+		}
+	}
+	return nil
+}
+
+// newRemoteSource creates the source for a remote component, synced to localpath
+func (s *SourceManager) newRemoteSource(ctx context.Context, name string, r manifests.RemoteComponentConfig, localpath string) (source.Source, error) {
+	var remoteSource source.Source
+	var err error
+	if r.Version != "" {
+		switch {
+		case r.GitSource != nil:
+			r.GitSource.Version = r.Version
+		case r.OciSource != nil:
+			r.OciSource.Version = r.Version
+		default:
+			return nil, fmt.Errorf("remote %v: version constraints are only supported for git and oci remotes", name)
+		}
+	}
+	if r.GitSource != nil {
+		r.GitSource.LocalRepository = localpath
+		if err := s.applyCredentials(ctx, name, r.GitSource, r.Credentials); err != nil {
+			return nil, fmt.Errorf("invalid credentials for remote %v: %w", name, err)
+		}
+		remoteSource, err = git.NewGitSource(r.GitSource)
+		if err != nil {
+			return nil, fmt.Errorf("invalid git source: %w", err)
+		}
+	}
+	if r.FileSource != nil {
+		r.FileSource.Destination = localpath
+		remoteSource, err = file.NewFileSource(r.FileSource)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file source: %w", err)
+		}
+	}
+	if r.OciSource != nil {
+		r.OciSource.LocalRepository = localpath
+		remoteSource, err = oci.NewOCISource(r.OciSource)
+		if err != nil {
+			return nil, fmt.Errorf("invalid oci source: %w", err)
+		}
+	}
+	if r.HTTPSource != nil {
+		r.HTTPSource.LocalRepository = localpath
+		remoteSource, err = httpsource.NewHTTPSource(r.HTTPSource)
+		if err != nil {
+			return nil, fmt.Errorf("invalid http source: %w", err)
+		}
+	}
+	if remoteSource == nil {
+		return nil, fmt.Errorf("remote %v has no valid source config", name)
+	}
+	return remoteSource, nil
+}
+
+func (s *SourceManager) loadRemotesLock() (*manifests.RemotesLock, error) {
+	lock, err := manifests.LoadRemotesLock(filepath.Join(s.sourceDir, manifests.RemotesLockFile))
+	if err != nil {
+		return nil, fmt.Errorf("error loading remotes lockfile: %w", err)
+	}
+	return lock, nil
+}
+
 func (s *SourceManager) LoadRemotes(ctx context.Context) error {
 	manifestLocation := filepath.Join(s.sourceDir, manifests.MateriaManifestFile)
 	man, err := manifests.LoadMateriaManifest(manifestLocation)
 	if err != nil {
 		return err
 	}
-	for name, r := range man.Remotes {
-		var remoteSource source.Source
+	lock, err := s.loadRemotesLock()
+	if err != nil {
+		return err
+	}
+	s.remotes = nil
+	for _, name := range slices.Sorted(maps.Keys(man.Remotes)) {
+		r := man.Remotes[name]
 		localpath := filepath.Join(s.remoteDir, "components", name)
-		if r.GitSource != nil {
-			r.GitSource.LocalRepository = localpath
-			remoteSource, err = git.NewGitSource(r.GitSource)
-			if err != nil {
-				return fmt.Errorf("invalid git source: %w", err)
-			}
-		}
-		if r.FileSource != nil {
-			r.FileSource.Destination = localpath
-			remoteSource, err = file.NewFileSource(r.FileSource)
-			if err != nil {
-				return fmt.Errorf("invalid file source: %w", err)
-			}
+		src, err := s.newRemoteSource(ctx, name, r, localpath)
+		if err != nil {
+			return err
 		}
-		if r.OciSource != nil {
-			r.OciSource.LocalRepository = localpath
-			remoteSource, err = oci.NewOCISource(r.OciSource)
-			if err != nil {
-				return fmt.Errorf("invalid oci source: %w", err)
-			}
+		opts := &source.SyncOpts{
+			Subpath: r.Subpath,
 		}
-		if remoteSource == nil {
-			return fmt.Errorf("remote %v has no valid source config", name)
+		remote := loadedRemote{name: name, source: src, version: r.VersionConstraint()}
+		if revision, ok := lock.Lookup(name, r); ok {
+			// keep the revision in the sync opts so later syncs stay pinned too
+			opts.Revision = revision
+			remote.locked = revision
+		} else if _, ok := lock.Remotes[name]; ok {
+			log.Warnf("remote %v no longer matches its lockfile entry, run materia remotes lock to update it", name)
+		} else if len(lock.Remotes) > 0 && r.FileSource == nil {
+			log.Warnf("remote %v is not locked", name)
 		}
 		// Do initial sync here since we need the repository manifest downloaded before loading the remotes
 		// and will thus miss the initial Sync() call
-		report, err := remoteSource.Sync(ctx, source.SyncOpts{
-			Subpath: r.Subpath,
-		})
+		report, err := src.Sync(ctx, *opts)
 		if err != nil {
-			return err
+			return fmt.Errorf("unable to sync remote %v: %w", name, err)
 		}
 		if r.Subpath != "" {
 			localpath = filepath.Join(localpath, r.Subpath)
@@ -168,13 +436,13 @@ func (s *SourceManager) LoadRemotes(ctx context.Context) error {
 			}
 			return fmt.Errorf("cannot determine remote component validity: %w", err)
 		}
-		if err := s.AddSource(remoteSource, &source.SyncOpts{
-			Subpath: r.Subpath,
-		}, report, false); err != nil {
+		if err := s.AddSource(src, opts, report, false); err != nil {
 			return fmt.Errorf("unable to add remote component source %v: %w", name, err)
 		}
+		s.remotes = append(s.remotes, remote)
 
 	}
+	s.checkLockedRemotes(ctx)
 	// remove old remote components to keep things tidy
 	entries, err := os.ReadDir(filepath.Join(s.remoteDir, "components"))
 	if err != nil {
@@ -182,18 +450,137 @@ func (s *SourceManager) LoadRemotes(ctx context.Context) error {
 	}
 	for _, v := range entries {
 		if v.IsDir() {
-			if _, ok := man.Remotes[v.Name()]; !ok {
+			if _, ok := man.Remotes[strings.TrimSuffix(v.Name(), httpsource.CacheSuffix)]; !ok {
 				log.Debugf("Removing old remote component %v", v.Name())
 				err := os.RemoveAll(filepath.Join(s.remoteDir, "components", v.Name()))
 				if err != nil {
 					return err
 				}
 			}
+		} else if remote, ok := strings.CutSuffix(v.Name(), oci.DigestHistorySuffix); ok {
+			if _, ok := man.Remotes[remote]; !ok {
+				if err := os.Remove(filepath.Join(s.remoteDir, "components", v.Name())); err != nil {
+					return err
+				}
+			}
 		}
 	}
 	return nil
 }
 
+// checkLockedRemotes looks up the latest revision of each locked remote so RemoteDrift doesn't need the network.
+// Remotes that can't be checked are logged and skipped.
+func (s *SourceManager) checkLockedRemotes(ctx context.Context) {
+	for i, r := range s.remotes {
+		r.latest = ""
+		resolver, ok := r.source.(source.RevisionResolver)
+		if r.locked != "" && ok {
+			latest, err := resolver.LatestRevision(ctx)
+			if err != nil {
+				log.Warn("unable to check remote for updates", "remote", r.name, "error", err)
+			} else {
+				r.latest = latest
+			}
+		}
+		s.remotes[i] = r
+	}
+}
+
+// RemoteDrift returns the locked remotes whose source had moved past their locked revision on the last sync
+func (s *SourceManager) RemoteDrift() []manifests.RemoteDrift {
+	var drift []manifests.RemoteDrift
+	for _, r := range s.remotes {
+		if r.latest != "" && r.latest != r.locked {
+			drift = append(drift, manifests.RemoteDrift{Name: r.name, Locked: r.locked, Latest: r.latest})
+		}
+	}
+	return drift
+}
+
+// RemoteVersions returns what the version constraints of the loaded remotes resolved to on their last sync
+func (s *SourceManager) RemoteVersions() []manifests.RemoteVersion {
+	var versions []manifests.RemoteVersion
+	for _, r := range s.remotes {
+		if r.version == "" {
+			continue
+		}
+		v := manifests.RemoteVersion{Name: r.name, Constraint: r.version}
+		for _, src := range s.sources {
+			if src.Source == r.source && src.Report != nil {
+				v.Version, v.Newer = src.Report.Version, src.Report.NewerVersion
+			}
+		}
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+// LockRemotes resolves the remotes in the repository manifest to a lockfile. Existing entries are kept unless they're stale,
+// named in update or updateAll is set. Kept entries whose source has moved past their revision are returned as drift;
+// remotes that can't be checked are logged and skipped. The lockfile isn't written.
+func (s *SourceManager) LockRemotes(ctx context.Context, update []string, updateAll bool) (*manifests.RemotesLock, []manifests.RemoteDrift, error) {
+	man, err := s.LoadManifest(manifests.MateriaManifestFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range update {
+		if _, ok := man.Remotes[name]; !ok {
+			return nil, nil, fmt.Errorf("no remote named %v", name)
+		}
+	}
+	old, err := s.loadRemotesLock()
+	if err != nil {
+		return nil, nil, err
+	}
+	lock := &manifests.RemotesLock{Remotes: make(map[string]manifests.LockedRemote)}
+	var drift []manifests.RemoteDrift
+	for _, name := range slices.Sorted(maps.Keys(man.Remotes)) {
+		r := man.Remotes[name]
+		if r.SourceURL() == "" {
+			log.Warnf("remote %v can't be locked", name)
+			continue
+		}
+		locked, keep := old.Lookup(name, r)
+		keep = keep && !updateAll && !slices.Contains(update, name)
+		remoteSource, err := s.newRemoteSource(ctx, name, r, filepath.Join(s.remoteDir, "components", name))
+		if err != nil {
+			return nil, nil, err
+		}
+		resolver, ok := remoteSource.(source.RevisionResolver)
+		if keep {
+			lock.Remotes[name] = old.Remotes[name]
+			log.Debug("keeping locked remote", "remote", name, "revision", locked)
+			if !ok {
+				continue
+			}
+			latest, err := resolver.LatestRevision(ctx)
+			if err != nil {
+				log.Warn("unable to check remote for updates", "remote", name, "error", err)
+				continue
+			}
+			if latest != locked {
+				drift = append(drift, manifests.RemoteDrift{Name: name, Locked: locked, Latest: latest})
+			}
+			continue
+		}
+		if !ok {
+			log.Warnf("remote %v can't be locked", name)
+			continue
+		}
+		revision, err := resolver.LatestRevision(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to resolve remote %v: %w", name, err)
+		}
+		if previous, ok := old.Remotes[name]; ok && previous.Revision != revision {
+			log.Infof("Updated remote %v: %v -> %v", name, previous.Revision, revision)
+		} else if !ok {
+			log.Infof("Locked remote %v at %v", name, revision)
+		}
+		lock.Remotes[name] = manifests.LockedRemote{Source: r.SourceURL(), Revision: revision}
+	}
+	return lock, drift, nil
+}
+
 func (s *SourceManager) Clean() error {
 	// TODO
 	return nil
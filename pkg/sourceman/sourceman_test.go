@@ -1,12 +1,25 @@
 package sourceman
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"primamateria.systems/materia/internal/source/git"
+	httpsource "primamateria.systems/materia/internal/source/http"
 	"primamateria.systems/materia/internal/source/oci"
 	"primamateria.systems/materia/pkg/manifests"
 )
@@ -49,3 +62,335 @@ password = "token"
 	assert.Equal(t, "user/materia-caddy", remote.OciSource.Repository)
 	assert.Equal(t, "2026-03-06", remote.OciSource.Tag)
 }
+
+func TestRemoteCredentials(t *testing.T) {
+	sourceDir := t.TempDir()
+	require.NoError(t, os.WriteFile(
+		filepath.Join(sourceDir, manifests.MateriaManifestFile),
+		[]byte(`
+[Remotes.caddy.git]
+url = "git@git.example.com:user/materia-caddy"
+
+[Remotes.caddy.credentials]
+private_key = "/etc/materia/caddy_key"
+passphrase_attribute = "caddyPassphrase"
+`), 0o644,
+	))
+	man, err := manifests.LoadMateriaManifest(filepath.Join(sourceDir, manifests.MateriaManifestFile))
+	require.NoError(t, err)
+	remote := man.Remotes["caddy"]
+	require.NotNil(t, remote.Credentials)
+
+	s := &SourceManager{}
+	gc := &git.Config{}
+	assert.Error(t, s.applyCredentials(context.Background(), "caddy", gc, remote.Credentials), "no attributes engine")
+
+	s.SetAttributeLookup(func(_ context.Context, r, name string) (string, error) {
+		assert.Equal(t, "caddy", r)
+		assert.Equal(t, "caddyPassphrase", name)
+		return "hunter2", nil
+	})
+	require.NoError(t, s.applyCredentials(context.Background(), "caddy", gc, remote.Credentials))
+	assert.Equal(t, "/etc/materia/caddy_key", gc.PrivateKey)
+	assert.Equal(t, "hunter2", gc.Passphrase)
+}
+
+func TestValidateRepository(t *testing.T) {
+	dir := t.TempDir()
+	assert.Error(t, ValidateRepository(dir))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, manifests.MateriaManifestFile), []byte(`
+[Hosts.localhost]
+Components = ["hello"]
+`), 0o644))
+	assert.Error(t, ValidateRepository(dir), "missing components directory")
+
+	componentDir := filepath.Join(dir, "components", "hello")
+	require.NoError(t, os.MkdirAll(componentDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(componentDir, manifests.ComponentManifestFile), []byte(`[Defaults]`), 0o644))
+	assert.NoError(t, ValidateRepository(dir))
+
+	require.NoError(t, os.WriteFile(filepath.Join(componentDir, manifests.ComponentManifestFile), []byte(`not toml =`), 0o644))
+	assert.Error(t, ValidateRepository(dir))
+}
+
+func componentArchive(t *testing.T, manifest string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: manifests.ComponentManifestFile, Mode: 0o644, Typeflag: tar.TypeReg, Size: int64(len(manifest))}))
+	_, err := tw.Write([]byte(manifest))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestLoadRemotesHTTP(t *testing.T) {
+	archive := componentArchive(t, "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(archive)
+	}))
+	defer server.Close()
+	sum := sha256.Sum256(archive)
+
+	sourceDir, remoteDir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(remoteDir, "components", "old"+httpsource.CacheSuffix), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, manifests.MateriaManifestFile), fmt.Appendf(nil, `
+[Remotes.hello.http]
+url = "%v/hello.tar.gz"
+sha256 = "%x"
+`, server.URL, sum), 0o644))
+	s, err := NewSourceManager(&SourceManConfig{SourceDir: sourceDir, RemoteDir: remoteDir})
+	require.NoError(t, err)
+	require.NoError(t, s.LoadRemotes(context.Background()))
+
+	assert.FileExists(t, filepath.Join(remoteDir, "components", "hello", manifests.ComponentManifestFile))
+	assert.DirExists(t, filepath.Join(remoteDir, "components", "hello"+httpsource.CacheSuffix))
+	assert.NoDirExists(t, filepath.Join(remoteDir, "components", "old"+httpsource.CacheSuffix))
+}
+
+func TestRemotesLock(t *testing.T) {
+	ctx := context.Background()
+	archive := componentArchive(t, "[Defaults]\nversion = 1\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/SHA256SUMS" {
+			_, _ = fmt.Fprintf(w, "%x  hello.tar.gz\n", sha256.Sum256(archive))
+			return
+		}
+		_, _ = w.Write(archive)
+	}))
+	defer server.Close()
+
+	sourceDir, remoteDir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(remoteDir, "components"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, manifests.MateriaManifestFile), fmt.Appendf(nil, `
+[Remotes.hello.http]
+url = "%v/hello.tar.gz"
+checksum_url = "%v/SHA256SUMS"
+`, server.URL, server.URL), 0o644))
+	lockPath := filepath.Join(sourceDir, manifests.RemotesLockFile)
+	newManager := func() *SourceManager {
+		s, err := NewSourceManager(&SourceManConfig{SourceDir: sourceDir, RemoteDir: remoteDir})
+		require.NoError(t, err)
+		return s
+	}
+	first := fmt.Sprintf("sha256:%x", sha256.Sum256(archive))
+
+	s := newManager()
+	require.NoError(t, s.LoadRemotes(ctx))
+	lock, drift, err := s.LockRemotes(ctx, nil, false)
+	require.NoError(t, err)
+	assert.Empty(t, drift)
+	require.NoError(t, lock.Write(lockPath))
+	lock, err = manifests.LoadRemotesLock(lockPath)
+	require.NoError(t, err)
+	assert.Equal(t, manifests.LockedRemote{Source: fmt.Sprintf("http:%v/hello.tar.gz", server.URL), Revision: first}, lock.Remotes["hello"])
+
+	archive = componentArchive(t, "[Defaults]\nversion = 2\n")
+	second := fmt.Sprintf("sha256:%x", sha256.Sum256(archive))
+
+	// the locked revision is used even though the source has moved on
+	s = newManager()
+	require.NoError(t, s.LoadRemotes(ctx))
+	assert.Equal(t, first, s.SyncReports()[fmt.Sprintf("http:%v/hello.tar.gz", server.URL)].NewRevision)
+	content, err := os.ReadFile(filepath.Join(remoteDir, "components", "hello", manifests.ComponentManifestFile))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "version = 1")
+	assert.Equal(t, []manifests.RemoteDrift{{Name: "hello", Locked: first, Latest: second}}, s.RemoteDrift())
+
+	// locking again keeps existing entries and reports the drift, updating moves them
+	lock, drift, err = s.LockRemotes(ctx, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, first, lock.Remotes["hello"].Revision)
+	assert.Equal(t, []manifests.RemoteDrift{{Name: "hello", Locked: first, Latest: second}}, drift)
+	_, _, err = s.LockRemotes(ctx, []string{"missing"}, false)
+	assert.Error(t, err)
+	lock, drift, err = s.LockRemotes(ctx, []string{"hello"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, second, lock.Remotes["hello"].Revision)
+	assert.Empty(t, drift)
+	require.NoError(t, lock.Write(lockPath))
+
+	s = newManager()
+	require.NoError(t, s.LoadRemotes(ctx))
+	assert.Empty(t, s.RemoteDrift())
+	lock, drift, err = s.LockRemotes(ctx, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, second, lock.Remotes["hello"].Revision)
+	assert.Empty(t, drift)
+
+	// a lock entry for a different source is ignored
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, manifests.MateriaManifestFile), fmt.Appendf(nil, `
+[Remotes.hello.http]
+url = "%v/hello.tar.gz?v=3"
+checksum_url = "%v/SHA256SUMS"
+`, server.URL, server.URL), 0o644))
+	s = newManager()
+	require.NoError(t, s.LoadRemotes(ctx))
+	assert.Equal(t, second, s.SyncReports()[fmt.Sprintf("http:%v/hello.tar.gz?v=3", server.URL)].NewRevision)
+	assert.Empty(t, s.RemoteDrift())
+	lock, drift, err = s.LockRemotes(ctx, nil, false)
+	require.NoError(t, err)
+	assert.Empty(t, drift)
+	assert.Equal(t, fmt.Sprintf("http:%v/hello.tar.gz?v=3", server.URL), lock.Remotes["hello"].Source)
+}
+
+func TestLoadRemotesVersion(t *testing.T) {
+	ctx := context.Background()
+	remoteRepo := t.TempDir()
+	r, err := gogit.PlainInit(remoteRepo, false)
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	for _, tag := range []string{"v1.4.0", "v1.4.1", "v2.0.0"} {
+		require.NoError(t, os.WriteFile(filepath.Join(remoteRepo, manifests.ComponentManifestFile), fmt.Appendf(nil, "# %v\n", tag), 0o644))
+		_, err = w.Add(manifests.ComponentManifestFile)
+		require.NoError(t, err)
+		head, err := w.Commit(tag, &gogit.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}})
+		require.NoError(t, err)
+		_, err = r.CreateTag(tag, head, nil)
+		require.NoError(t, err)
+	}
+
+	sourceDir, remoteDir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(remoteDir, "components"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, manifests.MateriaManifestFile), fmt.Appendf(nil, `
+[Remotes.hello]
+version = "~1.4"
+[Remotes.hello.git]
+URL = "%v"
+`, remoteRepo), 0o644))
+	s, err := NewSourceManager(&SourceManConfig{SourceDir: sourceDir, RemoteDir: remoteDir})
+	require.NoError(t, err)
+	require.NoError(t, s.LoadRemotes(ctx))
+	assert.Equal(t, []manifests.RemoteVersion{{Name: "hello", Constraint: "~1.4", Version: "v1.4.1", Newer: "v2.0.0"}}, s.RemoteVersions())
+	content, err := os.ReadFile(filepath.Join(remoteDir, "components", "hello", manifests.ComponentManifestFile))
+	require.NoError(t, err)
+	assert.Equal(t, "# v1.4.1\n", string(content))
+
+	// the constraint is part of the lockfile source so changing it invalidates the lock
+	lock, _, err := s.LockRemotes(ctx, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, "git:"+remoteRepo+"#version=~1.4", lock.Remotes["hello"].Source)
+
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, manifests.MateriaManifestFile), []byte(`
+[Remotes.hello]
+version = "~1.4"
+[Remotes.hello.http]
+url = "https://example.com/hello.tar.gz"
+sha256 = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+`), 0o644))
+	assert.ErrorContains(t, s.LoadRemotes(ctx), "version constraints")
+}
+
+func TestRemoteExports(t *testing.T) {
+	sourceDir, remoteDir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, manifests.MateriaManifestFile), []byte(`
+[[Snippets]]
+Name = "shared"
+Body = "repo"
+
+[Remotes.web.git]
+URL = "https://example.com/web.git"
+[Remotes.db]
+subpath = "db"
+[Remotes.db.git]
+URL = "https://example.com/bundle.git"
+[Remotes.unsynced.git]
+URL = "https://example.com/unsynced.git"
+`), 0o644))
+	writeManifest := func(path, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	writeManifest(filepath.Join(remoteDir, "components", "web", manifests.ComponentManifestFile), `
+[[Exports.Snippets]]
+Name = "proxy"
+Body = "web"
+[[Exports.Snippets]]
+Name = "shared"
+Body = "web"
+[Exports.Attributes]
+port = 80
+`)
+	writeManifest(filepath.Join(remoteDir, "components", "db", "db", manifests.ComponentManifestFile), `
+[Defaults]
+local = true
+`)
+	s, err := NewSourceManager(&SourceManConfig{SourceDir: sourceDir, RemoteDir: remoteDir})
+	require.NoError(t, err)
+
+	man, err := s.LoadManifest(manifests.MateriaManifestFile)
+	require.NoError(t, err)
+	assert.Equal(t, []manifests.SnippetConfig{
+		{Name: "proxy", Body: "web", Source: "remote web"},
+		{Name: "shared", Body: "repo", Source: manifests.MateriaManifestFile},
+	}, man.Snippets)
+	attrs, err := s.ExportedAttributes()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[string]any{"web": {"port": int64(80)}}, attrs)
+
+	writeManifest(filepath.Join(remoteDir, "components", "db", "db", manifests.ComponentManifestFile), `
+[[Exports.Snippets]]
+Name = "proxy"
+Body = "db"
+`)
+	_, err = s.LoadManifest(manifests.MateriaManifestFile)
+	assert.ErrorContains(t, err, "snippet proxy is exported by both")
+}
+
+func TestRepositorySnippets(t *testing.T) {
+	sourceDir := t.TempDir()
+	write := func(path, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(sourceDir, path)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(sourceDir, path), []byte(content), 0o644))
+	}
+	write(manifests.MateriaManifestFile, `
+[[Snippets]]
+Name = "inline"
+Body = "inline"
+Parameters = ["host", { Name = "port", Default = 80 }]
+`)
+	write("snippets/proxy.gotmpl", "Label=proxy.host={{ .host }}\n")
+	write("snippets/proxy.toml", `
+Description = "Route a host through the proxy"
+Parameters = ["host", { Name = "path", Optional = true }]
+`)
+	write("snippets/plain.gotmpl", "plain")
+	write("snippets/README.md", "not a snippet")
+	require.NoError(t, os.MkdirAll(filepath.Join(sourceDir, "components"), 0o755))
+	s, err := NewSourceManager(&SourceManConfig{SourceDir: sourceDir, RemoteDir: t.TempDir()})
+	require.NoError(t, err)
+
+	man, err := s.LoadManifest(manifests.MateriaManifestFile)
+	require.NoError(t, err)
+	assert.Equal(t, []manifests.SnippetConfig{
+		{
+			Name:       "inline",
+			Body:       "inline",
+			Parameters: []manifests.SnippetParameter{{Name: "host"}, {Name: "port", Default: int64(80)}},
+			Source:     manifests.MateriaManifestFile,
+		},
+		{Name: "plain", Body: "plain", Source: "snippets/plain.gotmpl"},
+		{
+			Name:        "proxy",
+			Description: "Route a host through the proxy",
+			Body:        "Label=proxy.host={{ .host }}",
+			Parameters:  []manifests.SnippetParameter{{Name: "host"}, {Name: "path", Optional: true}},
+			Source:      "snippets/proxy.gotmpl",
+		},
+	}, man.Snippets)
+	assert.Equal(t, "proxy host [path]", man.Snippets[2].Usage())
+	require.NoError(t, ValidateRepository(sourceDir))
+
+	write("snippets/inline.gotmpl", "duplicate")
+	_, err = s.LoadManifest(manifests.MateriaManifestFile)
+	assert.ErrorContains(t, err, "snippet inline is defined in both")
+	require.NoError(t, os.Remove(filepath.Join(sourceDir, "snippets/inline.gotmpl")))
+
+	write("snippets/proxy.toml", `Parameters = [{ Name = "path", Optional = true }, "host"]`)
+	_, err = s.LoadManifest(manifests.MateriaManifestFile)
+	assert.ErrorContains(t, err, "required parameter host after an optional one")
+}